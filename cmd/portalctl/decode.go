@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gityf/portalserver/portal"
+)
+
+//result of the authenticator check
+const (
+	AUTH_OK         = "ok"
+	AUTH_MISMATCH   = "mismatch"
+	AUTH_NO_SECRET  = "not checked, no secret"
+	AUTH_NO_REQUEST = "not checked, request authenticator unknown"
+	AUTH_NONE       = "none"
+)
+
+type decodedAttr struct {
+	Type   uint8  `json:"type"`
+	Name   string `json:"name"`
+	Length uint8  `json:"length"`
+	Value  string `json:"value"`
+	Hex    string `json:"hex"`
+}
+
+type decodedPacket struct {
+	Index         int           `json:"index,omitempty"` //record number in a pcap
+	Time          string        `json:"time,omitempty"`
+	Src           string        `json:"src,omitempty"`
+	Dst           string        `json:"dst,omitempty"`
+	Length        int           `json:"length"`
+	Version       uint8         `json:"version"`
+	Type          uint8         `json:"type"`
+	TypeName      string        `json:"type_name"`
+	PacketType    string        `json:"packet_type"`
+	AuthMode      uint8         `json:"auth_mode"`
+	AuthModeName  string        `json:"auth_mode_name"`
+	Rsvd          uint8         `json:"rsvd"`
+	SerialNo      uint16        `json:"serial_no"`
+	ReqID         uint16        `json:"req_id"`
+	UserIP        string        `json:"user_ip"`
+	UserPort      uint16        `json:"user_port"`
+	ErrCode       uint8         `json:"err_code"`
+	AttrNum       uint8         `json:"attr_num"`
+	Authenticator string        `json:"authenticator,omitempty"`
+	AuthCheck     string        `json:"authenticator_check"`
+	Attrs         []decodedAttr `json:"attrs"`
+	Error         string        `json:"error,omitempty"`
+}
+
+type decoder struct {
+	secret  string
+	version uint
+	reqAuth []byte
+	//request authenticators of a pcap by serial no, to verify the responses
+	requests map[uint16][]byte
+}
+
+func runDecode(args []string) int {
+	fs := flag.NewFlagSet("decode", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: portalctl decode [flags] [file ...]\n\n"+
+			"decodes the files, stdin when none or \"-\". the input is a HexDumpString output\n"+
+			"pasted from the logs, plain hex, a raw packet or a pcap file\n\n")
+		fs.PrintDefaults()
+	}
+	format := fs.String("format", "auto", "input format: auto, hex, raw or pcap")
+	secret := fs.String("secret", "", "shared secret, to verify the authenticators")
+	version := fs.Uint("version", 0, "portal version 1 or 2, from the version field when 0")
+	reqAuth := fs.String("req-auth", "", "authenticator of the request in hex, to verify a single ACK")
+	port := fs.Int("port", 0, "only the datagrams of a pcap from or to this UDP port, 0 for all")
+	asJson := fs.Bool("json", false, "print JSON")
+	reveal := fs.Bool("reveal", false, "print PASSWD and CHAPPASSWD in clear")
+	if err := fs.Parse(args); err != nil {
+		return EXIT_USAGE
+	}
+
+	d := &decoder{secret: *secret, version: *version, requests: make(map[uint16][]byte)}
+	if *reqAuth != "" {
+		var err error
+		if d.reqAuth, err = hex.DecodeString(*reqAuth); err != nil || len(d.reqAuth) != portal.PORTAL_AUTHENTICATOR_LEN {
+			fmt.Fprintf(os.Stderr, "invalid -req-auth, %v hex bytes\n", portal.PORTAL_AUTHENTICATOR_LEN)
+			return EXIT_USAGE
+		}
+	}
+	if *reveal {
+		portal.EnableFullDump("portalctl decode", "-reveal flag")
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	var packets []*decodedPacket
+	for _, name := range files {
+		decoded, err := d.decodeFile(name, *format, *port)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", name, err)
+			return EXIT_FAILED
+		}
+		packets = append(packets, decoded...)
+	}
+
+	if *asJson {
+		out, _ := json.MarshalIndent(packets, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		for i, p := range packets {
+			if i > 0 {
+				fmt.Println()
+			}
+			printPacket(os.Stdout, p)
+		}
+	}
+	for _, p := range packets {
+		if p.Error != "" || strings.HasPrefix(p.AuthCheck, AUTH_MISMATCH) {
+			return EXIT_FAILED
+		}
+	}
+	return EXIT_OK
+}
+
+func (d *decoder) decodeFile(name, format string, port int) (packets []*decodedPacket, err error) {
+	var data []byte
+	if name == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return
+	}
+	if format == "auto" {
+		format = detectFormat(data)
+	}
+
+	switch format {
+	case "pcap":
+		var datagrams []portal.PcapPacket
+		if datagrams, err = portal.ReadPcap(bytes.NewReader(data)); err != nil {
+			return
+		}
+		for _, dg := range datagrams {
+			if port != 0 && dg.Src.Port != port && dg.Dst.Port != port {
+				continue
+			}
+			p := d.decode(dg.Payload)
+			p.Index = dg.Index
+			p.Time = dg.Time.Format("2006-01-02 15:04:05.000000")
+			p.Src = dg.Src.String()
+			p.Dst = dg.Dst.String()
+			packets = append(packets, p)
+		}
+	case "hex":
+		var raw []byte
+		if raw, err = portal.ParseHexDump(string(data)); err != nil {
+			return
+		}
+		packets = append(packets, d.decode(raw))
+	case "raw":
+		packets = append(packets, d.decode(data))
+	default:
+		err = fmt.Errorf("unknown format %q", format)
+	}
+	return
+}
+
+//detectFormat tells a pcap by its magic and hex text from binary
+func detectFormat(data []byte) string {
+	if len(data) >= 4 {
+		magic := binary.LittleEndian.Uint32(data)
+		for _, m := range []uint32{portal.PCAP_MAGIC, 0xa1b23c4d} {
+			if magic == m || binary.BigEndian.Uint32(data) == m {
+				return "pcap"
+			}
+		}
+	}
+	if utf8.Valid(data) && bytes.IndexByte(data, 0) < 0 {
+		if _, err := portal.ParseHexDump(string(data)); err == nil {
+			return "hex"
+		}
+	}
+	return "raw"
+}
+
+func (d *decoder) decode(raw []byte) *decodedPacket {
+	version := d.version
+	if version == 0 && len(raw) > 0 {
+		version = uint(raw[portal.PP_OFF_VERSION])
+	}
+	if version != portal.DEF_PORTAL_VERSION1 {
+		version = portal.DEF_PORTAL_VERSION2
+	}
+	pkt := &portal.PortalPacket{
+		Raw:           raw,
+		PackageLen:    len(raw),
+		PortalVersion: version,
+		SharedSecret:  d.secret,
+	}
+	out := &decodedPacket{Length: len(raw), Attrs: []decodedAttr{}}
+	if err := pkt.UnMarshal(); err != nil {
+		out.Error = err.Error()
+		if err == portal.ErrPacketTooShort {
+			return out
+		}
+	}
+	pkt.PackageType = portal.PackageTypeOf(pkt.PortalType)
+
+	out.Version = pkt.Version
+	out.Type = pkt.PortalType
+	out.TypeName = pkt.PortalTypeString()
+	out.PacketType = pkt.PacketTypeString()
+	out.AuthMode = pkt.AuthMode
+	out.AuthModeName = authModeName(pkt.AuthMode)
+	out.Rsvd = pkt.Rsvd
+	out.SerialNo = pkt.SerialNo
+	out.ReqID = pkt.ReqID
+	out.UserIP = pkt.UserIPStr
+	out.UserPort = pkt.UserPort
+	out.ErrCode = pkt.ErrCode
+	out.AttrNum = pkt.AttrNum
+	for i := range pkt.AVPS {
+		out.Attrs = append(out.Attrs, decodeAttr(&pkt.AVPS[i]))
+	}
+	if version == portal.DEF_PORTAL_VERSION1 {
+		out.AuthCheck = AUTH_NONE
+		return out
+	}
+	out.Authenticator = hex.EncodeToString(pkt.Authenticator)
+	out.AuthCheck = d.verify(pkt, out)
+	return out
+}
+
+//verify checks the authenticator, the one of a request is kept for its ack
+func (d *decoder) verify(pkt *portal.PortalPacket, out *decodedPacket) string {
+	if pkt.PackageType == portal.PACKETTYPE_REQ {
+		d.requests[pkt.SerialNo] = append([]byte(nil), pkt.Authenticator...)
+	}
+	if d.secret == "" {
+		return AUTH_NO_SECRET
+	}
+	if pkt.PackageType != portal.PACKETTYPE_REQ {
+		reqAuth := d.reqAuth
+		if auth, ok := d.requests[pkt.SerialNo]; ok {
+			reqAuth = auth
+		}
+		if reqAuth == nil {
+			return AUTH_NO_REQUEST
+		}
+		pkt.Authenticator = reqAuth
+	}
+	if pkt.VerifyAuthenticator() {
+		return AUTH_OK
+	}
+	if redactedDump(pkt) {
+		return AUTH_MISMATCH + ", credentials redacted in the dump"
+	}
+	return AUTH_MISMATCH
+}
+
+//redactedDump tells a packet whose credentials were overwritten by HexDumpString
+func redactedDump(pkt *portal.PortalPacket) bool {
+	for _, attr := range pkt.AVPS {
+		if portal.IsSecretAttr(attr.Type) && attr.Content != "" &&
+			strings.Trim(attr.Content, string(rune(portal.REDACTED_BYTE))) == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func authModeName(mode uint8) string {
+	switch mode {
+	case portal.AUTHMODE_CHAP:
+		return "CHAP"
+	case portal.AUTHMODE_PAP:
+		return "PAP"
+	}
+	return "UNKNOWN"
+}
+
+//decodeAttr renders the content by the type of the attribute
+func decodeAttr(attr *portal.AttributeValuePair) decodedAttr {
+	out := decodedAttr{Type: attr.Type, Name: attr.AttrTypeString(), Length: attr.Length}
+	content := []byte(attr.Content)
+	if portal.IsSecretAttr(attr.Type) {
+		if safe := attr.SafeContent(); safe != attr.Content {
+			out.Value, out.Hex = safe, safe
+			return out
+		}
+	}
+	out.Hex = hex.EncodeToString(content)
+
+	switch attr.Type {
+	case portal.ATTRTYPE_BASIP, portal.ATTRTYPE_IPCONFIG, portal.ATTRTYPE_USERIPV6:
+		if len(content) == net.IPv4len || len(content) == net.IPv6len {
+			out.Value = net.IP(content).String()
+			return out
+		}
+	case portal.ATTRTYPE_UPLINKFLUX, portal.ATTRTYPE_DOWNLINKFLUX, portal.ATTRTYPE_DELAYTIME:
+		switch len(content) {
+		case 4:
+			out.Value = fmt.Sprint(binary.BigEndian.Uint32(content))
+			return out
+		case 8:
+			out.Value = fmt.Sprint(binary.BigEndian.Uint64(content))
+			return out
+		}
+	case portal.ATTRTYPE_CHALLENGE, portal.ATTRTYPE_CHAPPASSWD:
+		out.Value = out.Hex
+		return out
+	case portal.ATTRTYPE_SESSIONID:
+		if len(content) == 6 {
+			out.Value = net.HardwareAddr(content).String()
+			return out
+		}
+	}
+	if printable(attr.Content) {
+		out.Value = attr.Content
+	} else {
+		out.Value = out.Hex
+	}
+	return out
+}
+
+func printable(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if r < ' ' || r == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func printPacket(w io.Writer, p *decodedPacket) {
+	if p.Index > 0 {
+		fmt.Fprintf(w, "packet %v  %v  %v -> %v\n", p.Index, p.Time, p.Src, p.Dst)
+	}
+	if p.Version == 0 && p.TypeName == "" && p.Error != "" {
+		fmt.Fprintf(w, "  %-14v %v (%v bytes)\n", "Error", p.Error, p.Length)
+		return
+	}
+	fmt.Fprintf(w, "  %-14v %v\n", "Version", p.Version)
+	fmt.Fprintf(w, "  %-14v 0x%02x %v %v\n", "Type", p.Type, nameOr(p.TypeName), p.PacketType)
+	fmt.Fprintf(w, "  %-14v 0x%02x %v\n", "AuthMode", p.AuthMode, p.AuthModeName)
+	fmt.Fprintf(w, "  %-14v %v\n", "Rsvd", p.Rsvd)
+	fmt.Fprintf(w, "  %-14v %v\n", "SerialNo", p.SerialNo)
+	fmt.Fprintf(w, "  %-14v %v\n", "ReqID", p.ReqID)
+	fmt.Fprintf(w, "  %-14v %v\n", "UserIP", p.UserIP)
+	fmt.Fprintf(w, "  %-14v %v\n", "UserPort", p.UserPort)
+	fmt.Fprintf(w, "  %-14v %v\n", "ErrCode", p.ErrCode)
+	fmt.Fprintf(w, "  %-14v %v\n", "AttrNum", p.AttrNum)
+	if p.Authenticator != "" {
+		fmt.Fprintf(w, "  %-14v %v (%v)\n", "Authenticator", p.Authenticator, p.AuthCheck)
+	}
+	for i, a := range p.Attrs {
+		fmt.Fprintf(w, "  %-14v %v(%v) len %v: %v\n", fmt.Sprintf("Attr %v", i+1), a.Name, a.Type, a.Length, a.Value)
+	}
+	if p.Error != "" {
+		fmt.Fprintf(w, "  %-14v %v (%v bytes)\n", "Error", p.Error, p.Length)
+	}
+}
+
+func nameOr(name string) string {
+	if name == "" {
+		return "UNKNOWN"
+	}
+	return name
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gityf/portalserver/portal"
+)
+
+//requestAndAck returns an authenticated REQ_AUTH and its ACK_AUTH
+func requestAndAck(secret string) (req, ack *portal.PortalPacket) {
+	req = &portal.PortalPacket{
+		Version:       portal.DEF_PORTAL_VERSION2,
+		PortalVersion: portal.DEF_PORTAL_VERSION2,
+		PackageType:   portal.PACKETTYPE_REQ,
+		PortalType:    portal.PACKETTYPE_REQAUTH,
+		AuthMode:      portal.AUTHMODE_PAP,
+		SerialNo:      42,
+		UserIP:        0x0a000005,
+		SharedSecret:  secret,
+		AVPS: []portal.AttributeValuePair{
+			{Type: portal.ATTRTYPE_USERNAME, Length: 4, Content: "user"},
+			{Type: portal.ATTRTYPE_PASSWD, Length: 6, Content: "secret"},
+		},
+	}
+	req.AttrNum = uint8(len(req.AVPS))
+	req.Marshal()
+	ack = &portal.PortalPacket{
+		Version:       portal.DEF_PORTAL_VERSION2,
+		PortalVersion: portal.DEF_PORTAL_VERSION2,
+		PackageType:   portal.PACKETTYPE_RSP,
+		PortalType:    portal.PACKETTYPE_ACKAUTH,
+		SerialNo:      42,
+		UserIP:        0x0a000005,
+		SharedSecret:  secret,
+		Authenticator: append([]byte(nil), req.Raw[portal.PP_OFF_AUTHENTICATOR:portal.PP_OFF_ATTRS]...),
+	}
+	ack.Marshal()
+	return
+}
+
+func TestDecodeHexDump(t *testing.T) {
+	req, _ := requestAndAck("88----89")
+
+	portal.EnableFullDump("test", "decode a full dump")
+	full := "2026/10/19 10:00:00 [DEBUG] AUTHEN serial:42,requ:\n" + req.HexDumpString()
+	portal.DisableFullDump()
+
+	d := &decoder{secret: "88----89", requests: make(map[uint16][]byte)}
+	raw, err := portal.ParseHexDump(full)
+	if err != nil {
+		t.Fatalf("parse err:%v", err)
+	}
+	p := d.decode(raw)
+	if p.TypeName != "REQ_AUTH" || p.PacketType != "REQ" || p.SerialNo != 42 || p.UserIP != "10.0.0.5" {
+		t.Errorf("header decoded as %+v", p)
+	}
+	if p.AuthCheck != AUTH_OK {
+		t.Errorf("authenticator %v", p.AuthCheck)
+	}
+	if len(p.Attrs) != 2 || p.Attrs[0].Value != "user" || p.Attrs[1].Value != portal.REDACTED {
+		t.Errorf("attrs decoded as %+v", p.Attrs)
+	}
+
+	//the default dump has the password overwritten
+	raw, _ = portal.ParseHexDump(req.HexDumpString())
+	if p := d.decode(raw); p.AuthCheck == AUTH_OK || p.Error != "" {
+		t.Errorf("redacted dump verified:%v err:%v", p.AuthCheck, p.Error)
+	}
+
+	raw, err = portal.ParseHexDump("0x" + hex.EncodeToString(req.Raw))
+	if err != nil || len(raw) != len(req.Raw) {
+		t.Errorf("plain hex: %v bytes, err:%v", len(raw), err)
+	}
+}
+
+func TestDecodePcap(t *testing.T) {
+	req, ack := requestAndAck("88----89")
+
+	dir := t.TempDir()
+	capture := portal.NewCapture(portal.CaptureOptions{Dir: dir})
+	capture.Enable()
+	portalAddr := mustUDPAddr(t, "10.0.0.2:50000")
+	basAddr := mustUDPAddr(t, "10.0.0.1:2000")
+	capture.Packet(portalAddr, basAddr, "10.0.0.1", req.Raw)
+	capture.Packet(basAddr, portalAddr, "10.0.0.1", ack.Raw)
+	name := capture.File()
+	capture.Disable()
+
+	data, _ := os.ReadFile(name)
+	if format := detectFormat(data); format != "pcap" {
+		t.Fatalf("detected %v", format)
+	}
+	d := &decoder{secret: "88----89", requests: make(map[uint16][]byte)}
+	packets, err := d.decodeFile(filepath.Clean(name), "auto", 2000)
+	if err != nil || len(packets) != 2 {
+		t.Fatalf("decoded %v packets, err:%v", len(packets), err)
+	}
+	if packets[1].TypeName != "ACK_AUTH" || packets[1].AuthCheck != AUTH_OK || packets[1].Src != "10.0.0.1:2000" {
+		t.Errorf("ack decoded as %+v", packets[1])
+	}
+
+	d = &decoder{secret: "wrong", requests: make(map[uint16][]byte)}
+	packets, _ = d.decodeFile(name, "pcap", 0)
+	if packets[0].AuthCheck != AUTH_MISMATCH {
+		t.Errorf("wrong secret verified:%v", packets[0].AuthCheck)
+	}
+}
+
+func mustUDPAddr(t *testing.T, s string) *net.UDPAddr {
+	addr, err := net.ResolveUDPAddr("udp", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr
+}
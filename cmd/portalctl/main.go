@@ -0,0 +1,66 @@
+package main
+
+/*
+	portalctl, the portal protocol tool of support and field engineers
+
+	portalctl decode [flags] [file ...]   decode hex dumps, raw packets or pcap files
+	portalctl challenge|login|logout|info -bas ip -secret s -userip ip [flags]
+	                                      drive a BAS, exit code is the PCMERR_* of the operation
+	portalctl ntf-listen [flags]          print what the BAS sends to the portal server
+*/
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+//exit codes besides the PCMERR_* of the portal operations
+const (
+	EXIT_OK     = 0
+	EXIT_FAILED = 1
+	EXIT_USAGE  = 64
+)
+
+type command struct {
+	run   func(args []string) int
+	usage string
+}
+
+var commands = map[string]command{
+	"decode":     {runDecode, "decode hex dumps, raw packets or pcap files"},
+	"challenge":  {runChallenge, "send REQ_CHALLENGE"},
+	"login":      {runLogin, "log a user in, CHALLENGE first for CHAP"},
+	"logout":     {runLogout, "log a user off"},
+	"info":       {runInfo, "query the port info of a user by REQ_INFO"},
+	"ntf-listen": {runNtfListen, "print the NTF_LOGOUT of the BAS and answer them"},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %v <command> [flags] [args]\n\ncommands:\n", os.Args[0])
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-12v %v\n", name, commands[name].usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun %v <command> -h for the flags of a command\n", os.Args[0])
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(EXIT_USAGE)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		if os.Args[1] != "-h" && os.Args[1] != "help" {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		}
+		usage()
+		os.Exit(EXIT_USAGE)
+	}
+	os.Exit(cmd.run(os.Args[2:]))
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gityf/portalserver/portal"
+)
+
+const (
+	DEF_NTF_PORT = portal.DEF_NTF_PORT
+	ENV_SECRET   = "PORTALCTL_SECRET"
+	ENV_PASSWORD = "PORTALCTL_PASSWORD"
+)
+
+//basFlags are the flags of every command talking to a BAS
+type basFlags struct {
+	fs       *flag.FlagSet
+	bas      *string
+	port     *int
+	secret   *string
+	version  *uint
+	auth     *string
+	timeout  *time.Duration
+	retries  *int
+	userIP   *string
+	asJson   *bool
+	reveal   *bool
+	quiet    *bool
+	decoder  *decoder
+	printed  int
+	userName *string
+	password *string
+}
+
+func newBasFlags(name, usage string, user bool) *basFlags {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	f := &basFlags{fs: fs}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: portalctl %v [flags]\n\n%v\n"+
+			"the exit code is the PCMERR_* code of the operation, %v for a usage error\n\n", name, usage, EXIT_USAGE)
+		fs.PrintDefaults()
+	}
+	f.bas = fs.String("bas", "", "BAS ip")
+	f.port = fs.Int("port", portal.DEF_BAS_PORT, "BAS port")
+	f.secret = fs.String("secret", "", "shared secret, $"+ENV_SECRET+" when empty")
+	f.version = fs.Uint("version", portal.DEF_PORTAL_VERSION2, "portal version 1 or 2")
+	f.auth = fs.String("auth", "PAP", "auth mode PAP or CHAP")
+	f.timeout = fs.Duration("timeout", portal.DEF_TIMEOUT, "ack timeout of each attempt")
+	f.retries = fs.Int("retries", portal.DEF_RETRY, "attempts of each request")
+	f.userIP = fs.String("userip", "", "user ip")
+	f.asJson = fs.Bool("json", false, "print the packets as JSON")
+	f.reveal = fs.Bool("reveal", false, "print PASSWD and CHAPPASSWD in clear")
+	f.quiet = fs.Bool("q", false, "print the result only, not the packets")
+	if user {
+		f.userName = fs.String("user", "", "user name")
+		f.password = fs.String("password", "", "password, $"+ENV_PASSWORD+" when empty")
+	}
+	return f
+}
+
+func (f *basFlags) parse(args []string) bool {
+	if err := f.fs.Parse(args); err != nil {
+		return false
+	}
+	if f.fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments %v\n", f.fs.Args())
+		return false
+	}
+	if *f.secret == "" {
+		*f.secret = os.Getenv(ENV_SECRET)
+	}
+	if f.password != nil && *f.password == "" {
+		*f.password = os.Getenv(ENV_PASSWORD)
+	}
+	if *f.reveal {
+		portal.EnableFullDump("portalctl "+f.fs.Name(), "-reveal flag")
+	}
+	f.decoder = &decoder{secret: *f.secret, version: *f.version, requests: make(map[uint16][]byte)}
+	return true
+}
+
+//client returns the portal client of the BAS, nil after printing the error
+func (f *basFlags) client() *portal.Client {
+	if net.ParseIP(*f.userIP).To4() == nil {
+		fmt.Fprintf(os.Stderr, "invalid -userip %q\n", *f.userIP)
+		return nil
+	}
+	c, err := portal.NewClient(portal.Options{
+		BasIP:        *f.bas,
+		BasPort:      *f.port,
+		SharedSecret: *f.secret,
+		Version:      *f.version,
+		AuthMode:     *f.auth,
+		Timeout:      *f.timeout,
+		Retries:      *f.retries,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil
+	}
+	return c
+}
+
+//transaction returns the PortalClient of one operation, printing its packets
+func (f *basFlags) transaction(c *portal.Client) *portal.PortalClient {
+	var userName, password string
+	if f.userName != nil {
+		userName, password = *f.userName, *f.password
+	}
+	p := c.NewPortalClient(userName, password, *f.userIP)
+	if !*f.quiet {
+		p.OnPacket = f.printDatagram
+	}
+	return p
+}
+
+func (f *basFlags) printDatagram(src, dst net.Addr, payload []byte) {
+	dp := f.decoder.decode(payload)
+	dp.Time = time.Now().Format("15:04:05.000000")
+	dp.Src, dp.Dst = src.String(), dst.String()
+	f.printed++
+	dp.Index = f.printed
+	if *f.asJson {
+		printJson(dp)
+		return
+	}
+	printPacket(os.Stdout, dp)
+	fmt.Println()
+}
+
+//result prints the outcome of the operation and returns its exit code
+func (f *basFlags) result(op string, ok bool, p *portal.PortalClient) int {
+	code := p.ErrCode
+	if !ok && code == portal.PCMERR_OK {
+		//failed before any ack was checked
+		code = portal.PCMERR_UNKNOWN
+	}
+	if ok {
+		fmt.Printf("%v: ok, serial:%v reqid:%v", op, p.SerialNo, p.ReqId)
+	} else {
+		fmt.Printf("%v: %v", op, portal.ErrCodeString(code))
+		if p.LastFailure != portal.PCMFAIL_NONE {
+			fmt.Printf(", %v", portal.FailureString(p.LastFailure))
+		}
+	}
+	if p.TextInfo != "" {
+		fmt.Printf(", textinfo:%q", p.TextInfo)
+	}
+	if p.PortInfo != "" {
+		fmt.Printf(", portinfo:%q", p.PortInfo)
+	}
+	fmt.Println()
+	return int(code)
+}
+
+//interruptContext is canceled by ctrl-c or SIGTERM
+func interruptContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+func runChallenge(args []string) int {
+	f := newBasFlags("challenge", "sends REQ_CHALLENGE, then a REQ_LOGOUT abandoning it unless -keep", true)
+	keep := f.fs.Bool("keep", false, "leave the challenge pending on the BAS")
+	if !f.parse(args) {
+		return EXIT_USAGE
+	}
+	c := f.client()
+	if c == nil {
+		return EXIT_USAGE
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	p := f.transaction(c)
+	p.Status = portal.PCMSTATUS_CHALLENGE
+	ok := p.ReqChallengeContext(ctx)
+	if ok && !*keep {
+		p.SendAbandonLogout()
+	}
+	p.ReleaseSerialNo()
+	return f.result("challenge", ok, p)
+}
+
+func runLogin(args []string) int {
+	f := newBasFlags("login", "logs the user in, with REQ_CHALLENGE first for CHAP", true)
+	if !f.parse(args) {
+		return EXIT_USAGE
+	}
+	c := f.client()
+	if c == nil {
+		return EXIT_USAGE
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	p := f.transaction(c)
+	return f.result("login", p.ReqLoginContext(ctx), p)
+}
+
+func runLogout(args []string) int {
+	f := newBasFlags("logout", "logs the user off by REQ_LOGOUT", true)
+	if !f.parse(args) {
+		return EXIT_USAGE
+	}
+	c := f.client()
+	if c == nil {
+		return EXIT_USAGE
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	p := f.transaction(c)
+	return f.result("logout", p.ReqLogoutContext(ctx), p)
+}
+
+func runInfo(args []string) int {
+	f := newBasFlags("info", "queries the port info of the user by REQ_INFO", false)
+	if !f.parse(args) {
+		return EXIT_USAGE
+	}
+	c := f.client()
+	if c == nil {
+		return EXIT_USAGE
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	p := f.transaction(c)
+	return f.result("info", p.ReqVlaninfoContext(ctx), p)
+}
+
+func printJson(v interface{}) {
+	out, _ := json.Marshal(v)
+	fmt.Println(string(out))
+}
+
+func runNtfListen(args []string) int {
+	fs := flag.NewFlagSet("ntf-listen", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: portalctl ntf-listen [flags]\n\n"+
+			"prints the NTF_LOGOUT and other packets the BAS sends to the portal server,\n"+
+			"and answers NTF_LOGOUT by ACK_LOGOUT unless -no-ack. stop with ctrl-c\n\n")
+		fs.PrintDefaults()
+	}
+	listen := fs.String("listen", fmt.Sprintf(":%v", DEF_NTF_PORT), "udp address to listen on")
+	bas := fs.String("bas", "", "only the packets of this BAS ip, every BAS when empty")
+	secret := fs.String("secret", "", "shared secret, $"+ENV_SECRET+" when empty")
+	version := fs.Uint("version", 0, "portal version 1 or 2, from the version field when 0")
+	noAck := fs.Bool("no-ack", false, "do not answer NTF_LOGOUT")
+	count := fs.Int("count", 0, "exit after this many packets, 0 for none")
+	asJson := fs.Bool("json", false, "print the packets as JSON")
+	reveal := fs.Bool("reveal", false, "print PASSWD and CHAPPASSWD in clear")
+	if err := fs.Parse(args); err != nil {
+		return EXIT_USAGE
+	}
+	if *secret == "" {
+		*secret = os.Getenv(ENV_SECRET)
+	}
+	if *reveal {
+		portal.EnableFullDump("portalctl ntf-listen", "-reveal flag")
+	}
+
+	conn, err := net.ListenPacket("udp", *listen)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_FAILED
+	}
+	defer conn.Close()
+	fmt.Fprintf(os.Stderr, "listening on udp %v\n", conn.LocalAddr())
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	d := &decoder{secret: *secret, version: *version, requests: make(map[uint16][]byte)}
+	buf := make([]byte, portal.MAX_PORTALPACKET_LEN)
+	for n := 1; *count == 0 || n <= *count; {
+		size, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return portal.PCMERR_OK
+			}
+			fmt.Fprintln(os.Stderr, err)
+			return EXIT_FAILED
+		}
+		raddr := addr.(*net.UDPAddr)
+		if *bas != "" && raddr.IP.String() != *bas {
+			continue
+		}
+		raw := append([]byte(nil), buf[:size]...)
+		dp := d.decode(raw)
+		dp.Index = n
+		dp.Time = time.Now().Format("2006-01-02 15:04:05.000000")
+		dp.Src, dp.Dst = raddr.String(), conn.LocalAddr().String()
+		if *asJson {
+			printJson(dp)
+		} else {
+			printPacket(os.Stdout, dp)
+			fmt.Println()
+		}
+		n++
+
+		if dp.Type != portal.PACKETTYPE_NTFLOGOUT || *noAck || dp.Error != "" {
+			continue
+		}
+		ack := ntfLogoutAck(raw, *secret, d.version)
+		if _, err := conn.WriteTo(ack, raddr); err != nil {
+			fmt.Fprintf(os.Stderr, "send ACK_LOGOUT err:%v\n", err)
+			continue
+		}
+		if !*asJson {
+			fmt.Printf("  ACK_LOGOUT sent to %v\n\n", raddr)
+		}
+	}
+	return portal.PCMERR_OK
+}
+
+//ntfLogoutAck returns the ACK_LOGOUT of a NTF_LOGOUT, authenticated over the one of the notification
+func ntfLogoutAck(ntf []byte, secret string, version uint) []byte {
+	if version == 0 {
+		version = uint(ntf[portal.PP_OFF_VERSION])
+	}
+	if version != portal.DEF_PORTAL_VERSION1 {
+		version = portal.DEF_PORTAL_VERSION2
+	}
+	req := &portal.PortalPacket{Raw: ntf, PackageLen: len(ntf), PortalVersion: version}
+	req.UnMarshal()
+	ack := portal.NtfLogoutAck(req, secret)
+	return ack.Marshal()
+}
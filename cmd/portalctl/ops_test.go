@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/gityf/portalserver/portal"
+	"github.com/gityf/portalserver/portal/portaltest"
+)
+
+//infoAck acks every REQ_INFO, signed with secret when set
+func infoAck(secret string) func(req *portal.PortalPacket) *portal.PortalPacket {
+	return func(req *portal.PortalPacket) *portal.PortalPacket {
+		if req.PortalType != portal.PACKETTYPE_REQINFO {
+			return nil
+		}
+		return &portal.PortalPacket{
+			PortalType:   portal.PACKETTYPE_ACKINFO,
+			SharedSecret: secret,
+			AVPS:         []portal.AttributeValuePair{{Type: portal.ATTRTYPE_PORT, Length: 5, Content: "eth/1"}},
+		}
+	}
+}
+
+func TestInfoExitCode(t *testing.T) {
+	port, stop := portaltest.FakeBAS(t, "secret", infoAck(""))
+	defer stop()
+	args := func(port int) []string {
+		return []string{"-bas", "127.0.0.1", "-port", strconv.Itoa(port), "-userip", "10.0.0.5", "-timeout", "200ms", "-q", "-secret", "secret"}
+	}
+
+	if code := runInfo(args(port)); code != portal.PCMERR_OK {
+		t.Errorf("info exit code %v", code)
+	}
+	//acks of a wrong secret fail the exchange
+	wrong, stopWrong := portaltest.FakeBAS(t, "secret", infoAck("wrong"))
+	defer stopWrong()
+	if code := runInfo(append(args(wrong), "-retries", "1")); code != portal.PCMERR_RECVTIMEOUT {
+		t.Errorf("info with a wrong secret exit code %v", code)
+	}
+	if code := runInfo([]string{"-bas", "127.0.0.1", "-userip", "nope"}); code != EXIT_USAGE {
+		t.Errorf("bad userip exit code %v", code)
+	}
+}
+
+func TestNtfLogoutAck(t *testing.T) {
+	ntf := &portal.PortalPacket{
+		Version:       portal.DEF_PORTAL_VERSION2,
+		PortalVersion: portal.DEF_PORTAL_VERSION2,
+		PackageType:   portal.PACKETTYPE_REQ,
+		PortalType:    portal.PACKETTYPE_NTFLOGOUT,
+		SerialNo:      7,
+		UserIP:        0x0a000005,
+		SharedSecret:  "secret",
+	}
+	ntf.Marshal()
+
+	raw := ntfLogoutAck(ntf.Raw, "secret", 0)
+	ack := &portal.PortalPacket{Raw: raw, PortalVersion: portal.DEF_PORTAL_VERSION2, PackageType: portal.PACKETTYPE_RSP, SharedSecret: "secret"}
+	if err := ack.UnMarshal(); err != nil {
+		t.Fatalf("unmarshal err:%v", err)
+	}
+	ack.Authenticator = ntf.Raw[portal.PP_OFF_AUTHENTICATOR:portal.PP_OFF_ATTRS]
+	if ack.PortalType != portal.PACKETTYPE_ACKLOGOUT || ack.SerialNo != 7 || !ack.VerifyAuthenticator() {
+		t.Errorf("ack type:%v serial:%v not verified", ack.PortalType, ack.SerialNo)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+/*
+	admin listener, loopback by default and off the portal port
+
+	/debug/pprof/     profiles of net/http/pprof
+	/debug/loglevel   runtime log level, see loglevel.go
+	/debug/capture    pcap capture of the BAS traffic, see capture.go
+	/metrics          prometheus metrics
+	/healthz          liveness
+	/readyz           readiness, with the checks and the status of every BAS probed
+	/config           config in force, secrets masked
+	/sessions         users online, ?userip=&brasip=&username= to filter
+	/bas              circuit breakers of the addresses of each BAS in use
+	/kick             POST ?userip=&brasip= logs the user out of the BAS
+*/
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/gityf/portalserver/internal/config"
+	"github.com/gityf/portalserver/internal/logic"
+	"github.com/gityf/portalserver/internal/metrics"
+	"github.com/gityf/portalserver/internal/session"
+	"github.com/gityf/portalserver/internal/util"
+	"github.com/gityf/portalserver/portal"
+	logger "github.com/gityf/portalserver/xlog4go"
+)
+
+const ADMIN_REALM = "portalserver admin"
+
+var startTime = time.Now()
+
+func init() {
+	metrics.NewGaugeFunc("portal_start_time_seconds", "Start time of the server in unix seconds.", func() float64 {
+		return float64(startTime.Unix())
+	})
+	metrics.NewGaugeFunc("portal_goroutines", "Goroutines of the server.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+}
+
+func adminAddr() string {
+	if config.Cfg.Admin.Addr != "" {
+		return config.Cfg.Admin.Addr
+	}
+	return "127.0.0.1:" + util.ToString(config.Cfg.PprofPort)
+}
+
+//newAdminMux routes the admin endpoints, behind basic auth when a user is set
+func newAdminMux() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/loglevel", LogLevelHandler)
+	mux.HandleFunc("/debug/capture", CaptureHandler)
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", HealthHandler)
+	mux.HandleFunc("/readyz", ReadyHandler)
+	mux.HandleFunc("/config", ConfigHandler)
+	mux.HandleFunc("/sessions", SessionsHandler)
+	mux.HandleFunc("/bas", BasHandler)
+	mux.HandleFunc("/kick", KickHandler)
+
+	ac := config.Cfg.Admin
+	if ac.User == "" {
+		return mux
+	}
+	return basicAuth(mux, ac.User, ac.Password)
+}
+
+//serveAdmin serves the admin endpoints until the process ends
+func serveAdmin() {
+	addr := adminAddr()
+	if host, _, err := net.SplitHostPort(addr); err == nil && config.Cfg.Admin.User == "" {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			logger.Warnw("admin listener reachable from the network without auth", "addr", addr)
+		}
+	}
+	logger.Info("admin listener at %v", addr)
+	if err := http.ListenAndServe(addr, newAdminMux()); err != nil {
+		logger.Error("failed to start admin listener:%s", err.Error())
+	}
+}
+
+//basicAuth lets through the requests of user and password
+func basicAuth(next http.Handler, user, password string) http.Handler {
+	//compared as digests, the time taken tells nothing of the lengths
+	wantUser, wantPassword := sha256.Sum256([]byte(user)), sha256.Sum256([]byte(password))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		gotUser, gotPassword := sha256.Sum256([]byte(u)), sha256.Sum256([]byte(p))
+		if !ok || subtle.ConstantTimeCompare(gotUser[:], wantUser[:])&
+			subtle.ConstantTimeCompare(gotPassword[:], wantPassword[:]) != 1 {
+			logger.Warnw("admin auth refused", "uri", r.URL.Path, "remote", r.RemoteAddr, "user", u)
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+ADMIN_REALM+`", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type adminResponse struct {
+	ErrNo  int         `json:"errno"`
+	ErrMsg string      `json:"errmsg"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+func writeAdminJson(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+	cnt, _ := json.MarshalIndent(&adminResponse{ErrMsg: "ok", Data: data}, "", "  ")
+	w.Write(cnt)
+}
+
+type healthView struct {
+	Status string `json:"status"`
+	Uptime string `json:"uptime"`
+}
+
+func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	writeAdminJson(w, &healthView{Status: "ok", Uptime: time.Since(startTime).Round(time.Second).String()})
+}
+
+//ReadyHandler answers 503 when a check fails or every BAS is down
+func ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	report := logic.Health.Report()
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+	resp := &adminResponse{ErrMsg: "ready", Data: report}
+	if !report.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		resp.ErrNo, resp.ErrMsg = http.StatusServiceUnavailable, "not ready"
+	}
+	cnt, _ := json.MarshalIndent(resp, "", "  ")
+	w.Write(cnt)
+}
+
+//ConfigHandler shows the config in force, the shared secret and passwords masked
+func ConfigHandler(w http.ResponseWriter, r *http.Request) {
+	writeAdminJson(w, config.Cfg.Masked())
+}
+
+type sessionsView struct {
+	Count    int               `json:"count"`
+	Sessions []session.Session `json:"sessions"`
+}
+
+func SessionsHandler(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	userIP, brasIP, userName := r.Form.Get("userip"), r.Form.Get("brasip"), r.Form.Get("username")
+	list := logic.Sessions.List(func(s session.Session) bool {
+		return (userIP == "" || s.UserIP == userIP) &&
+			(brasIP == "" || s.BrasIP == brasIP) &&
+			(userName == "" || s.UserName == userName)
+	})
+	writeAdminJson(w, &sessionsView{Count: len(list), Sessions: list})
+}
+
+type basView struct {
+	BrasIP   string                 `json:"brasip"`
+	Breakers []portal.BreakerStatus `json:"breakers"`
+}
+
+//BasHandler shows the breakers of the BAS talked to so far, the primary address first
+func BasHandler(w http.ResponseWriter, r *http.Request) {
+	clients := logic.PortalClients()
+	list := make([]basView, 0, len(clients))
+	for ip, client := range clients {
+		list = append(list, basView{BrasIP: ip, Breakers: client.Breakers()})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].BrasIP < list[j].BrasIP })
+	writeAdminJson(w, list)
+}
+
+//KickHandler logs out the user of a session kept by this server, the kick event is sent to the webhook
+func KickHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+	r.ParseForm()
+	userIP, brasIP := r.Form.Get("userip"), r.Form.Get("brasip")
+	status, err := http.StatusOK, error(nil)
+	switch {
+	case r.Method != http.MethodPost:
+		status, err = http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method)
+	case net.ParseIP(userIP).To4() == nil:
+		status, err = http.StatusBadRequest, fmt.Errorf("invalid userip %q", userIP)
+	default:
+		if err = logic.Kick(r.Context(), brasIP, userIP); err == logic.ErrNoSession {
+			status = http.StatusNotFound
+		} else if err != nil {
+			status = http.StatusBadGateway
+		}
+	}
+	resp := &adminResponse{ErrMsg: "ok"}
+	if err != nil {
+		w.WriteHeader(status)
+		resp.ErrNo, resp.ErrMsg = status, err.Error()
+	} else {
+		logger.Warnw("user kicked", "userip", userIP, "brasip", brasIP, "by", r.RemoteAddr)
+	}
+	cnt, _ := json.MarshalIndent(resp, "", "  ")
+	w.Write(cnt)
+}
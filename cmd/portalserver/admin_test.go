@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gityf/portalserver/internal/config"
+	"github.com/gityf/portalserver/internal/logic"
+	"github.com/gityf/portalserver/internal/session"
+)
+
+func TestAdmin(t *testing.T) {
+	defer func(c config.PortalServerConfig) { config.Cfg = c }(config.Cfg)
+	config.Cfg.SharedSecret = "88----89"
+	config.Cfg.Admin = config.AdminConfig{User: "ops", Password: "s3cret"}
+	logic.Sessions.Put(session.Session{UserIP: "10.0.0.2", BrasIP: "10.0.0.1", UserName: "alice", LoginTime: time.Now()})
+	logic.Sessions.Put(session.Session{UserIP: "10.0.0.3", BrasIP: "10.0.0.9", UserName: "bob", LoginTime: time.Now()})
+	defer logic.Sessions.Delete("10.0.0.1", "10.0.0.2")
+	defer logic.Sessions.Delete("10.0.0.9", "10.0.0.3")
+	admin := newAdminMux()
+
+	get := func(target, user, password string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", target, nil)
+		if user != "" {
+			r.SetBasicAuth(user, password)
+		}
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, r)
+		return w
+	}
+	for _, auth := range [][2]string{{"", ""}, {"ops", "wrong"}, {"root", "s3cret"}} {
+		if w := get("/healthz", auth[0], auth[1]); w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("auth %v: %v", auth, w.Code)
+		}
+	}
+	if w := get("/healthz", "ops", "s3cret"); w.Code != http.StatusOK {
+		t.Errorf("healthz: %v", w.Code)
+	}
+
+	body := get("/config", "ops", "s3cret").Body.String()
+	if strings.Contains(body, "88----89") || strings.Contains(body, "s3cret") || !strings.Contains(body, "******") {
+		t.Errorf("config not masked: %v", body)
+	}
+
+	var resp struct {
+		Data sessionsView `json:"data"`
+	}
+	json.Unmarshal(get("/sessions?brasip=10.0.0.1", "ops", "s3cret").Body.Bytes(), &resp)
+	if resp.Data.Count != 1 || resp.Data.Sessions[0].UserName != "alice" {
+		t.Errorf("sessions: %+v", resp.Data)
+	}
+	if w := get("/metrics", "ops", "s3cret"); !strings.Contains(w.Body.String(), "portal_sessions 2\n") {
+		t.Errorf("metrics: %v", w.Body)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+/*
+	runtime pcap capture of the BAS traffic, served on the admin listener
+
+	GET  /debug/capture                          capture status
+	POST /debug/capture?on=1|0[&brasip=ip1,ip2]  switch the capture, brasip= empty for every BAS
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gityf/portalserver/internal/global"
+	"github.com/gityf/portalserver/internal/logic"
+)
+
+type captureView struct {
+	On      bool     `json:"on"`
+	BrasIPs []string `json:"brasips"`
+	File    string   `json:"file"`
+	Packets uint64   `json:"packets"`
+}
+
+type captureResponse struct {
+	ErrNo  int          `json:"errno"`
+	ErrMsg string       `json:"errmsg"`
+	Data   *captureView `json:"data,omitempty"`
+}
+
+func CaptureHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+	r.ParseForm()
+
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		err = setCapture(r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		err = fmt.Errorf("method %v not allowed", r.Method)
+	}
+
+	resp := &captureResponse{ErrMsg: "ok"}
+	if err != nil {
+		resp.ErrNo = global.ERR_HTTP_PARSE_FAILED
+		resp.ErrMsg = err.Error()
+	} else {
+		capture := logic.PacketCapture
+		resp.Data = &captureView{
+			On:      capture.Enabled(),
+			BrasIPs: capture.Filter(),
+			File:    capture.File(),
+			Packets: capture.Count(),
+		}
+		if resp.Data.BrasIPs == nil {
+			resp.Data.BrasIPs = []string{}
+		}
+	}
+	cnt, _ := json.Marshal(resp)
+	w.Write(cnt)
+}
+
+func setCapture(r *http.Request) (err error) {
+	var on bool
+	switch s := r.Form.Get("on"); s {
+	case "1", "true":
+		on = true
+	case "0", "false":
+	default:
+		return fmt.Errorf("invalid on %q, 1 or 0", s)
+	}
+	if _, ok := r.Form["brasip"]; ok {
+		var ips []string
+		for _, ip := range strings.Split(r.Form.Get("brasip"), ",") {
+			if ip = strings.TrimSpace(ip); ip == "" {
+				continue
+			}
+			if net.ParseIP(ip).To4() == nil {
+				return fmt.Errorf("invalid brasip %q, IPv4 only", ip)
+			}
+			ips = append(ips, ip)
+		}
+		logic.PacketCapture.SetFilter(ips)
+	}
+
+	by := "http " + r.RemoteAddr
+	if on {
+		logic.EnableCapture(by)
+	} else if logic.PacketCapture.Enabled() {
+		logic.DisableCapture(by)
+	}
+	return
+}
@@ -10,11 +10,13 @@ import (
 	"sync"
 	"strings"
 
-	logger "github.com/xlog4go"
+	logger "github.com/gityf/portalserver/xlog4go"
 	"net/url"
 	"reflect"
 	"strconv"
-	"global"
+	"github.com/gityf/portalserver/internal/global"
+	"github.com/gityf/portalserver/internal/portalctx"
+	"github.com/gityf/portalserver/internal/metrics"
 )
 
 type HttpResponse struct {
@@ -83,6 +85,16 @@ func doResponse(logid string, errno int, errmsg string, writer io.Writer) (r Htt
 	return
 }
 
+//module of the http logs, see Modules of log.json
+const LOG_MODULE_HTTP = "http"
+
+var (
+	httpRequests = metrics.NewCounter("portal_http_requests_total",
+		"Requests of the portal api and pages by handler and errno.", "handler", "errno")
+	httpLatency = metrics.NewHistogram("portal_http_request_seconds",
+		"Latency of the portal api and pages by handler.", nil, "handler")
+)
+
 type portalServerHandler struct {
 	Name     string
 	MessageType uint64
@@ -95,7 +107,7 @@ func (portalServerH *portalServerHandler) ServeHTTP(w http.ResponseWriter, r *ht
 	var logId int64
 	var resp HttpResponser
 	var errCode int
-	var info map[string]interface{}
+	var reqLog *logger.Entry
 
 	tBegin := time.Now()	
 	portalServerH.wg.Add(1)
@@ -113,31 +125,25 @@ func (portalServerH *portalServerHandler) ServeHTTP(w http.ResponseWriter, r *ht
 		//捕捉panic
 		if err := recover(); err != nil {
 			errCode = global.ERR_PANIC
-			logger.Error("LogId:%d HandleError# recover errno:%d stack:%s", logId, errCode, string(debug.Stack()))
+			reqLog.Errorw("HandleError# recover", "errno", errCode, "stack", string(debug.Stack()))
 		}
-		logger.Warn("%v, cost:%v", info, latency)
+		reqLog.Warnw("request done", "errno", errCode, "cost", latency, "param", portalctx.RedactForm(r.Form), "host", r.Host)
+		httpRequests.Inc(portalServerH.Name, strconv.Itoa(errCode))
+		httpLatency.Observe(latency.Seconds(), portalServerH.Name)
 	}()
 
 	logId = logidGenerator.GetNextId()
+	//every log of this request carries the logid
+	reqLog = logger.Module(LOG_MODULE_HTTP).With("logid", logId, "uri", r.URL.Path, "remote", r.RemoteAddr)
 	r.ParseForm()
-	info = GetHttpRequestInfo(r)
-	resp = portalServerH.Callfunc(w, r, logId, portalServerH.MessageType)
-	return
-}
-
-func GetHttpRequestInfo(r *http.Request) (info map[string]interface{}) {
-	info = make(map[string]interface{})
-	info["url"] = r.URL.Path
-	info["param"] = r.Form
-	info["host"] = r.Host
-	info["remote"]=r.RemoteAddr
-	s1 := strings.Split(r.URL.Path, "/")
-	if len(s1) > 0 {
-		info["name"] = s1[len(s1)-1]
-	} else {
-		info["name"] = "NoBody"
+	//the user and BAS of the request, for the level filters
+	for _, key := range []string{"userip", "brasip"} {
+		if v := r.Form.Get(key); v != "" {
+			reqLog = reqLog.With(key, v)
+		}
 	}
-	info["now"]=time.Now()
+	r = r.WithContext(logger.NewContext(r.Context(), reqLog))
+	resp = portalServerH.Callfunc(w, r, logId, portalServerH.MessageType)
 	return
 }
 
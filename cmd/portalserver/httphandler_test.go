@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	logger "github.com/gityf/portalserver/xlog4go"
+)
+
+//recordWriter keeps the records of the default logger
+type recordWriter struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (w *recordWriter) Init() error {
+	return nil
+}
+
+func (w *recordWriter) Write(r *logger.Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lines = append(w.lines, r.StringInfo(0), r.JsonString())
+	return nil
+}
+
+//find waits for the records holding s
+func (w *recordWriter) find(s string) (lines []string) {
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		w.mu.Lock()
+		for _, line := range w.lines {
+			if strings.Contains(line, s) {
+				lines = append(lines, line)
+			}
+		}
+		w.mu.Unlock()
+		if len(lines) > 0 {
+			return
+		}
+	}
+	return
+}
+
+//requestLog keeps the records of the tests, registered before the logger writes any
+var requestLog = &recordWriter{}
+
+func TestMain(m *testing.M) {
+	logger.Register(requestLog)
+	os.Exit(m.Run())
+}
+
+func TestRequestLogRedacted(t *testing.T) {
+	h := &portalServerHandler{Name: "login", Callfunc: func(w http.ResponseWriter, r *http.Request, logId int64, messageType uint64) HttpResponser {
+		return &HttpResponse{ErrMsg: "ok"}
+	}}
+	r := httptest.NewRequest("POST", "/portalserver/login?userip=10.0.0.9", strings.NewReader("username=alice&password=s3cr3t"))
+	r.Header.Set("content-type", "application/x-www-form-urlencoded")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	lines := requestLog.find("request done")
+	if len(lines) == 0 {
+		t.Fatalf("request not logged")
+	}
+	for _, line := range lines {
+		if strings.Contains(line, "s3cr3t") {
+			t.Errorf("password logged:%v", line)
+		}
+		if !strings.Contains(line, "alice") {
+			t.Errorf("form not logged:%v", line)
+		}
+	}
+}
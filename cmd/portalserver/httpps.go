@@ -0,0 +1,100 @@
+package main
+
+/*
+	http接口实现
+
+*/
+
+import (
+	"github.com/gityf/portalserver/internal/global"
+	"net/http"
+	"strings"
+	logger "github.com/gityf/portalserver/xlog4go"
+	"io"
+	"github.com/gityf/portalserver/internal/portalctx"
+	"github.com/gityf/portalserver/internal/logic"
+)
+
+func FuncHandler(w http.ResponseWriter, r *http.Request, logId int64, messageType uint64) HttpResponser {
+	formData := &portalctx.FormStruct{}
+	if err := ParseForm(Input(r), formData); err != nil {
+		return doErrorResponse("", global.ERR_HTTP_PARSE_FAILED, err.Error(), w)
+	}
+	fillLanding(w, r, formData)
+	logger.FromContext(r.Context()).Warn("FormStruct: %+v", formData.Redacted())
+
+	msg := &portalctx.Message{
+		LogId:       logId,
+		Writer:      w,
+		Ctx:         r.Context(),
+		FormStruct: formData,
+		MessageType: messageType,
+	}
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+
+	return logic.HandleMessage(msg)
+}
+
+func StaticResource(w http.ResponseWriter, r *http.Request, logId int64, messageType uint64) HttpResponser {
+	if resp, ok := renderPage(w, r); ok {
+		return resp
+	}
+	resp := portalctx.NewBaseResponse()
+	if staticServer.Serve(w, r) {
+		return resp
+	}
+	logger.FromContext(r.Context()).Info("static resource not found")
+	resp.Errmsg = "Not Found."
+	resp.Errno = http.StatusNotFound
+	//browsers get a page, api clients the json they expect
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("content-type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "<!DOCTYPE html><html><head><title>Not Found</title></head>"+
+			"<body><h1>Not Found</h1><p><a href=\"/\">Back to the login page</a></p></body></html>")
+		return resp
+	}
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	resp.ResponseJson(w)
+	return resp
+}
+
+/*
+ ************************************************************
+ * PingHandler
+ *************************************************************
+ */
+func PingHandler(w http.ResponseWriter, r *http.Request, logId int64, messageType uint64) HttpResponser {
+	r.ParseForm()
+	resp := &HttpResponse{
+		ErrNo:  0,
+		ErrMsg: "ok",
+	}
+
+	resp.ResponseJson(w)
+	return resp
+}
+
+/*
+ ************************************************************
+ * probes of the load balancers, the details are on the admin listener
+ *************************************************************
+ */
+func LiveProbeHandler(w http.ResponseWriter, r *http.Request, logId int64, messageType uint64) HttpResponser {
+	resp := &HttpResponse{ErrMsg: "ok"}
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+	resp.ResponseJson(w)
+	return resp
+}
+
+func ReadyProbeHandler(w http.ResponseWriter, r *http.Request, logId int64, messageType uint64) HttpResponser {
+	resp := &HttpResponse{ErrMsg: "ready"}
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+	if !logic.Health.Report().Ready {
+		resp.ErrNo, resp.ErrMsg = http.StatusServiceUnavailable, "not ready"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	resp.ResponseJson(w)
+	return resp
+}
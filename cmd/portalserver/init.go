@@ -1,9 +1,10 @@
 package main
 
 import (
+	"context"
 	"net"
 	"net/http"
-	"global"
+	"github.com/gityf/portalserver/internal/global"
 	"time"
 	"sync/atomic"
 )
@@ -11,29 +12,36 @@ import (
 var logFile = "./conf/log.json"
 var confFile = "./conf/portalserver.json"
 
-var reqchan = make(chan string, 1000000)
-
 var logidGenerator LogId
 
 var portalServerListener net.Listener
-var httpServer http.Server
+var httpServer *http.Server
 
 var uri2Handler map[string]*portalServerHandler
 
 
 var portalServerQuit chan int
+
+//canceled on shutdown, parent of every request context
+var portalServerCtx context.Context
+var portalServerCancel context.CancelFunc
+
 func init() {
 	logidGenerator = LogId(time.Now().Unix())
 
 	//安全退出
 	portalServerQuit = make(chan int)
+	portalServerCtx, portalServerCancel = context.WithCancel(context.Background())
 
 	uri2Handler = make(map[string]*portalServerHandler)
 
 	uri2Handler["/portalserver/login"] = &portalServerHandler{Name: "Login", MessageType: global.KMsgTypeLogin, Callfunc: FuncHandler}
+	uri2Handler["/portalserver/login/status"] = &portalServerHandler{Name: "LoginStatus", Callfunc: LoginStatusHandler}
 	uri2Handler["/portalserver/logout"] = &portalServerHandler{Name: "Logout", MessageType: global.KMsgTypeLogout, Callfunc: FuncHandler}
 	uri2Handler["/portalserver/getvlaninfo"] = &portalServerHandler{Name: "GetVlaninfo", MessageType: global.KMsgTypeGetVlanInfo, Callfunc: FuncHandler}
 	uri2Handler["/ping"] = &portalServerHandler{Name: "Ping", Callfunc: PingHandler}
+	uri2Handler["/healthz"] = &portalServerHandler{Name: "Healthz", Callfunc: LiveProbeHandler}
+	uri2Handler["/readyz"] = &portalServerHandler{Name: "Readyz", Callfunc: ReadyProbeHandler}
 	uri2Handler["/"] = &portalServerHandler{Name: "GetPortalServerInfo", Callfunc: StaticResource}
 }
 
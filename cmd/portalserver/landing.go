@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gityf/portalserver/internal/config"
+	"github.com/gityf/portalserver/internal/landing"
+	"github.com/gityf/portalserver/internal/portalctx"
+	logger "github.com/gityf/portalserver/xlog4go"
+)
+
+//landing of every browser session, see setupLanding
+var landingStore = landing.NewStore(0, 0)
+
+func setupLanding() {
+	landingStore = landing.NewStore(time.Duration(config.Cfg.Landing.SessionTTL)*time.Second, 0)
+}
+
+//resolveLanding returns the BAS parameters of the request url, else the ones kept for the
+//browser session. with keep the parameters of the url are kept for the session, under a cookie
+func resolveLanding(w http.ResponseWriter, r *http.Request, keep bool) landing.Params {
+	var id string
+	var kept landing.Params
+	var hasKept bool
+	if c, err := r.Cookie(landing.SESSION_COOKIE); err == nil {
+		id = c.Value
+		kept, hasKept = landingStore.Get(id)
+	}
+	found, ok := landing.Parse(r.Form)
+	if !ok {
+		return kept
+	}
+	if hasKept && found.UserIP == kept.UserIP {
+		//a redirect of the same user, keep what this one misses
+		found = found.Merge(kept)
+	}
+	if !keep || found == kept {
+		return found
+	}
+	if !hasKept {
+		id = ""
+	}
+	newId := landingStore.Put(id, found)
+	if newId != id {
+		http.SetCookie(w, &http.Cookie{
+			Name:     landing.SESSION_COOKIE,
+			Value:    newId,
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	logger.FromContext(r.Context()).Debugw("landing kept", "vendor", found.Vendor,
+		"userip", found.UserIP, "brasip", found.BrasIP, "usermac", found.UserMac)
+	return found
+}
+
+//fillLanding completes the user and BAS of the form from the landing of the request
+func fillLanding(w http.ResponseWriter, r *http.Request, form *portalctx.FormStruct) {
+	p := resolveLanding(w, r, false)
+	if form.UserIP == "" {
+		form.UserIP = p.UserIP
+	}
+	if form.BrasIP == "" {
+		form.BrasIP = p.BrasIP
+	}
+	if form.UserMac == "" {
+		form.UserMac = p.UserMac
+	}
+	if form.AcName == "" {
+		form.AcName = p.AcName
+	}
+	if form.SSID == "" {
+		form.SSID = p.SSID
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+/*
+	status of the async logins, by id:
+		/portalserver/login/status?id=           at once
+		/portalserver/login/status?id=&wait=20   long-polling, once the version is past version= or done
+		Accept: text/event-stream, or stream=1   server-sent events until the login is done
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gityf/portalserver/internal/global"
+	"github.com/gityf/portalserver/internal/logic"
+	"github.com/gityf/portalserver/internal/logintxn"
+	logger "github.com/gityf/portalserver/xlog4go"
+)
+
+const (
+	//longest wait= of a long-poll
+	MAX_STATUS_WAIT = 30 * time.Second
+	//longest event stream, a login is done long before
+	MAX_STATUS_STREAM = 2 * time.Minute
+)
+
+type loginStatusResponse struct {
+	ErrNo  int              `json:"errno"`
+	ErrMsg string           `json:"errmsg"`
+	Data   *logintxn.Status `json:"data,omitempty"`
+}
+
+func (r *loginStatusResponse) ErrCode() int {
+	return r.ErrNo
+}
+
+func (r *loginStatusResponse) ResponseJson(w io.Writer) (int, error) {
+	cnt, _ := json.Marshal(r)
+	return w.Write(cnt)
+}
+
+func (r *loginStatusResponse) String() string {
+	cnt, _ := json.Marshal(r)
+	return string(cnt)
+}
+
+func (r *loginStatusResponse) Error() string {
+	return fmt.Sprintf("errno=%v,errmsg=%v", r.ErrNo, r.ErrMsg)
+}
+
+func LoginStatusHandler(w http.ResponseWriter, r *http.Request, logId int64, messageType uint64) HttpResponser {
+	id := r.Form.Get("id")
+	resp := &loginStatusResponse{ErrMsg: "ok"}
+	status, ok := logic.LoginTxns.Get(id)
+	if !ok {
+		w.Header().Set("content-type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		resp.ErrNo, resp.ErrMsg = global.ERR_NOT_FOUND, "unknown login id"
+		resp.ResponseJson(w)
+		return resp
+	}
+	if r.Form.Get("stream") == "1" || r.Header.Get("Accept") == "text/event-stream" {
+		streamLoginStatus(w, r, status)
+		return resp
+	}
+
+	if wait, _ := strconv.Atoi(r.Form.Get("wait")); wait > 0 {
+		timeout := time.Duration(wait) * time.Second
+		if timeout > MAX_STATUS_WAIT {
+			timeout = MAX_STATUS_WAIT
+		}
+		version := status.Version
+		if v, err := strconv.Atoi(r.Form.Get("version")); err == nil {
+			version = v
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		status, _ = logic.LoginTxns.Wait(ctx, id, version)
+		cancel()
+	}
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+	w.Header().Set("cache-control", "no-store")
+	resp.Data = &status
+	resp.ResponseJson(w)
+	return resp
+}
+
+//streamLoginStatus sends an event of each change of the login until it is done,
+//the first one being status or the change past the Last-Event-ID of a reconnection
+func streamLoginStatus(w http.ResponseWriter, r *http.Request, status logintxn.Status) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("content-type", "text/event-stream")
+	w.Header().Set("cache-control", "no-store")
+	//no buffering by a proxy in front
+	w.Header().Set("x-accel-buffering", "no")
+	ctx, cancel := context.WithTimeout(r.Context(), MAX_STATUS_STREAM)
+	defer cancel()
+
+	version := status.Version - 1
+	if v, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil {
+		version = v
+	}
+	for ctx.Err() == nil {
+		status, ok := logic.LoginTxns.Wait(ctx, status.ID, version)
+		if !ok || status.Version <= version {
+			return
+		}
+		data, _ := json.Marshal(&status)
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: status\ndata: %s\n\n", status.Version, data); err != nil {
+			logger.FromContext(r.Context()).Debugw("login status stream closed", "err", err)
+			return
+		}
+		flusher.Flush()
+		if status.Done {
+			return
+		}
+		version = status.Version
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+/*
+	runtime log level control, served on the admin listener
+
+	GET    /debug/loglevel                                           levels and rules in force
+	POST   /debug/loglevel?level=trace[&module=][&key=&value=][&ttl=] add or replace a rule
+	DELETE /debug/loglevel?[module=][&key=&value=]                   remove a rule, back to the default
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gityf/portalserver/internal/global"
+	"github.com/gityf/portalserver/portal"
+	logger "github.com/gityf/portalserver/xlog4go"
+)
+
+const (
+	LOG_RULE_TTL_DEFAULT = 10 * time.Minute
+	LOG_RULE_TTL_MAX     = 24 * time.Hour
+)
+
+//modules with their own logger
+var logModules = map[string]bool{
+	LOG_MODULE_HTTP:          true,
+	portal.LOG_MODULE_CLIENT: true,
+	portal.LOG_MODULE_CODEC:  true,
+	portal.LOG_MODULE_UDP:    true,
+}
+
+//fields a rule can filter on
+var logFilterKeys = map[string]bool{
+	"brasip": true,
+	"userip": true,
+}
+
+type logRuleView struct {
+	logger.LevelRule
+	Level string `json:"level"`
+}
+
+type logLevelView struct {
+	Level   string            `json:"level"`
+	Modules map[string]string `json:"modules"`
+	Rules   []logRuleView     `json:"rules"`
+}
+
+type logLevelResponse struct {
+	ErrNo  int           `json:"errno"`
+	ErrMsg string        `json:"errmsg"`
+	Data   *logLevelView `json:"data,omitempty"`
+}
+
+func LogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json; charset=utf-8")
+	r.ParseForm()
+
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		err = setLogRule(r)
+	case http.MethodDelete:
+		err = removeLogRule(r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		err = fmt.Errorf("method %v not allowed", r.Method)
+	}
+
+	resp := &logLevelResponse{ErrMsg: "ok"}
+	if err != nil {
+		resp.ErrNo = global.ERR_HTTP_PARSE_FAILED
+		resp.ErrMsg = err.Error()
+	} else {
+		resp.Data = currentLogLevels()
+	}
+	cnt, _ := json.Marshal(resp)
+	w.Write(cnt)
+}
+
+//rule of the request, Level and Expires left unset
+func logRuleScope(r *http.Request) (rule logger.LevelRule, err error) {
+	rule.Module = r.Form.Get("module")
+	rule.Key = r.Form.Get("key")
+	rule.Value = r.Form.Get("value")
+	if rule.Module != "" && !logModules[rule.Module] {
+		err = fmt.Errorf("unknown module %q", rule.Module)
+		return
+	}
+	if rule.Key != "" && !logFilterKeys[rule.Key] {
+		err = fmt.Errorf("unknown filter key %q, brasip or userip", rule.Key)
+		return
+	}
+	if (rule.Key == "") != (rule.Value == "") {
+		err = fmt.Errorf("key and value go together")
+	}
+	return
+}
+
+func setLogRule(r *http.Request) (err error) {
+	rule, err := logRuleScope(r)
+	if err != nil {
+		return
+	}
+	if rule.Level, err = logger.ParseLevel(r.Form.Get("level")); err != nil {
+		return
+	}
+	ttl := LOG_RULE_TTL_DEFAULT
+	if s := r.Form.Get("ttl"); s != "" {
+		var seconds int
+		if seconds, err = strconv.Atoi(s); err != nil || seconds <= 0 {
+			return fmt.Errorf("invalid ttl %q, seconds", s)
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+	if ttl > LOG_RULE_TTL_MAX {
+		ttl = LOG_RULE_TTL_MAX
+	}
+	rule.Expires = time.Now().Add(ttl)
+
+	logger.SetRule(rule)
+	logger.Warnw("log level rule set", "rule", rule.String(), "remote", r.RemoteAddr)
+	return
+}
+
+func removeLogRule(r *http.Request) (err error) {
+	rule, err := logRuleScope(r)
+	if err != nil {
+		return
+	}
+	if err = logger.RemoveRule(rule.Module, rule.Key, rule.Value); err != nil {
+		return
+	}
+	logger.Warnw("log level rule removed", "rule", rule.String(), "remote", r.RemoteAddr)
+	return
+}
+
+func currentLogLevels() *logLevelView {
+	view := &logLevelView{
+		Level:   logger.LevelName(logger.GetLevel()),
+		Modules: make(map[string]string),
+		Rules:   []logRuleView{},
+	}
+	for module, level := range logger.ModuleLevels() {
+		view.Modules[module] = logger.LevelName(level)
+	}
+	for _, rule := range logger.Rules() {
+		view.Rules = append(view.Rules, logRuleView{LevelRule: rule, Level: logger.LevelName(rule.Level)})
+	}
+	return view
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"github.com/gityf/portalserver/internal/config"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"runtime"
+	"runtime/debug"
+
+	logger "github.com/gityf/portalserver/xlog4go"
+	"github.com/gityf/portalserver/internal/global"
+	"github.com/gityf/portalserver/internal/logic"
+	"github.com/gityf/portalserver/internal/util"
+	"github.com/gityf/portalserver/portal"
+)
+
+func main() {
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	dirPath := path.Dir(os.Args[0])
+	logFile = dirPath + "/../" + logFile
+	confFile = dirPath + "/../" + confFile
+	fmt.Println("logFile:", logFile)
+	fmt.Println("confFile:", confFile)
+	var err error
+	if err = config.ParseConf(confFile); err != nil {
+		fmt.Printf("conf init fail: %s\n", err.Error())
+		return
+	}
+
+	// init log
+	if err = logger.SetupLogWithConf(logFile); err != nil {
+		fmt.Printf("log init fail: %s\n", err.Error())
+		return
+	}
+	defer logger.Close()
+
+	// set recover
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Error("abort, unknown error, errno:%d,errmsg:%v, stack:%s",
+				global.ERR_PANIC, err, string(debug.Stack()))
+		}
+	}()
+
+	fmt.Println(config.Cfg)
+	logger.Info("%v", config.Cfg)
+	setupFullDump()
+	logic.SetupCapture()
+	setupLanding()
+	setupStatic()
+	if err = logic.SetupHealth(); err != nil {
+		fmt.Printf("health init fail: %s\n", err.Error())
+		logger.Error("health init fail: %s", err.Error())
+		return
+	}
+	if err = logic.SetupJobs(); err != nil {
+		fmt.Printf("jobs init fail: %s\n", err.Error())
+		logger.Error("jobs init fail: %s", err.Error())
+		return
+	}
+	if err = logic.SetupPersist(); err != nil {
+		fmt.Printf("persist init fail: %s\n", err.Error())
+		logger.Error("persist init fail: %s", err.Error())
+		return
+	}
+	defer logic.ClosePersist()
+	go logic.ReplayAffAcks(portalServerCtx)
+	if config.Cfg.Persist.Reconcile {
+		go logic.Reconcile(portalServerCtx)
+	}
+	if err = logic.SetupSessionLimits(); err != nil {
+		fmt.Printf("session limits init fail: %s\n", err.Error())
+		logger.Error("session limits init fail: %s", err.Error())
+		return
+	}
+	go logic.SessionTimer.Run(portalServerCtx)
+	if err = logic.SetupWebhooks(); err != nil {
+		fmt.Printf("webhook init fail: %s\n", err.Error())
+		logger.Error("webhook init fail: %s", err.Error())
+		return
+	}
+	defer logic.CloseWebhooks()
+	//drained before the webhooks and the journal close
+	defer logic.DrainJobs()
+	logic.ScheduleJobs(portalServerCtx)
+	if err = logic.SetupAsyncLogin(); err != nil {
+		fmt.Printf("async login init fail: %s\n", err.Error())
+		logger.Error("async login init fail: %s", err.Error())
+		return
+	}
+	defer logic.CloseAsyncLogins()
+	if config.Cfg.Ntf.On {
+		go serveNtf()
+	}
+	defer logic.PacketCapture.Close()
+
+	//register signal proc
+	go signal_proc()
+
+	//start the admin listener: pprof, metrics, health, config, log levels and sessions
+	go serveAdmin()
+
+	// start http server
+
+	logger.Info("init Httpserver")
+
+	mux := http.NewServeMux()
+
+	for uri, handler := range uri2Handler {
+		mux.Handle(uri, handler)
+	}
+
+	tlsConfig, err := setupTLS()
+	if err != nil {
+		fmt.Printf("tls init fail: %s\n", err.Error())
+		logger.Error("tls init fail: %s", err.Error())
+		return
+	}
+	var httpHandler http.Handler = mux
+	if tlsConfig != nil {
+		if err = listenTLS(tlsConfig); err != nil {
+			logger.Error("tls listen fail: %s", err.Error())
+			return
+		}
+		defer portalTLSListener.Close()
+		go serveTLS(mux, tlsConfig)
+		if config.Cfg.TLS.RedirectHTTP {
+			httpHandler = redirectHTTPS(mux)
+		}
+	}
+
+	portalServerListener, err = net.Listen("tcp", ":"+util.ToString(config.Cfg.Port))
+	if err != nil {
+		logger.Error("tcp listen fail: %s", err.Error())
+		return
+	}
+	defer portalServerListener.Close()
+	fmt.Printf("portalServer starting ok at port:%v.\n", config.Cfg.Port)
+
+	httpServer = newHttpServer(httpHandler)
+	err = httpServer.Serve(portalServerListener)
+
+	logger.Error("http listen fail: %s", err.Error())
+
+	value := <-portalServerQuit
+	logger.Info("portalServer quit:%d", value)
+	fmt.Println("portalServer stopping...")
+}
+
+//newHttpServer serves handler with the requests under portalServerCtx
+func newHttpServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler: handler,
+		BaseContext: func(net.Listener) context.Context {
+			return portalServerCtx
+		},
+	}
+}
+
+//serveNtf answers the NTF_LOGOUT of the BAS until the shutdown
+func serveNtf() {
+	port := config.Cfg.Ntf.Port
+	if port == 0 {
+		port = portal.DEF_NTF_PORT
+	}
+	if err := logic.ServeNtf(portalServerCtx, ":"+util.ToString(port)); err != nil {
+		logger.Error("ntf listener fail: %s", err.Error())
+	}
+}
+
+//setupFullDump grants the full packet dumps asked by the config, the grant is audited in the wf log
+func setupFullDump() {
+	if !config.Cfg.FullDump.On {
+		portal.DisableFullDump()
+		return
+	}
+	grant, err := portal.EnableFullDump("config "+confFile, config.Cfg.FullDump.Reason)
+	if err != nil {
+		logger.Errorw("full packet dump refused, credentials stay redacted", "err", err)
+		return
+	}
+	logger.Warnw("FULL PACKET DUMP ENABLED, credentials are logged in clear",
+		"by", grant.By, "reason", grant.Reason, "since", grant.Since)
+}
@@ -0,0 +1,147 @@
+package main
+
+/*
+	captive portal pages, rendered by StaticResource from web/templates
+
+	/, /index.html, /login.html   login, userip/brasip/usermac from the BAS redirect url, see landing
+	/status.html                  session time and logout
+
+	the templates are parsed again when they change, operators brand them without a restart.
+	embedded templates never change
+*/
+
+import (
+	"bytes"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gityf/portalserver/internal/config"
+	"github.com/gityf/portalserver/internal/global"
+	"github.com/gityf/portalserver/internal/portalctx"
+	logger "github.com/gityf/portalserver/xlog4go"
+)
+
+const (
+	TEMPLATE_DIR    = "templates"
+	TEMPLATE_LAYOUT = "layout"
+	DEF_SITE_NAME   = "Portal"
+)
+
+//template of each page path
+var pagePaths = map[string]string{
+	"/":            "login",
+	"/index.html":  "login",
+	"/login.html":  "login",
+	"/status.html": "status",
+}
+
+//pageData is what the templates see
+type pageData struct {
+	Site      string
+	UserName  string
+	UserIP    string
+	BrasIP    string
+	UserMac   string
+	LogonTime int64    //unix seconds, 0 for now
+	ErrNo     int32    //USER_RET_ERR_* to show, from the errno parameter
+	ErrMsg    string   //USER_RET_DESC of ErrNo
+	Notice    string   //message other than an error
+	Errors    []string //USER_RET_DESC, for the errors of the api calls
+}
+
+type pageTemplate struct {
+	tmpl    *template.Template
+	modTime time.Time //latest modification of its files
+}
+
+var (
+	pagesMu sync.Mutex
+	pages   = make(map[string]*pageTemplate)
+)
+
+//loadPage returns the template of a page, parsed again when a file changed
+func loadPage(name string) (*template.Template, error) {
+	files := []string{
+		path.Join(TEMPLATE_DIR, TEMPLATE_LAYOUT+".html"),
+		path.Join(TEMPLATE_DIR, name+".html"),
+	}
+	var modTime time.Time
+	for _, file := range files {
+		info, err := fs.Stat(webFS, file)
+		if err != nil {
+			return nil, err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+
+	pagesMu.Lock()
+	defer pagesMu.Unlock()
+	if page := pages[name]; page != nil && page.modTime.Equal(modTime) {
+		return page.tmpl, nil
+	}
+	tmpl, err := template.ParseFS(webFS, files...)
+	if err != nil {
+		return nil, err
+	}
+	pages[name] = &pageTemplate{tmpl: tmpl, modTime: modTime}
+	return tmpl, nil
+}
+
+//newPageData takes the user and BAS of the landing of the request
+func newPageData(w http.ResponseWriter, r *http.Request) *pageData {
+	p := resolveLanding(w, r, true)
+	data := &pageData{
+		Site:     config.Cfg.SiteName,
+		UserName: r.Form.Get("username"),
+		UserIP:   p.UserIP,
+		BrasIP:   p.BrasIP,
+		UserMac:  p.UserMac,
+		Errors:   global.USER_RET_DESC,
+	}
+	if data.Site == "" {
+		data.Site = DEF_SITE_NAME
+	}
+	data.LogonTime, _ = strconv.ParseInt(r.Form.Get("logontime"), 10, 64)
+	if errno, err := strconv.ParseInt(r.Form.Get("errno"), 10, 32); err == nil && errno != global.USER_RET_ERR_OK {
+		data.ErrNo = int32(errno)
+		data.ErrMsg = global.GetUserRetDesc(data.ErrNo)
+	}
+	if r.Form.Get("loggedout") != "" {
+		data.Notice = "You are logged out."
+	}
+	return data
+}
+
+//renderPage writes the page of the path, ok is false when the path is no page
+func renderPage(w http.ResponseWriter, r *http.Request) (resp *portalctx.BaseResponse, ok bool) {
+	name, ok := pagePaths[r.URL.Path]
+	if !ok {
+		return
+	}
+	resp = portalctx.NewBaseResponse()
+	tmpl, err := loadPage(name)
+	var buf bytes.Buffer
+	if err == nil {
+		err = tmpl.ExecuteTemplate(&buf, TEMPLATE_LAYOUT, newPageData(w, r))
+	}
+	if err != nil {
+		logger.FromContext(r.Context()).Errorw("render page failed", "page", name, "err", err)
+		w.Header().Set("content-type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		resp.Errno = global.ERR_PANIC
+		resp.Errmsg = "page unavailable"
+		resp.ResponseJson(w)
+		return
+	}
+	w.Header().Set("content-type", "text/html; charset=utf-8")
+	w.Header().Set("cache-control", "no-store")
+	w.Write(buf.Bytes())
+	return
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRenderPages(t *testing.T) {
+	webFS = os.DirFS("../../web")
+	defer func() { webFS = os.DirFS(DEF_WEB_DIR) }()
+
+	for _, c := range []struct {
+		url  string
+		want []string
+	}{
+		{"/?userip=10.0.0.5&brasip=10.0.0.1&usermac=00:11:22:33:44:55", []string{`name="userip" value="10.0.0.5"`, `name="brasip" value="10.0.0.1"`, "login-form"}},
+		{"/login.html?userip=<script>&errno=15", []string{`name="userip" value=""`, "login refused"}},
+		{"/status.html?username=u%22&userip=10.0.0.5&logontime=1700000000", []string{`data-logontime="1700000000"`, "u&#34;", "logout-form"}},
+	} {
+		r := httptest.NewRequest("GET", c.url, nil)
+		r.ParseForm()
+		w := httptest.NewRecorder()
+		if _, ok := renderPage(w, r); !ok || w.Code != 200 {
+			t.Errorf("%v: code %v, body %v", c.url, w.Code, w.Body)
+			continue
+		}
+		body := w.Body.String()
+		for _, want := range c.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("%v: %q missing", c.url, want)
+			}
+		}
+		if !strings.Contains(body, `var USER_RET_DESC = ["success",`) {
+			t.Errorf("%v: USER_RET_DESC missing", c.url)
+		}
+	}
+
+	//the landing of the BAS redirect is kept for the session
+	r := httptest.NewRequest("GET", "/?wlanuserip=10.0.0.7&wlanacip=10.0.0.1&usermac=00-11-22-33-44-55", nil)
+	r.ParseForm()
+	w := httptest.NewRecorder()
+	renderPage(w, r)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !strings.Contains(w.Body.String(), `name="usermac" value="00:11:22:33:44:55"`) {
+		t.Fatalf("landing not kept, cookies %v", cookies)
+	}
+	r = httptest.NewRequest("GET", "/status.html", nil)
+	r.AddCookie(cookies[0])
+	r.ParseForm()
+	w = httptest.NewRecorder()
+	renderPage(w, r)
+	if body := w.Body.String(); !strings.Contains(body, `name="userip" value="10.0.0.7"`) || !strings.Contains(body, `name="brasip" value="10.0.0.1"`) {
+		t.Errorf("landing of the session not used")
+	}
+
+	r = httptest.NewRequest("GET", "/css/portal.css", nil)
+	if _, ok := renderPage(httptest.NewRecorder(), r); ok {
+		t.Errorf("css rendered as a page")
+	}
+}
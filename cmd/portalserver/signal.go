@@ -4,7 +4,7 @@ package main
    中断信号的捕获函数
 */
 import (
-	logger "github.com/xlog4go"
+	logger "github.com/gityf/portalserver/xlog4go"
 	"os"
 	"os/signal"
 	"syscall"
@@ -14,14 +14,25 @@ func signal_proc() {
 
 	c := make(chan os.Signal, 1)
 
-	signal.Notify(c, syscall.SIGINT, syscall.SIGALRM, syscall.SIGTERM, syscall.SIGUSR1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGALRM, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGHUP)
 
 	// Block until a signal is received.
 	sig := <-c
+	for sig == syscall.SIGHUP {
+		logger.Warn("Signal received: %v, reload the tls certificate", sig)
+		reloadTLS()
+		sig = <-c
+	}
 
 	logger.Warn("Signal received: %v", sig)
 
 	portalServerListener.Close()
+	if portalTLSListener != nil {
+		portalTLSListener.Close()
+	}
+
+	//stop the BAS exchanges still in flight
+	portalServerCancel()
 
 	for _, handler := range uri2Handler {
 		handler.Close()
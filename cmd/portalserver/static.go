@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/gityf/portalserver/internal/config"
+	"github.com/gityf/portalserver/internal/static"
+	"github.com/gityf/portalserver/web"
+	logger "github.com/gityf/portalserver/xlog4go"
+)
+
+const DEF_WEB_DIR = "web"
+
+var (
+	//root of the assets and templates, see setupStatic
+	webFS        fs.FS = os.DirFS(DEF_WEB_DIR)
+	staticServer       = newStaticServer()
+)
+
+func newStaticServer() *static.Server {
+	sc := config.Cfg.Static
+	return static.New(webFS, static.Options{
+		Gzip:        sc.Gzip,
+		MaxAge:      time.Duration(sc.MaxAge) * time.Second,
+		SPAFallback: sc.SPAFallback,
+		Deny:        []string{TEMPLATE_DIR},
+	})
+}
+
+//setupStatic serves the assets of config.Cfg.Static, from the directory or the binary
+func setupStatic() {
+	sc := config.Cfg.Static
+	if sc.Embedded {
+		webFS = web.FS
+		logger.Info("static assets embedded in the binary")
+	} else {
+		dir := sc.Dir
+		if dir == "" {
+			dir = DEF_WEB_DIR
+		}
+		webFS = os.DirFS(dir)
+		logger.Info("static assets from %v", dir)
+	}
+	staticServer = newStaticServer()
+}
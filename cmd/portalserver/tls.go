@@ -0,0 +1,112 @@
+package main
+
+/*
+	https listener, with the routes of the http one
+
+	the certificate is loaded again when its files change or on SIGHUP
+*/
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gityf/portalserver/internal/config"
+	"github.com/gityf/portalserver/internal/tlscert"
+	"github.com/gityf/portalserver/internal/util"
+	logger "github.com/gityf/portalserver/xlog4go"
+)
+
+const DEF_TLS_PORT = 443
+
+var (
+	certReloader      *tlscert.Reloader
+	portalTLSListener net.Listener
+)
+
+//setupTLS loads the certificate of config.Cfg.TLS, nothing is done when tls is off
+func setupTLS() (tlsConfig *tls.Config, err error) {
+	tc := config.Cfg.TLS
+	if !tc.On {
+		return
+	}
+	minVersion, err := tlscert.ParseVersion(tc.MinVersion)
+	if err != nil {
+		return
+	}
+	if certReloader, err = tlscert.NewReloader(tc.CertFile, tc.KeyFile); err != nil {
+		return
+	}
+	go certReloader.Watch(portalServerCtx, time.Duration(tc.CheckInterval)*time.Second)
+	tlsConfig = certReloader.TLSConfig(minVersion)
+	return
+}
+
+//reloadTLS loads the certificate again, on SIGHUP
+func reloadTLS() {
+	if certReloader == nil {
+		return
+	}
+	if err := certReloader.Reload(); err != nil {
+		logger.Errorw("tls certificate reload failed, the previous one stays in force", "err", err)
+	}
+}
+
+func tlsPort() int {
+	if config.Cfg.TLS.Port == 0 {
+		return DEF_TLS_PORT
+	}
+	return config.Cfg.TLS.Port
+}
+
+//listenTLS opens the https port, served by serveTLS
+func listenTLS(tlsConfig *tls.Config) error {
+	ln, err := net.Listen("tcp", ":"+util.ToString(tlsPort()))
+	if err != nil {
+		return err
+	}
+	portalTLSListener = tls.NewListener(ln, tlsConfig)
+	return nil
+}
+
+//serveTLS serves handler on the https port until the listener is closed
+func serveTLS(handler http.Handler, tlsConfig *tls.Config) {
+	logger.Info("portalServer https at port:%v", tlsPort())
+	server := newHttpServer(handler)
+	server.TLSConfig = tlsConfig
+	if err := server.Serve(portalTLSListener); err != nil {
+		logger.Error("https listen fail: %s", err.Error())
+	}
+}
+
+//redirectHTTPS sends the requests of the http listener to the same url on https,
+//the api keeps /ping and the probes for the plain health checks
+func redirectHTTPS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ping" || r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.Trim(host, "[]")
+		}
+		if port := tlsPort(); port != DEF_TLS_PORT {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		//temporary, the browsers must not remember it when https is switched off
+		code := http.StatusFound
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			code = http.StatusTemporaryRedirect
+		}
+		http.Redirect(w, r, target, code)
+	})
+}
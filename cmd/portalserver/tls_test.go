@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gityf/portalserver/internal/config"
+)
+
+func TestRedirectHTTPS(t *testing.T) {
+	defer func(tc config.TLSConfig) { config.Cfg.TLS = tc }(config.Cfg.TLS)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, c := range []struct {
+		port           int
+		method, target string
+		code           int
+		location       string
+	}{
+		{8443, "GET", "http://portal.example:8080/login.html?wlanuserip=10.0.0.2", http.StatusFound, "https://portal.example:8443/login.html?wlanuserip=10.0.0.2"},
+		{443, "POST", "http://portal.example/portalserver/login", http.StatusTemporaryRedirect, "https://portal.example/portalserver/login"},
+		{443, "GET", "http://[fe80::1]:8080/", http.StatusFound, "https://[fe80::1]/"},
+		{443, "GET", "http://portal.example/ping", http.StatusOK, ""},
+	} {
+		config.Cfg.TLS.Port = c.port
+		w := httptest.NewRecorder()
+		redirectHTTPS(next).ServeHTTP(w, httptest.NewRequest(c.method, c.target, nil))
+		if w.Code != c.code || w.Header().Get("Location") != c.location {
+			t.Errorf("%v %v: %v %v", c.method, c.target, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
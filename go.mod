@@ -0,0 +1,3 @@
+module github.com/gityf/portalserver
+
+go 1.21
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"io/ioutil"
+	"encoding/json"
+	logger "github.com/gityf/portalserver/xlog4go"
+)
+
+type PortalServerConfig struct {
+	Port          int               `json:"port"`
+	PprofPort     int               `json:"profport"`
+	SharedSecret  string            `json:"secret"`
+	AuthType      string            `json:"auth_type"`
+	AffAckAuth    bool              `json:"aff_ack_auth"` //answer each ACK_AUTH by AFF_ACK_AUTH
+	RetryTime     int               `json:"retry"`
+	Timeout       int               `json:"timeout"`
+	BrasPort      int               `json:"bras_port"`
+	BrasIP        string            `json:"bras_ip"`
+	PortalVersion int               `json:"portal_version"`
+	Retry         RetryPolicyConfig `json:"retry_policy"`
+	FullDump      FullDumpConfig    `json:"full_packet_dump"`
+	Capture       CaptureConfig     `json:"capture"`
+	SiteName      string            `json:"site_name"` //shown by the portal pages
+	Landing       LandingConfig     `json:"landing"`
+	Static        StaticConfig      `json:"static"`
+	TLS           TLSConfig         `json:"tls"`
+	Admin         AdminConfig       `json:"admin"`
+	Health        HealthConfig      `json:"health"`
+	Breaker       BreakerConfig     `json:"circuit_breaker"`
+	BrasBackups   BrasBackupsConfig `json:"bras_backups"`
+	Persist       PersistConfig     `json:"persist"`
+	Limits        LimitsConfig      `json:"session_limits"`
+	Webhook       WebhookConfig     `json:"webhook"`
+	Ntf           NtfConfig         `json:"ntf"`
+	Jobs          JobsConfig        `json:"jobs"`
+	AsyncLogin    AsyncLoginConfig  `json:"async_login"`
+}
+
+//logins of async=1, run in the background and followed on /portalserver/login/status
+type AsyncLoginConfig struct {
+	TTL        int `json:"ttl"`         //seconds the result of a login is kept, 300 when 0
+	MaxPending int `json:"max_pending"` //logins running at once, the next ones refused, 10000 when 0
+}
+
+//background work: deferred logouts, serial flushes, webhook deliveries and BAS probes
+type JobsConfig struct {
+	Workers      int `json:"workers"`       //jobs running at once, 8 when 0
+	QueueSize    int `json:"queue_size"`    //jobs waiting for a worker, 10000 when 0
+	MaxAttempts  int `json:"max_attempts"`  //of a job without its own, 3 when 0
+	DrainTimeout int `json:"drain_timeout"` //seconds the shutdown waits for the jobs queued, 10 when 0
+}
+
+//listener of the NTF_LOGOUT the BAS sends when it logs a user out
+type NtfConfig struct {
+	On   bool `json:"on"`
+	Port int  `json:"port"` //udp, 50100 when 0
+}
+
+//events of the sessions POSTed to a receiver, off when the url is empty
+type WebhookConfig struct {
+	URL          string   `json:"url"`
+	Secret       string   `json:"secret"`        //key of the HMAC-SHA256 X-Portal-Signature, unsigned when empty
+	Events       []string `json:"events"`        //login, login_failed, logout, ntf_logout and kick, all when empty
+	Dir          string   `json:"dir"`           //backlog and dead letters, in memory only when empty
+	Timeout      int      `json:"timeout"`       //ms of one POST, 5000 when 0
+	MaxAttempts  int      `json:"max_attempts"`  //before an event goes to the dead letters, 8 when 0
+	MaxBacklog   int      `json:"max_backlog"`   //events not delivered yet, 100000 when 0
+	SyncInterval int      `json:"sync_interval"` //ms between two fsync of the backlog, 1000 when 0, every record when -1
+}
+
+//maximum duration and idle timeout of the sessions, by group of users
+type LimitsConfig struct {
+	Interval int                `json:"interval"` //seconds between two checks, 60 when 0
+	Groups   []LimitGroupConfig `json:"groups"`   //the first group matching a login applies
+}
+
+//LimitGroupConfig matches the logins by user name, ssid and BAS, every login when all are empty
+type LimitGroupConfig struct {
+	Name        string   `json:"name"`
+	UserNames   []string `json:"usernames"` //patterns of path.Match, as guest-*
+	SSIDs       []string `json:"ssids"`
+	BrasIPs     []string `json:"bras_ips"`
+	MaxDuration int      `json:"max_duration"` //seconds, no limit when 0
+	IdleTimeout int      `json:"idle_timeout"` //seconds, no limit when 0, judged by REQ_INFO
+	IdleBytes   int64    `json:"idle_bytes"`   //flux between two checks still idle
+}
+
+//sessions, serial counters and pending transactions kept across restarts
+type PersistConfig struct {
+	Dir          string `json:"dir"`           //directory of the snapshot and log, persistence off when empty
+	CompactEvery int    `json:"compact_every"` //log records between two snapshots, 10000 when 0
+	SyncInterval int    `json:"sync_interval"` //ms between two fsync of the log, 1000 when 0, every record when < 0
+	Reconcile    bool   `json:"reconcile"`     //check the restored state against the BAS by REQ_INFO
+}
+
+//standby addresses by BAS ip, tried in order when the breaker of the ones before is open
+type BrasBackupsConfig map[string][]string
+
+//circuit breaker of each BAS address, failing fast once it stops answering
+type BreakerConfig struct {
+	Off       bool `json:"off"`
+	Threshold int  `json:"threshold"` //consecutive requests without ack opening the breaker, 5 when 0
+	Cooldown  int  `json:"cooldown"`  //seconds before a request probes the BAS again, 30 when 0
+}
+
+//periodic probes of the BAS by REQ_INFO, behind the readiness
+type HealthConfig struct {
+	Interval      int      `json:"interval"`       //seconds between two rounds, 30 when 0
+	Timeout       int      `json:"timeout"`        //ms of one probe, 5000 when 0
+	FailThreshold int      `json:"fail_threshold"` //consecutive failures making a BAS down, 3 when 0
+	ProbeIP       string   `json:"probe_ip"`       //sentinel user ip of the REQ_INFO, 192.0.2.1 when empty
+	BrasIPs       []string `json:"bras_ips"`       //BAS probed, bras_ip when empty
+}
+
+//admin listener of pprof, metrics, health, config, log levels and sessions
+type AdminConfig struct {
+	Addr     string `json:"addr"` //host:port, 127.0.0.1:<profport> when empty
+	User     string `json:"user"` //basic auth, none when empty
+	Password string `json:"password"`
+}
+
+//https listener of the portal, sharing the routes of the http one
+type TLSConfig struct {
+	On            bool   `json:"on"`
+	Port          int    `json:"port"`
+	CertFile      string `json:"cert_file"`
+	KeyFile       string `json:"key_file"`
+	MinVersion    string `json:"min_version"`    //1.0 to 1.3, 1.2 when empty
+	RedirectHTTP  bool   `json:"redirect_http"`  //send the browsers of the http listener to https
+	CheckInterval int    `json:"check_interval"` //seconds between the checks of the cert files, 10 when 0
+}
+
+//assets and pages of the portal
+type StaticConfig struct {
+	Dir         string `json:"dir"`          //root of the assets and templates, web when empty
+	Embedded    bool   `json:"embedded"`     //serve the files embedded in the binary, Dir unused
+	Gzip        bool   `json:"gzip"`         //compress the text assets
+	MaxAge      int    `json:"max_age"`      //seconds the browsers cache the assets, 0 for no-cache
+	SPAFallback string `json:"spa_fallback"` //file served for the unknown page paths, none when empty
+}
+
+//parameters of the BAS redirect urls, kept for the browser session
+type LandingConfig struct {
+	SessionTTL int             `json:"session_ttl"` //seconds a landing is kept after its last use
+	Vendors    []VendorMapping `json:"vendors"`     //tried in order, built-in mappings when empty
+}
+
+//VendorMapping names the redirect url parameters of one BAS vendor,
+//Params is keyed by userip, brasip, usermac, acname and ssid, each with the names tried in order
+type VendorMapping struct {
+	Name   string              `json:"name"`
+	Params map[string][]string `json:"params"`
+}
+
+//audited opt-in to log packets and secrets in clear, for protocol debugging only
+type FullDumpConfig struct {
+	On     bool   `json:"on"`
+	Reason string `json:"reason"` //required when on, written to the logs with every full dump
+}
+
+//pcap capture of the BAS traffic, switchable at runtime on the admin listener
+type CaptureConfig struct {
+	On        bool     `json:"on"`
+	Dir       string   `json:"dir"`         //directory of the pcap files
+	MaxSizeMB int      `json:"max_size_mb"` //rotate past this size
+	MaxFiles  int      `json:"max_files"`   //files kept
+	BrasIPs   []string `json:"bras_ips"`    //only the traffic of these BAS, every BAS when empty
+}
+
+//Masked returns a copy of the config with the shared secret and passwords masked
+func (c PortalServerConfig) Masked() PortalServerConfig {
+	if c.SharedSecret != "" {
+		c.SharedSecret = logger.REDACTED
+	}
+	if c.Admin.Password != "" {
+		c.Admin.Password = logger.REDACTED
+	}
+	if c.Webhook.Secret != "" {
+		c.Webhook.Secret = logger.REDACTED
+	}
+	return c
+}
+
+//String returns the config fit for the logs, the secrets masked
+func (c PortalServerConfig) String() string {
+	cnt, _ := json.Marshal(c.Masked())
+	return string(cnt)
+}
+
+//retry policy of one request/ack exchange, all durations are in ms
+type RetryPolicyConfig struct {
+	StepTimeout             map[string]int `json:"step_timeout"` //keyed by REQ_CHALLENGE, REQ_AUTH, ...
+	BackoffBase             int            `json:"backoff_base"`
+	BackoffMax              int            `json:"backoff_max"`
+	Jitter                  float64        `json:"jitter"` //0.0 ~ 1.0 of the backoff
+	Deadline                int            `json:"deadline"`
+	RetryOnBadAuthenticator bool           `json:"retry_bad_authenticator"`
+}
+
+var Cfg PortalServerConfig
+
+var loaded bool
+
+func ParseConf(file string) (err error) {
+	cnt, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(cnt, &Cfg);
+	loaded = err == nil
+	return
+}
+
+//Loaded tells whether Cfg was parsed from a file
+func Loaded() bool {
+	return loaded
+}
\ No newline at end of file
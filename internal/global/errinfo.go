@@ -3,7 +3,9 @@ package global
 const (
 	ERR_JSON_MARSHAL_FAILED = 400
 	ERR_HTTP_PARSE_FAILED = 401
+	ERR_NOT_FOUND = 404
 	ERR_PANIC = 500
+	ERR_BUSY = 503
 )
 
 const (
@@ -0,0 +1,214 @@
+package health
+
+/*
+	readiness of the server: checks of its own state and periodic probes of the BAS
+*/
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DEF_INTERVAL       = 30 * time.Second
+	DEF_TIMEOUT        = 5 * time.Second
+	DEF_FAIL_THRESHOLD = 3
+)
+
+//Options of a Checker
+type Options struct {
+	BrasIPs       []string                                       //BAS probed
+	Probe         func(ctx context.Context, brasIP string) error //nil error when the BAS answered a verified ack
+	Interval      time.Duration                                  //between two rounds of probes, DEF_INTERVAL when 0
+	Timeout       time.Duration                                  //of one probe, DEF_TIMEOUT when 0
+	FailThreshold int                                            //consecutive failures making a BAS down, DEF_FAIL_THRESHOLD when 0
+}
+
+//BasStatus of one BAS, as the last probes found it
+type BasStatus struct {
+	BrasIP              string    `json:"brasip"`
+	Up                  bool      `json:"up"`
+	Checked             bool      `json:"checked"` //probed at least once
+	LastCheck           time.Time `json:"last_check"`
+	LastSuccess         time.Time `json:"last_success"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastError           string    `json:"last_error,omitempty"`
+	Latency             string    `json:"latency,omitempty"` //of the last successful probe
+}
+
+//CheckStatus of one check of the server itself
+type CheckStatus struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+//Report of the readiness, Ready when every check passes and a BAS is up
+type Report struct {
+	Ready  bool          `json:"ready"`
+	Checks []CheckStatus `json:"checks"`
+	Bas    []BasStatus   `json:"bas"`
+}
+
+type check struct {
+	name string
+	f    func() error
+}
+
+//Checker probes the BAS every interval and keeps their status
+type Checker struct {
+	opts Options
+
+	mu     sync.RWMutex
+	checks []check
+	bas    map[string]*BasStatus
+}
+
+func NewChecker(opts Options) *Checker {
+	if opts.Interval <= 0 {
+		opts.Interval = DEF_INTERVAL
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DEF_TIMEOUT
+	}
+	if opts.FailThreshold <= 0 {
+		opts.FailThreshold = DEF_FAIL_THRESHOLD
+	}
+	c := &Checker{opts: opts, bas: make(map[string]*BasStatus)}
+	for _, ip := range opts.BrasIPs {
+		//up until the probes say otherwise, a restart does not wait for a round
+		c.bas[ip] = &BasStatus{BrasIP: ip, Up: true}
+	}
+	return c
+}
+
+//AddCheck adds a check of the server itself, f returns why it is not ready
+func (c *Checker) AddCheck(name string, f func() error) {
+	c.mu.Lock()
+	c.checks = append(c.checks, check{name, f})
+	c.mu.Unlock()
+}
+
+//Run probes the BAS now and every interval until ctx is done
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.opts.Interval)
+	defer ticker.Stop()
+	for {
+		c.ProbeAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//ProbeAll probes every BAS concurrently and waits for the results
+func (c *Checker) ProbeAll(ctx context.Context) {
+	if c.opts.Probe == nil {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, ip := range c.opts.BrasIPs {
+		wg.Add(1)
+		go func(ip string) {
+			defer wg.Done()
+			c.Probe(ctx, ip)
+		}(ip)
+	}
+	wg.Wait()
+}
+
+//Probe probes one BAS of the options and records its status, the error is the one of the probe
+func (c *Checker) Probe(parent context.Context, brasIP string) (err error) {
+	if c.opts.Probe == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(parent, c.opts.Timeout)
+	defer cancel()
+	begin := time.Now()
+	err = c.opts.Probe(ctx, brasIP)
+	if err != nil && parent.Err() != nil {
+		//canceled on shutdown, not a failure of the BAS
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.bas[brasIP]
+	if !ok {
+		return
+	}
+	s.Checked = true
+	s.LastCheck = time.Now()
+	if err != nil {
+		s.ConsecutiveFailures++
+		s.LastError = err.Error()
+		if s.ConsecutiveFailures >= c.opts.FailThreshold {
+			s.Up = false
+		}
+		return
+	}
+	s.Up = true
+	s.ConsecutiveFailures = 0
+	s.LastError = ""
+	s.LastSuccess = s.LastCheck
+	s.Latency = s.LastCheck.Sub(begin).Round(time.Millisecond).String()
+	return
+}
+
+//BrasIPs returns the BAS probed
+func (c *Checker) BrasIPs() []string {
+	return c.opts.BrasIPs
+}
+
+//Interval returns the time between two rounds of probes
+func (c *Checker) Interval() time.Duration {
+	return c.opts.Interval
+}
+
+//Status returns the status of every BAS, sorted by ip
+func (c *Checker) Status() []BasStatus {
+	c.mu.RLock()
+	list := make([]BasStatus, 0, len(c.bas))
+	for _, s := range c.bas {
+		list = append(list, *s)
+	}
+	c.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].BrasIP < list[j].BrasIP })
+	return list
+}
+
+//BasUp tells whether the probes found the BAS up, an unprobed BAS is up
+func (c *Checker) BasUp(brasIP string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	s, ok := c.bas[brasIP]
+	return !ok || s.Up
+}
+
+//Report runs the checks and returns them with the status of the BAS
+func (c *Checker) Report() *Report {
+	c.mu.RLock()
+	checks := append([]check(nil), c.checks...)
+	c.mu.RUnlock()
+
+	r := &Report{Ready: true, Checks: []CheckStatus{}, Bas: c.Status()}
+	for _, ck := range checks {
+		cs := CheckStatus{Name: ck.name, OK: true}
+		if err := ck.f(); err != nil {
+			cs.OK, cs.Error = false, err.Error()
+			r.Ready = false
+		}
+		r.Checks = append(r.Checks, cs)
+	}
+	//ready while a BAS can take the logins
+	up := len(r.Bas) == 0
+	for _, s := range r.Bas {
+		up = up || s.Up
+	}
+	r.Ready = r.Ready && up
+	return r
+}
@@ -0,0 +1,69 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestChecker(t *testing.T) {
+	failing := map[string]bool{"10.0.0.2": true}
+	c := NewChecker(Options{
+		BrasIPs:       []string{"10.0.0.1", "10.0.0.2"},
+		FailThreshold: 2,
+		Probe: func(ctx context.Context, brasIP string) error {
+			if failing[brasIP] {
+				return errors.New("ack timeout")
+			}
+			return nil
+		},
+	})
+	var logWriter error
+	c.AddCheck("logger", func() error { return logWriter })
+
+	if r := c.Report(); !r.Ready || !c.BasUp("10.0.0.2") || r.Bas[1].Checked {
+		t.Fatalf("not ready before the probes: %+v", r)
+	}
+	c.ProbeAll(context.Background())
+	if !c.BasUp("10.0.0.2") {
+		t.Errorf("down below the threshold")
+	}
+	c.ProbeAll(context.Background())
+	status := c.Status()
+	if c.BasUp("10.0.0.2") || status[1].ConsecutiveFailures != 2 || status[1].LastError != "ack timeout" {
+		t.Errorf("not down at the threshold: %+v", status[1])
+	}
+	if !status[0].Up || status[0].LastSuccess.IsZero() || !c.Report().Ready {
+		t.Errorf("ready with one BAS up: %+v", status[0])
+	}
+
+	failing["10.0.0.1"] = true
+	c.ProbeAll(context.Background())
+	c.ProbeAll(context.Background())
+	if c.Report().Ready {
+		t.Errorf("ready with every BAS down")
+	}
+	failing["10.0.0.1"], failing["10.0.0.2"] = false, false
+	c.ProbeAll(context.Background())
+	if r := c.Report(); !r.Ready || r.Bas[1].ConsecutiveFailures != 0 {
+		t.Errorf("not recovered: %+v", r)
+	}
+
+	logWriter = errors.New("disk full")
+	if r := c.Report(); r.Ready || r.Checks[0].OK || r.Checks[0].Error != "disk full" {
+		t.Errorf("ready with a failed check: %+v", r.Checks)
+	}
+}
+
+func TestCanceledProbe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := NewChecker(Options{BrasIPs: []string{"10.0.0.1"}, FailThreshold: 1,
+		Probe: func(ctx context.Context, brasIP string) error {
+			cancel()
+			return ctx.Err()
+		}})
+	c.ProbeAll(ctx)
+	if s := c.Status()[0]; !s.Up || s.Checked {
+		t.Errorf("shutdown counted as a failure: %+v", s)
+	}
+}
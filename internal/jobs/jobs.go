@@ -0,0 +1,400 @@
+package jobs
+
+/*
+	background work off the http path: a bounded queue served by a pool of workers,
+	retries with backoff and a drain on shutdown
+
+	a job may also implement
+		Key() string                        at most one job of a key queued, waiting or running
+		MaxAttempts() int                   instead of Options.MaxAttempts
+		Backoff(attempts int) time.Duration before the retry following the attempts made
+		Finish(err error)                   called once: nil, the last error or ErrAbandoned
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DEF_WORKERS      = 8
+	DEF_QUEUE_SIZE   = 10000
+	DEF_MAX_ATTEMPTS = 3
+	DEF_BACKOFF      = time.Second
+	DEF_MAX_BACKOFF  = 5 * time.Minute
+	DEF_TIMEOUT      = 30 * time.Second
+)
+
+//results given to Options.OnDone
+const (
+	RESULT_OK        = "ok"
+	RESULT_RETRY     = "retry"     //failed, run again after the backoff
+	RESULT_FAILED    = "failed"    //failed for the last time
+	RESULT_ABANDONED = "abandoned" //not run or retried because of the shutdown
+	RESULT_REJECTED  = "rejected"  //not queued by Every, the queue full
+)
+
+var (
+	ErrQueueFull = errors.New("job queue full")
+	ErrClosed    = errors.New("job queue closed")
+	ErrDuplicate = errors.New("job of the same key pending")
+	ErrAbandoned = errors.New("job abandoned on shutdown")
+)
+
+//Job is a unit of background work
+type Job interface {
+	Type() string //label of the metrics and logs
+	Run(ctx context.Context) error
+}
+
+type keyed interface {
+	Key() string
+}
+
+type retrier interface {
+	MaxAttempts() int
+}
+
+type backoffer interface {
+	Backoff(attempts int) time.Duration
+}
+
+type finisher interface {
+	Finish(err error)
+}
+
+//Func is a Job of a function
+type Func struct {
+	Name string
+	F    func(ctx context.Context) error
+}
+
+func (f Func) Type() string {
+	return f.Name
+}
+
+func (f Func) Run(ctx context.Context) error {
+	return f.F(ctx)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (p *permanentError) Error() string {
+	return p.err.Error()
+}
+
+func (p *permanentError) Unwrap() error {
+	return p.err
+}
+
+//Permanent marks an error not worth a retry
+func Permanent(err error) error {
+	return &permanentError{err}
+}
+
+//Options of a Queue
+type Options struct {
+	Workers     int           //DEF_WORKERS when 0
+	QueueSize   int           //jobs ready and not running, DEF_QUEUE_SIZE when 0
+	MaxAttempts int           //of a job, DEF_MAX_ATTEMPTS when 0
+	Backoff     time.Duration //before the first retry, doubled after each, DEF_BACKOFF when 0
+	MaxBackoff  time.Duration //DEF_MAX_BACKOFF when 0
+	Timeout     time.Duration //of one run, DEF_TIMEOUT when 0
+	OnDone      func(job Job, result string, err error, cost time.Duration)
+}
+
+type task struct {
+	job         Job
+	key         string
+	attempts    int
+	maxAttempts int
+}
+
+//Queue runs the jobs submitted on its workers
+type Queue struct {
+	opts   Options
+	ctx    context.Context //canceled when the drain times out
+	cancel context.CancelFunc
+	ready  chan *task
+	busy   int32
+	wg     sync.WaitGroup //workers
+	active sync.WaitGroup //tasks ready or running
+
+	mu      sync.Mutex
+	closed  bool
+	keys    map[string]bool
+	delayed map[*task]*time.Timer //waiting for a delay or a retry
+}
+
+//NewQueue starts the workers
+func NewQueue(opts Options) *Queue {
+	if opts.Workers <= 0 {
+		opts.Workers = DEF_WORKERS
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DEF_QUEUE_SIZE
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DEF_MAX_ATTEMPTS
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DEF_BACKOFF
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DEF_MAX_BACKOFF
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DEF_TIMEOUT
+	}
+	q := &Queue{
+		opts:    opts,
+		ready:   make(chan *task, opts.QueueSize),
+		keys:    make(map[string]bool),
+		delayed: make(map[*task]*time.Timer),
+	}
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	for i := 0; i < opts.Workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+//Submit queues job, it never waits
+func (q *Queue) Submit(job Job) error {
+	return q.SubmitAfter(job, 0)
+}
+
+//SubmitAfter queues job once delay is over
+func (q *Queue) SubmitAfter(job Job, delay time.Duration) error {
+	t := &task{job: job, maxAttempts: q.opts.MaxAttempts}
+	if k, ok := job.(keyed); ok {
+		t.key = k.Key()
+	}
+	if r, ok := job.(retrier); ok && r.MaxAttempts() > 0 {
+		t.maxAttempts = r.MaxAttempts()
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	if t.key != "" && q.keys[t.key] {
+		return ErrDuplicate
+	}
+	if delay > 0 {
+		q.delay(t, delay)
+	} else if !q.push(t) {
+		return ErrQueueFull
+	}
+	if t.key != "" {
+		q.keys[t.key] = true
+	}
+	return nil
+}
+
+//Every submits a job of newJob now and every interval until ctx is done or the queue closed,
+//none while the one before is pending when the jobs have a key
+func (q *Queue) Every(ctx context.Context, interval time.Duration, newJob func() Job) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		job := newJob()
+		switch err := q.Submit(job); err {
+		case ErrClosed:
+			return
+		case ErrQueueFull:
+			q.report(job, RESULT_REJECTED, err, 0)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//push makes t ready, the caller holds q.mu
+func (q *Queue) push(t *task) bool {
+	select {
+	case q.ready <- t:
+		q.active.Add(1)
+		return true
+	default:
+		return false
+	}
+}
+
+//delay makes t ready after d, the caller holds q.mu
+func (q *Queue) delay(t *task, d time.Duration) {
+	q.delayed[t] = time.AfterFunc(d, func() {
+		q.mu.Lock()
+		if _, ok := q.delayed[t]; !ok {
+			//stopped by the drain
+			q.mu.Unlock()
+			return
+		}
+		delete(q.delayed, t)
+		if !q.push(t) {
+			//full, wait another backoff
+			q.delay(t, q.backoff(t))
+		}
+		q.mu.Unlock()
+	})
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for t := range q.ready {
+		if q.ctx.Err() != nil {
+			q.finish(t, RESULT_ABANDONED, ErrAbandoned, 0)
+		} else {
+			q.run(t)
+		}
+		q.active.Done()
+	}
+}
+
+func (q *Queue) run(t *task) {
+	atomic.AddInt32(&q.busy, 1)
+	ctx, cancel := context.WithTimeout(q.ctx, q.opts.Timeout)
+	begin := time.Now()
+	err := runSafe(ctx, t.job)
+	cost := time.Since(begin)
+	cancel()
+	atomic.AddInt32(&q.busy, -1)
+	t.attempts++
+
+	var perm *permanentError
+	if err == nil {
+		q.finish(t, RESULT_OK, nil, cost)
+		return
+	}
+	if errors.As(err, &perm) || t.attempts >= t.maxAttempts {
+		q.finish(t, RESULT_FAILED, err, cost)
+		return
+	}
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		q.finish(t, RESULT_ABANDONED, err, cost)
+		return
+	}
+	q.delay(t, q.backoff(t))
+	q.mu.Unlock()
+	q.report(t.job, RESULT_RETRY, err, cost)
+}
+
+//runSafe runs job, a panic is its error
+func runSafe(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = Permanent(fmt.Errorf("job %v panic: %v", job.Type(), r))
+		}
+	}()
+	return job.Run(ctx)
+}
+
+//finish forgets t and tells its job
+func (q *Queue) finish(t *task, result string, err error, cost time.Duration) {
+	if t.key != "" {
+		q.mu.Lock()
+		delete(q.keys, t.key)
+		q.mu.Unlock()
+	}
+	q.report(t.job, result, err, cost)
+	if f, ok := t.job.(finisher); ok {
+		if result == RESULT_ABANDONED {
+			err = ErrAbandoned
+		}
+		f.Finish(err)
+	}
+}
+
+func (q *Queue) report(job Job, result string, err error, cost time.Duration) {
+	if q.opts.OnDone != nil {
+		q.opts.OnDone(job, result, err, cost)
+	}
+}
+
+//backoff before the retry of t
+func (q *Queue) backoff(t *task) time.Duration {
+	if b, ok := t.job.(backoffer); ok {
+		return b.Backoff(t.attempts)
+	}
+	d := q.opts.Backoff
+	for i := 1; i < t.attempts && d < q.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > q.opts.MaxBackoff {
+		d = q.opts.MaxBackoff
+	}
+	return d
+}
+
+//Drain stops taking jobs, abandons the ones waiting for a delay or retry and waits for
+//the ready and running ones; when ctx is done first the running ones are canceled
+//and the ready ones abandoned
+func (q *Queue) Drain(ctx context.Context) error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return ErrClosed
+	}
+	q.closed = true
+	var abandoned []*task
+	for t, timer := range q.delayed {
+		timer.Stop()
+		abandoned = append(abandoned, t)
+	}
+	q.delayed = make(map[*task]*time.Timer)
+	q.mu.Unlock()
+	for _, t := range abandoned {
+		q.finish(t, RESULT_ABANDONED, ErrAbandoned, 0)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		q.active.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		q.cancel()
+		<-done
+	}
+	q.cancel()
+	close(q.ready)
+	q.wg.Wait()
+	return err
+}
+
+//Depth returns the jobs ready and not running yet
+func (q *Queue) Depth() int {
+	return len(q.ready)
+}
+
+//Delayed returns the jobs waiting for a delay or a retry
+func (q *Queue) Delayed() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.delayed)
+}
+
+//Busy returns the workers running a job
+func (q *Queue) Busy() int {
+	return int(atomic.LoadInt32(&q.busy))
+}
+
+func (q *Queue) Workers() int {
+	return q.opts.Workers
+}
@@ -0,0 +1,167 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testJob struct {
+	key       string
+	fails     int32 //runs failing before the first success
+	permanent bool  //failures not worth a retry
+	runs      int32
+	block     chan struct{}
+	finished  chan error
+}
+
+func (j *testJob) Type() string {
+	return "test"
+}
+
+func (j *testJob) Key() string {
+	return j.key
+}
+
+func (j *testJob) Run(ctx context.Context) error {
+	if j.block != nil {
+		select {
+		case <-j.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if atomic.AddInt32(&j.runs, 1) <= j.fails {
+		if j.permanent {
+			return Permanent(errors.New("failed"))
+		}
+		return errors.New("failed")
+	}
+	return nil
+}
+
+func (j *testJob) Finish(err error) {
+	j.finished <- err
+}
+
+func newJob(key string, fails int32) *testJob {
+	return &testJob{key: key, fails: fails, finished: make(chan error, 1)}
+}
+
+func finished(t *testing.T, j *testJob) error {
+	select {
+	case err := <-j.finished:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("job not finished")
+	}
+	return nil
+}
+
+func TestRetry(t *testing.T) {
+	results := make(chan string, 10)
+	q := NewQueue(Options{Workers: 2, Backoff: time.Millisecond, OnDone: func(job Job, result string, err error, cost time.Duration) {
+		results <- result
+	}})
+	defer q.Drain(context.Background())
+
+	j := newJob("a", 2)
+	if err := q.Submit(j); err != nil {
+		t.Fatalf("submit err:%v", err)
+	}
+	if err := q.Submit(newJob("a", 0)); err != ErrDuplicate {
+		t.Errorf("duplicate key: %v", err)
+	}
+	if err := finished(t, j); err != nil || j.runs != 3 {
+		t.Errorf("err %v after %d runs", err, j.runs)
+	}
+	if got := []string{<-results, <-results, <-results}; got[0] != RESULT_RETRY || got[1] != RESULT_RETRY || got[2] != RESULT_OK {
+		t.Errorf("results %v", got)
+	}
+
+	failing := newJob("b", 10)
+	q.Submit(failing)
+	if err := finished(t, failing); err == nil || failing.runs != DEF_MAX_ATTEMPTS {
+		t.Errorf("err %v after %d runs", err, failing.runs)
+	}
+	permanent := newJob("c", 10)
+	permanent.permanent = true
+	q.Submit(permanent)
+	if err := finished(t, permanent); err == nil || permanent.runs != 1 {
+		t.Errorf("err %v after %d runs", err, permanent.runs)
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	q := NewQueue(Options{Workers: 1, QueueSize: 1})
+	block := make(chan struct{})
+	running := &testJob{block: block, finished: make(chan error, 1)}
+	q.Submit(running)
+	for q.Busy() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := q.Submit(newJob("", 0)); err != nil {
+		t.Errorf("submit err:%v", err)
+	}
+	if err := q.Submit(newJob("", 0)); err != ErrQueueFull {
+		t.Errorf("queue not full: %v", err)
+	}
+	if q.Depth() != 1 {
+		t.Errorf("depth %d", q.Depth())
+	}
+	close(block)
+	q.Drain(context.Background())
+}
+
+func TestDrain(t *testing.T) {
+	q := NewQueue(Options{Workers: 1, Backoff: time.Hour})
+	retried := newJob("", 1)
+	q.Submit(retried)
+	delayed := newJob("", 0)
+	q.SubmitAfter(delayed, time.Hour)
+	for q.Delayed() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	block := make(chan struct{})
+	running := &testJob{block: block, finished: make(chan error, 1)}
+	q.Submit(running)
+	queued := newJob("", 0)
+	q.Submit(queued)
+
+	drained := make(chan error, 1)
+	go func() { drained <- q.Drain(context.Background()) }()
+	if err := finished(t, retried); err != ErrAbandoned {
+		t.Errorf("retry not abandoned: %v", err)
+	}
+	if err := finished(t, delayed); err != ErrAbandoned {
+		t.Errorf("delayed job not abandoned: %v", err)
+	}
+	if err := q.Submit(newJob("", 0)); err != ErrClosed {
+		t.Errorf("submit while draining: %v", err)
+	}
+	close(block)
+	if err := <-drained; err != nil {
+		t.Errorf("drain err:%v", err)
+	}
+	if err := finished(t, queued); err != nil || queued.runs != 1 {
+		t.Errorf("queued job not run before the end of the drain: %v", err)
+	}
+
+	//running jobs are canceled when the drain times out
+	q = NewQueue(Options{Workers: 1})
+	stuck := &testJob{block: make(chan struct{}), finished: make(chan error, 1)}
+	q.Submit(stuck)
+	for q.Busy() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf("drain err:%v", err)
+	}
+	if err := finished(t, stuck); err != ErrAbandoned {
+		t.Errorf("stuck job: %v", err)
+	}
+}
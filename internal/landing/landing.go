@@ -0,0 +1,265 @@
+package landing
+
+/*
+	parameters of the url a BAS redirects an unauthenticated browser to.
+
+	each vendor names them its own way (wlanuserip, wlanacip, usermac, ...), the mappings
+	extract them from the landing request and the store keeps them for the browser session,
+	so that login and logout get them without the front end knowing the vendor names.
+*/
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gityf/portalserver/internal/config"
+)
+
+//fields of a landing, the keys of VendorMapping.Params
+const (
+	FIELD_USERIP  = "userip"
+	FIELD_BRASIP  = "brasip"
+	FIELD_USERMAC = "usermac"
+	FIELD_ACNAME  = "acname"
+	FIELD_SSID    = "ssid"
+)
+
+const (
+	SESSION_COOKIE      = "portal_landing"
+	DEF_SESSION_TTL     = 12 * time.Hour
+	DEF_MAX_SESSIONS    = 100000
+	session_sweep_every = time.Minute
+)
+
+//DefaultVendors are used when the config has no vendor, the generic names last
+var DefaultVendors = []config.VendorMapping{
+	{Name: "huawei", Params: map[string][]string{
+		FIELD_USERIP:  {"wlanuserip"},
+		FIELD_BRASIP:  {"wlanacip"},
+		FIELD_USERMAC: {"usermac", "wlanusermac"},
+		FIELD_ACNAME:  {"wlanacname"},
+		FIELD_SSID:    {"ssid"},
+	}},
+	{Name: "zte", Params: map[string][]string{
+		FIELD_USERIP:  {"wlanuserip"},
+		FIELD_BRASIP:  {"wlanacip"},
+		FIELD_USERMAC: {"usermac", "mac"},
+		FIELD_ACNAME:  {"wlanacname"},
+		FIELD_SSID:    {"ssid"},
+	}},
+	{Name: "generic", Params: map[string][]string{
+		FIELD_USERIP:  {"userip"},
+		FIELD_BRASIP:  {"brasip", "basip"},
+		FIELD_USERMAC: {"usermac", "mac"},
+		FIELD_ACNAME:  {"acname"},
+		FIELD_SSID:    {"ssid"},
+	}},
+}
+
+//Params of a landing, empty when unknown
+type Params struct {
+	Vendor  string `json:"vendor"`
+	UserIP  string `json:"userip"`
+	BrasIP  string `json:"brasip"`
+	UserMac string `json:"usermac"`
+	AcName  string `json:"acname"`
+	SSID    string `json:"ssid"`
+}
+
+//Empty reports whether p holds nothing
+func (p Params) Empty() bool {
+	return p == Params{}
+}
+
+//Merge returns p with its empty fields taken from other
+func (p Params) Merge(other Params) Params {
+	for _, f := range []struct{ dst, src *string }{
+		{&p.Vendor, &other.Vendor}, {&p.UserIP, &other.UserIP}, {&p.BrasIP, &other.BrasIP},
+		{&p.UserMac, &other.UserMac}, {&p.AcName, &other.AcName}, {&p.SSID, &other.SSID},
+	} {
+		if *f.dst == "" {
+			*f.dst = *f.src
+		}
+	}
+	return p
+}
+
+//Vendors returns the mappings in force
+func Vendors() []config.VendorMapping {
+	if len(config.Cfg.Landing.Vendors) > 0 {
+		return config.Cfg.Landing.Vendors
+	}
+	return DefaultVendors
+}
+
+//Parse extracts the landing parameters of form with the mapping of the vendor parameter,
+//else with the mapping finding a valid user ip and the most other fields, the first one
+//on a tie. ok is false when none finds a user ip
+func Parse(form url.Values) (p Params, ok bool) {
+	vendors := Vendors()
+	if name := form.Get("vendor"); name != "" {
+		for _, v := range vendors {
+			if strings.EqualFold(v.Name, name) {
+				p = Extract(form, v)
+				return p, p.UserIP != ""
+			}
+		}
+	}
+	best := -1
+	for _, v := range vendors {
+		found := Extract(form, v)
+		if n := found.count(); found.UserIP != "" && n > best {
+			p, best = found, n
+		}
+	}
+	return p, best >= 0
+}
+
+//count returns the number of fields found
+func (p Params) count() (n int) {
+	for _, v := range []string{p.UserIP, p.BrasIP, p.UserMac, p.AcName, p.SSID} {
+		if v != "" {
+			n++
+		}
+	}
+	return
+}
+
+//Extract returns the parameters of form named by the mapping, invalid values dropped
+func Extract(form url.Values, v config.VendorMapping) (p Params) {
+	get := func(field string) string {
+		for _, name := range v.Params[field] {
+			if value := strings.TrimSpace(form.Get(name)); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+	p.UserIP = validIP(get(FIELD_USERIP))
+	if p.UserIP == "" {
+		return Params{}
+	}
+	p.Vendor = v.Name
+	p.BrasIP = validIP(get(FIELD_BRASIP))
+	p.UserMac = NormalizeMac(get(FIELD_USERMAC))
+	p.AcName = get(FIELD_ACNAME)
+	p.SSID = get(FIELD_SSID)
+	return
+}
+
+func validIP(s string) string {
+	if ip := net.ParseIP(s); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+//NormalizeMac returns a mac as 00:11:22:33:44:55, from the colon, dash, dot or bare hex forms
+//of the vendors. empty when s is no mac
+func NormalizeMac(s string) string {
+	if s == "" {
+		return ""
+	}
+	if mac, err := net.ParseMAC(s); err == nil && len(mac) == 6 {
+		return mac.String()
+	}
+	if len(s) == 12 {
+		if b, err := hex.DecodeString(s); err == nil {
+			return net.HardwareAddr(b).String()
+		}
+	}
+	return ""
+}
+
+type session struct {
+	params  Params
+	expires time.Time
+}
+
+//Store keeps the landing of each browser session in memory
+type Store struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	max       int
+	sessions  map[string]*session
+	lastSweep time.Time
+}
+
+func NewStore(ttl time.Duration, max int) *Store {
+	if ttl <= 0 {
+		ttl = DEF_SESSION_TTL
+	}
+	if max <= 0 {
+		max = DEF_MAX_SESSIONS
+	}
+	return &Store{ttl: ttl, max: max, sessions: make(map[string]*session)}
+}
+
+//Get returns the landing of the session id, its ttl restarted
+func (s *Store) Get(id string) (p Params, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess := s.sessions[id]
+	if sess == nil {
+		return
+	}
+	now := time.Now()
+	if now.After(sess.expires) {
+		delete(s.sessions, id)
+		return
+	}
+	sess.expires = now.Add(s.ttl)
+	return sess.params, true
+}
+
+//Put keeps p for the session id, a new id is returned when id is empty
+func (s *Store) Put(id string, p Params) string {
+	if id == "" {
+		id = newSessionId()
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[id]; !ok && len(s.sessions) >= s.max {
+		s.sweep(now, true)
+	} else if now.Sub(s.lastSweep) > session_sweep_every {
+		s.sweep(now, false)
+	}
+	s.sessions[id] = &session{params: p, expires: now.Add(s.ttl)}
+	return id
+}
+
+//Len returns the number of sessions kept
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+//sweep removes the expired sessions, and the ones closest to expire when full
+func (s *Store) sweep(now time.Time, full bool) {
+	s.lastSweep = now
+	var oldestId string
+	var oldest time.Time
+	for id, sess := range s.sessions {
+		if now.After(sess.expires) {
+			delete(s.sessions, id)
+		} else if oldestId == "" || sess.expires.Before(oldest) {
+			oldestId, oldest = id, sess.expires
+		}
+	}
+	if full && len(s.sessions) >= s.max {
+		delete(s.sessions, oldestId)
+	}
+}
+
+func newSessionId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
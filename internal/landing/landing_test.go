@@ -0,0 +1,60 @@
+package landing
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gityf/portalserver/internal/config"
+)
+
+func TestParse(t *testing.T) {
+	for _, c := range []struct {
+		query string
+		want  Params
+		ok    bool
+	}{
+		{"wlanuserip=10.0.0.5&wlanacip=10.0.0.1&wlanacname=ac1&usermac=00-11-22-33-44-55&ssid=guest",
+			Params{Vendor: "huawei", UserIP: "10.0.0.5", BrasIP: "10.0.0.1", UserMac: "00:11:22:33:44:55", AcName: "ac1", SSID: "guest"}, true},
+		{"vendor=zte&wlanuserip=10.0.0.5&mac=001122334455",
+			Params{Vendor: "zte", UserIP: "10.0.0.5", UserMac: "00:11:22:33:44:55"}, true},
+		{"userip=10.0.0.5&brasip=10.0.0.1&usermac=0011.2233.4455",
+			Params{Vendor: "generic", UserIP: "10.0.0.5", BrasIP: "10.0.0.1", UserMac: "00:11:22:33:44:55"}, true},
+		{"wlanuserip=bad&wlanacip=10.0.0.1", Params{}, false},
+		{"vendor=zte&userip=10.0.0.5", Params{}, false},
+	} {
+		form, _ := url.ParseQuery(c.query)
+		p, ok := Parse(form)
+		if p != c.want || ok != c.ok {
+			t.Errorf("%v: got %+v %v, want %+v %v", c.query, p, ok, c.want, c.ok)
+		}
+	}
+
+	config.Cfg.Landing.Vendors = []config.VendorMapping{{Name: "custom", Params: map[string][]string{FIELD_USERIP: {"uip"}}}}
+	defer func() { config.Cfg.Landing.Vendors = nil }()
+	form, _ := url.ParseQuery("uip=10.0.0.6&wlanuserip=10.0.0.5")
+	if p, ok := Parse(form); !ok || p.Vendor != "custom" || p.UserIP != "10.0.0.6" {
+		t.Errorf("custom mapping: %+v %v", p, ok)
+	}
+}
+
+func TestStore(t *testing.T) {
+	s := NewStore(50*time.Millisecond, 2)
+	a := s.Put("", Params{UserIP: "10.0.0.1"})
+	b := s.Put("", Params{UserIP: "10.0.0.2"})
+	if a == b || len(a) != 32 {
+		t.Fatalf("session ids %q %q", a, b)
+	}
+	if p, ok := s.Get(a); !ok || p.UserIP != "10.0.0.1" {
+		t.Errorf("get %+v %v", p, ok)
+	}
+	//full, the session closest to expire goes
+	s.Put("", Params{UserIP: "10.0.0.3"})
+	if _, ok := s.Get(b); ok || s.Len() != 2 {
+		t.Errorf("oldest kept, %v sessions", s.Len())
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := s.Get(a); ok {
+		t.Errorf("expired session kept")
+	}
+}
@@ -0,0 +1,106 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/gityf/portalserver/internal/config"
+	"github.com/gityf/portalserver/internal/global"
+	"github.com/gityf/portalserver/internal/logintxn"
+	"github.com/gityf/portalserver/internal/metrics"
+	"github.com/gityf/portalserver/internal/portalctx"
+
+	logger "github.com/gityf/portalserver/xlog4go"
+)
+
+//LoginTxns keeps the transactions of the async logins, see SetupAsyncLogin
+var LoginTxns = logintxn.NewStore(logintxn.Options{})
+
+var (
+	//parent of the async logins, canceled by CloseAsyncLogins
+	asyncCtx, asyncCancel = context.WithCancel(context.Background())
+	asyncLogins           sync.WaitGroup
+	//set by CloseAsyncLogins, asyncLogins is added to under asyncMu only while false
+	asyncMu     sync.Mutex
+	asyncClosed bool
+)
+
+var ErrAsyncLoginsClosed = errors.New("async logins closed, shutting down")
+
+func init() {
+	metrics.NewGaugeFunc("portal_async_logins_pending", "Async logins running in the background.", func() float64 {
+		return float64(LoginTxns.Pending())
+	})
+}
+
+//SetupAsyncLogin applies config.Cfg.AsyncLogin
+func SetupAsyncLogin() error {
+	ac := config.Cfg.AsyncLogin
+	if ac.TTL < 0 || ac.MaxPending < 0 {
+		return fmt.Errorf("async_login with a negative setting")
+	}
+	LoginTxns = logintxn.NewStore(logintxn.Options{
+		TTL:        time.Duration(ac.TTL) * time.Second,
+		MaxPending: ac.MaxPending,
+	})
+	return nil
+}
+
+//CloseAsyncLogins refuses the next async logins, cancels the running ones and waits for them
+func CloseAsyncLogins() {
+	asyncMu.Lock()
+	asyncClosed = true
+	asyncMu.Unlock()
+	asyncCancel()
+	asyncLogins.Wait()
+}
+
+//beginAsyncLogin counts a login in asyncLogins, false once CloseAsyncLogins was called
+func beginAsyncLogin() bool {
+	asyncMu.Lock()
+	defer asyncMu.Unlock()
+	if asyncClosed {
+		return false
+	}
+	asyncLogins.Add(1)
+	return true
+}
+
+//asyncLogin starts the login of msg in the background and answers the id of its transaction
+func asyncLogin(msg *portalctx.Message) (resp *portalctx.BaseResponse) {
+	resp = portalctx.NewBaseResponse()
+	if !beginAsyncLogin() {
+		logger.FromContext(msg.Context()).Warnw("async login refused", "err", ErrAsyncLoginsClosed)
+		resp.Errno, resp.Errmsg = global.ERR_BUSY, ErrAsyncLoginsClosed.Error()
+		return resp
+	}
+	status, err := LoginTxns.Begin()
+	if err != nil {
+		asyncLogins.Done()
+		logger.FromContext(msg.Context()).Warnw("async login refused", "err", err)
+		resp.Errno, resp.Errmsg = global.ERR_BUSY, err.Error()
+		return resp
+	}
+	resp.ID = status.ID
+
+	//the request ends now, the login lives until the shutdown
+	bg := *msg
+	bg.Writer = nil
+	bg.Ctx = logger.NewContext(asyncCtx, logger.FromContext(msg.Context()).With("txn", status.ID))
+	go func() {
+		defer asyncLogins.Done()
+		defer func() {
+			if err := recover(); err != nil {
+				logger.FromContext(bg.Ctx).Errorw("async login panic", "err", err, "stack", string(debug.Stack()))
+				LoginTxns.Finish(status.ID, global.ERR_PANIC, fmt.Sprint(err))
+			}
+		}()
+		r := runLogin(&bg, func(s uint8) { LoginTxns.SetStatus(status.ID, s) })
+		LoginTxns.Finish(status.ID, r.Errno, r.Errmsg)
+	}()
+	return resp
+}
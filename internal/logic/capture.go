@@ -0,0 +1,47 @@
+package logic
+
+import (
+	"github.com/gityf/portalserver/internal/config"
+	"github.com/gityf/portalserver/portal"
+
+	logger "github.com/gityf/portalserver/xlog4go"
+)
+
+const DEF_CAPTURE_DIR = "log/pcap"
+
+//PacketCapture records the BAS traffic of every portal client, off until enabled
+var PacketCapture = portal.NewCapture(portal.CaptureOptions{Dir: DEF_CAPTURE_DIR})
+
+//SetupCapture applies config.Cfg.Capture, dir is relative to the working directory
+func SetupCapture() {
+	cc := config.Cfg.Capture
+	opts := portal.CaptureOptions{
+		Dir:      cc.Dir,
+		MaxSize:  int64(cc.MaxSizeMB) << 20,
+		MaxFiles: cc.MaxFiles,
+		BasIPs:   cc.BrasIPs,
+	}
+	if opts.Dir == "" {
+		opts.Dir = DEF_CAPTURE_DIR
+	}
+	//clients are created on demand, none holds the default capture yet
+	PacketCapture = portal.NewCapture(opts)
+	if cc.On {
+		EnableCapture("config")
+	}
+}
+
+//EnableCapture starts the capture, the pcap files hold the credentials in clear
+func EnableCapture(by string) {
+	PacketCapture.Enable()
+	logger.Warnw("PACKET CAPTURE ENABLED, pcap files hold credentials in clear",
+		"by", by, "brasips", PacketCapture.Filter())
+}
+
+//DisableCapture stops the capture and closes the current file
+func DisableCapture(by string) {
+	if err := PacketCapture.Disable(); err != nil {
+		logger.Errorw("close packet capture file failed", "err", err)
+	}
+	logger.Warnw("packet capture disabled", "by", by, "packets", PacketCapture.Count())
+}
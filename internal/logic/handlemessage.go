@@ -0,0 +1,134 @@
+package logic
+
+import (
+	"github.com/gityf/portalserver/internal/portalctx"
+	"github.com/gityf/portalserver/internal/global"
+	"github.com/gityf/portalserver/internal/config"
+	"github.com/gityf/portalserver/internal/session"
+	"github.com/gityf/portalserver/internal/util"
+	"github.com/gityf/portalserver/portal"
+	logger "github.com/gityf/portalserver/xlog4go"
+)
+
+func HandleMessage(msg *portalctx.Message) (resp *portalctx.BaseResponse) {
+
+	switch msg.MessageType {
+	case global.KMsgTypeLogin:
+		resp = login(msg)
+	case global.KMsgTypeLogout:
+		resp = logout(msg)
+	case global.KMsgTypeGetVlanInfo:
+		resp = getVlanInfo(msg)
+	default:
+		resp = portalctx.NewBaseResponse()
+	}
+	resp.ResponseJson(msg.Writer)
+	return resp
+}
+
+func login(msg *portalctx.Message)  (resp *portalctx.BaseResponse) {
+	if msg.Async {
+		return asyncLogin(msg)
+	}
+	return runLogin(msg, nil)
+}
+
+//runLogin logs the user in, onStatus is told of each PCMSTATUS_* stage entered when not nil
+func runLogin(msg *portalctx.Message, onStatus func(status uint8)) (resp *portalctx.BaseResponse) {
+	resp = portalctx.NewBaseResponse()
+	client, err := GetPortalClient(msg.BrasIP)
+	if err != nil {
+		logger.FromContext(msg.Context()).Error("login get portal client of bras:%v err:%v", msg.BrasIP, err)
+		resp.Errno = global.USER_RET_ERR_INIT_UDPPEER_FAILED
+		resp.Errmsg = global.GetUserRetDesc(resp.Errno)
+		return resp
+	}
+	log, ctx := transactionLog(msg, client.Options().BasIP)
+	log.Debug("login Message:%+v.", msg.FormStruct.Redacted())
+	log.Debugw("login portalClient", "auth_type", config.Cfg.AuthType)
+	if onStatus != nil {
+		ctx = portal.ContextWithStatusFunc(ctx, onStatus)
+	}
+	//the AFF_ACK_AUTH owed once the BAS accepted the login, sent again after a restart
+	var (
+		affID        uint64
+		affJournaled bool
+	)
+	ctx = portal.ContextWithAffAckFunc(ctx, func(a portal.AffAckAuth) {
+		affID, affJournaled = journalPending(session.Pending{Op: "aff_ack_auth", BrasIP: a.BasIP, UserIP: a.UserIP,
+			UserName: msg.UserName, SerialNo: a.SerialNo, ReqID: a.ReqID})
+	})
+	//the login may be taken by a standby address, the pending one names the primary
+	id, journaled := beginPending("login", client.Options().BasIP, msg.UserIP, msg.UserName)
+	res, err := client.Login(ctx, msg.UserName, msg.Password, msg.UserIP)
+	brasIP := client.Options().BasIP
+	if err != nil {
+		log.Errorw("login failed", "err", err)
+	} else {
+		brasIP = res.BasIP
+		if brasIP != client.Options().BasIP {
+			log.Infow("login taken by a standby address", "basip", brasIP)
+		}
+		loggedIn(msg, brasIP)
+	}
+	donePending(affID, affJournaled)
+	donePending(id, journaled)
+	resp.Errno = GetUserErrCode(err)
+	basTransactions.Inc("login", util.ToString(resp.Errno))
+	resp.Errmsg = global.GetUserRetDesc(resp.Errno)
+	emitEvent(loginEvent(msg, brasIP, resp))
+	return resp
+}
+
+func logout(msg *portalctx.Message)  (resp *portalctx.BaseResponse) {
+	resp = portalctx.NewBaseResponse()
+	client, err := GetPortalClient(msg.BrasIP)
+	if err != nil {
+		logger.FromContext(msg.Context()).Error("logout get portal client of bras:%v err:%v", msg.BrasIP, err)
+		resp.Errno = global.USER_RET_ERR_INIT_UDPPEER_FAILED
+		resp.Errmsg = global.GetUserRetDesc(resp.Errno)
+		return resp
+	}
+	//the session is logged out where it was logged in, by any address when not kept
+	brasIP, at := client.Options().BasIP, ""
+	if s, ok := basSession(client.Options().BasIP, msg.UserIP); ok {
+		brasIP, at = s.BrasIP, s.BrasIP
+	}
+	log, ctx := transactionLog(msg, brasIP)
+	id, journaled := beginPending("logout", brasIP, msg.UserIP, msg.UserName)
+	res, err := client.LogoutAt(ctx, at, msg.UserName, msg.UserIP)
+	if err != nil {
+		log.Errorw("logout failed", "err", err)
+	} else {
+		loggedOut(msg, res.BasIP)
+	}
+	donePending(id, journaled)
+	resp.Errno = GetUserErrCode(err)
+	basTransactions.Inc("logout", util.ToString(resp.Errno))
+	resp.Errmsg = global.GetUserRetDesc(resp.Errno)
+	return resp
+}
+
+func getVlanInfo(msg *portalctx.Message)  (resp *portalctx.BaseResponse) {
+	resp = portalctx.NewBaseResponse()
+	client, err := GetPortalClient(msg.BrasIP)
+	if err != nil {
+		logger.FromContext(msg.Context()).Error("getvlaninfo get portal client of bras:%v err:%v", msg.BrasIP, err)
+		resp.Errno = global.USER_RET_ERR_INIT_UDPPEER_FAILED
+		resp.Errmsg = global.GetUserRetDesc(resp.Errno)
+		return resp
+	}
+	brasIP, at := client.Options().BasIP, ""
+	if s, ok := basSession(client.Options().BasIP, msg.UserIP); ok {
+		brasIP, at = s.BrasIP, s.BrasIP
+	}
+	log, ctx := transactionLog(msg, brasIP)
+	_, err = client.InfoAt(ctx, at, msg.UserIP)
+	if err != nil {
+		log.Errorw("getvlaninfo failed", "err", err)
+	}
+	resp.Errno = GetUserErrCode(err)
+	basTransactions.Inc("info", util.ToString(resp.Errno))
+	resp.Errmsg = global.GetUserRetDesc(resp.Errno)
+	return resp
+}
@@ -0,0 +1,74 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/gityf/portalserver/internal/config"
+	"github.com/gityf/portalserver/internal/global"
+	"github.com/gityf/portalserver/internal/portalctx"
+	"github.com/gityf/portalserver/internal/session"
+	"github.com/gityf/portalserver/portal"
+	"github.com/gityf/portalserver/portal/portaltest"
+)
+
+func TestLoginOnStandby(t *testing.T) {
+	defer func(c config.PortalServerConfig) {
+		config.Cfg = c
+		portalClients = make(map[string]*portal.Client)
+		Sessions = session.NewStore()
+	}(config.Cfg)
+	logouts := make(chan struct{}, 1)
+	port, stop := portaltest.FakeBAS(t, "secret", func(req *portal.PortalPacket) *portal.PortalPacket {
+		if req.PortalType == portal.PACKETTYPE_REQLOGOUT {
+			logouts <- struct{}{}
+			return &portal.PortalPacket{PortalType: portal.PACKETTYPE_ACKLOGOUT}
+		}
+		return &portal.PortalPacket{PortalType: portal.PACKETTYPE_ACKAUTH}
+	})
+	defer stop()
+	config.Cfg.BrasIP = "127.0.0.2" //nothing listens there
+	config.Cfg.BrasPort = port
+	config.Cfg.BrasBackups = config.BrasBackupsConfig{"127.0.0.2": {"127.0.0.1"}}
+	config.Cfg.SharedSecret = "secret"
+	config.Cfg.Timeout = 100
+	config.Cfg.RetryTime = 1
+	portalClients = make(map[string]*portal.Client)
+	Sessions = session.NewStore()
+
+	msg := &portalctx.Message{FormStruct: &portalctx.FormStruct{UserName: "bob", Password: "pass", UserIP: "10.1.0.9"}}
+	if resp := runLogin(msg, nil); resp.Errno != global.USER_RET_ERR_OK {
+		t.Fatalf("login errno %v", resp.Errno)
+	}
+	if _, ok := Sessions.Get("127.0.0.1", "10.1.0.9"); !ok {
+		t.Fatalf("session not kept on the standby address: %+v", Sessions.List(nil))
+	}
+
+	//the logout goes straight to the standby address, the primary never tried
+	if resp := logout(msg); resp.Errno != global.USER_RET_ERR_OK {
+		t.Fatalf("logout errno %v", resp.Errno)
+	}
+	if len(logouts) != 1 || Sessions.Len() != 0 {
+		t.Errorf("logouts %v sessions %+v", len(logouts), Sessions.List(nil))
+	}
+	if states := portalClients["127.0.0.2"].Breakers(); states[0].Failures != 1 {
+		t.Errorf("primary tried by the logout: %+v", states)
+	}
+}
+
+func TestAsyncLoginAfterClose(t *testing.T) {
+	defer func() {
+		asyncMu.Lock()
+		asyncClosed = false
+		asyncMu.Unlock()
+	}()
+	CloseAsyncLogins()
+
+	//refused before any transaction or goroutine starts, nothing left for the Wait already done
+	msg := &portalctx.Message{FormStruct: &portalctx.FormStruct{UserName: "bob", Password: "pass", UserIP: "10.1.0.9", Async: true}}
+	if resp := asyncLogin(msg); resp.Errno != global.ERR_BUSY || resp.ID != "" {
+		t.Errorf("async login after close: %+v", resp)
+	}
+	if LoginTxns.Pending() != 0 {
+		t.Errorf("%v transactions pending", LoginTxns.Pending())
+	}
+}
@@ -0,0 +1,78 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/gityf/portalserver/internal/config"
+	"github.com/gityf/portalserver/internal/health"
+	"github.com/gityf/portalserver/portal"
+	logger "github.com/gityf/portalserver/xlog4go"
+)
+
+//DEF_PROBE_IP is a documentation address, no user has it
+const DEF_PROBE_IP = "192.0.2.1"
+
+//Health probes the BAS of config.Cfg.Health, see SetupHealth
+var Health = health.NewChecker(health.Options{})
+
+//SetupHealth applies config.Cfg.Health, the probes run as jobs once ScheduleJobs is called
+func SetupHealth() error {
+	hc := config.Cfg.Health
+	probeIP := hc.ProbeIP
+	if probeIP == "" {
+		probeIP = DEF_PROBE_IP
+	}
+	if ip := net.ParseIP(probeIP); ip == nil || ip.To4() == nil {
+		return fmt.Errorf("invalid health probe_ip %q", probeIP)
+	}
+	brasIPs := hc.BrasIPs
+	if len(brasIPs) == 0 && config.Cfg.BrasIP != "" {
+		brasIPs = []string{config.Cfg.BrasIP}
+	}
+	Health = health.NewChecker(health.Options{
+		BrasIPs:       brasIPs,
+		Probe:         func(ctx context.Context, brasIP string) error { return probeBas(ctx, brasIP, probeIP) },
+		Interval:      time.Duration(hc.Interval) * time.Second,
+		Timeout:       time.Duration(hc.Timeout) * time.Millisecond,
+		FailThreshold: hc.FailThreshold,
+	})
+	Health.AddCheck("config", func() error {
+		if !config.Loaded() {
+			return errors.New("config not loaded")
+		}
+		return nil
+	})
+	Health.AddCheck("logger", func() error {
+		if status := logger.Status(); !status.Healthy() {
+			return fmt.Errorf("log writer failing since %v: %v", status.LastError.Format(time.RFC3339), status.Err)
+		}
+		return nil
+	})
+	return nil
+}
+
+//probeBas sends REQ_INFO for the sentinel ip, the BAS is up when it answers
+//with an ack whose authenticator verifies, whatever the errcode for that ip
+func probeBas(ctx context.Context, brasIP, probeIP string) error {
+	client, err := GetPortalClient(brasIP)
+	if err != nil {
+		return err
+	}
+	log := portalLogger{logger.Module(portal.LOG_MODULE_CLIENT).With("brasip", brasIP, "probe", true)}
+	_, err = client.Info(portal.ContextWithLogger(ctx, log), probeIP)
+	var pe *portal.Error
+	if err == nil || errors.As(err, &pe) && pe.Failure == portal.PCMFAIL_NONE {
+		return nil
+	}
+	if pe != nil && pe.Failure == portal.PCMFAIL_AUTHENTICATOR {
+		return fmt.Errorf("%v, check the shared secret", portal.FailureString(pe.Failure))
+	}
+	if pe != nil {
+		return errors.New(portal.FailureString(pe.Failure))
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+package logic
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gityf/portalserver/internal/config"
+	"github.com/gityf/portalserver/portal"
+	"github.com/gityf/portalserver/portal/portaltest"
+)
+
+//infoAck acks every REQ_INFO with errCode, signed with secret
+func infoAck(errCode uint8, secret string) func(req *portal.PortalPacket) *portal.PortalPacket {
+	return func(req *portal.PortalPacket) *portal.PortalPacket {
+		if req.PortalType != portal.PACKETTYPE_REQINFO {
+			return nil
+		}
+		return &portal.PortalPacket{PortalType: portal.PACKETTYPE_ACKINFO, ErrCode: errCode, SharedSecret: secret}
+	}
+}
+
+func TestProbeBas(t *testing.T) {
+	defer func(c config.PortalServerConfig) {
+		config.Cfg = c
+		portalClients = make(map[string]*portal.Client)
+	}(config.Cfg)
+	config.Cfg.SharedSecret = "secret"
+	config.Cfg.Timeout = 200
+	config.Cfg.RetryTime = 1
+
+	for _, c := range []struct {
+		secret  string
+		errCode uint8
+		want    string
+	}{
+		{"secret", 0, ""},
+		{"secret", 2, ""}, //the sentinel ip is unknown to the BAS, the ack verified
+		{"other", 0, "check the shared secret"},
+	} {
+		port, stop := portaltest.FakeBAS(t, "secret", infoAck(c.errCode, c.secret))
+		config.Cfg.BrasPort = port
+		portalClients = make(map[string]*portal.Client)
+		err := probeBas(context.Background(), "127.0.0.1", DEF_PROBE_IP)
+		stop()
+		if c.want == "" && err != nil || c.want != "" && (err == nil || !strings.Contains(err.Error(), c.want)) {
+			t.Errorf("secret %v errcode %v: %v", c.secret, c.errCode, err)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gityf/portalserver/internal/config"
+	"github.com/gityf/portalserver/internal/jobs"
+	"github.com/gityf/portalserver/internal/metrics"
+	"github.com/gityf/portalserver/internal/session"
+
+	logger "github.com/gityf/portalserver/xlog4go"
+)
+
+//types of the jobs of the server, the webhook deliveries are webhook.JOB_TYPE
+const (
+	JOB_LOGOUT       = "logout"       //of a session over its limits
+	JOB_SERIAL_FLUSH = "serial_flush" //serial counters saved to the journal
+	JOB_BAS_PROBE    = "bas_probe"    //health probe of one BAS
+
+	DEF_DRAIN_TIMEOUT     = 10 * time.Second
+	SERIAL_FLUSH_INTERVAL = time.Second
+)
+
+//Jobs runs the work kept off the http path, see SetupJobs
+var Jobs *jobs.Queue
+
+var (
+	//jobs run by type and jobs.RESULT_*
+	jobRuns = metrics.NewCounter("portal_jobs_total",
+		"Background jobs by type and result.", "type", "result")
+	jobDuration = metrics.NewHistogram("portal_job_duration_seconds",
+		"Time of one run of a background job.", nil, "type")
+)
+
+func init() {
+	metrics.NewGaugeFunc("portal_jobs_queue_depth", "Background jobs waiting for a worker.", func() float64 {
+		if Jobs == nil {
+			return 0
+		}
+		return float64(Jobs.Depth())
+	})
+	metrics.NewGaugeFunc("portal_jobs_delayed", "Background jobs waiting for a retry or their time.", func() float64 {
+		if Jobs == nil {
+			return 0
+		}
+		return float64(Jobs.Delayed())
+	})
+	metrics.NewGaugeFunc("portal_jobs_workers_busy", "Workers running a background job.", func() float64 {
+		if Jobs == nil {
+			return 0
+		}
+		return float64(Jobs.Busy())
+	})
+	metrics.NewGaugeFunc("portal_jobs_workers", "Workers of the background jobs.", func() float64 {
+		if Jobs == nil {
+			return 0
+		}
+		return float64(Jobs.Workers())
+	})
+}
+
+//SetupJobs starts the workers of config.Cfg.Jobs, the periodic jobs are queued by ScheduleJobs
+func SetupJobs() error {
+	jc := config.Cfg.Jobs
+	if jc.Workers < 0 || jc.QueueSize < 0 || jc.MaxAttempts < 0 || jc.DrainTimeout < 0 {
+		return fmt.Errorf("jobs with a negative setting")
+	}
+	Jobs = jobs.NewQueue(jobs.Options{
+		Workers:     jc.Workers,
+		QueueSize:   jc.QueueSize,
+		MaxAttempts: jc.MaxAttempts,
+		OnDone:      jobDone,
+	})
+	logger.Infow("job workers started", "workers", Jobs.Workers())
+	return nil
+}
+
+//ScheduleJobs queues the serial flushes and the BAS probes until ctx is done
+func ScheduleJobs(ctx context.Context) {
+	if Journal != nil {
+		go Jobs.Every(ctx, SERIAL_FLUSH_INTERVAL, func() jobs.Job { return serialFlush{} })
+	}
+	for _, ip := range Health.BrasIPs() {
+		ip := ip
+		go Jobs.Every(ctx, Health.Interval(), func() jobs.Job { return basProbe{ip} })
+	}
+}
+
+//DrainJobs waits for the jobs queued up to config.Cfg.Jobs.DrainTimeout, the ones left are abandoned
+func DrainJobs() {
+	if Jobs == nil {
+		return
+	}
+	timeout := time.Duration(config.Cfg.Jobs.DrainTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = DEF_DRAIN_TIMEOUT
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	begin := time.Now()
+	if err := Jobs.Drain(ctx); err != nil {
+		logger.Warnw("jobs not drained in time", "timeout", timeout, "err", err)
+		return
+	}
+	logger.Infow("jobs drained", "cost", time.Since(begin))
+}
+
+func jobDone(job jobs.Job, result string, err error, cost time.Duration) {
+	jobRuns.Inc(job.Type(), result)
+	if cost > 0 {
+		jobDuration.Observe(cost.Seconds(), job.Type())
+	}
+	switch result {
+	case jobs.RESULT_FAILED:
+		logger.Warnw("job failed", "type", job.Type(), "job", job, "err", err)
+	case jobs.RESULT_REJECTED:
+		logger.Warnw("job not queued", "type", job.Type(), "err", err)
+	case jobs.RESULT_ABANDONED:
+		logger.Warnw("job abandoned on shutdown", "type", job.Type(), "job", job)
+	}
+}
+
+//deferLogout queues the logout of s for reason, the retries left to the queue
+func deferLogout(ctx context.Context, s session.Session, reason string) error {
+	if Jobs == nil {
+		return endSession(ctx, s, reason)
+	}
+	return Jobs.Submit(&logoutJob{s: s, reason: reason})
+}
+
+//logoutJob ends a session over its limits, unless it ended meanwhile
+type logoutJob struct {
+	s      session.Session
+	reason string
+}
+
+func (j *logoutJob) Type() string {
+	return JOB_LOGOUT
+}
+
+func (j *logoutJob) Key() string {
+	return JOB_LOGOUT + "/" + j.s.BrasIP + "/" + j.s.UserIP
+}
+
+func (j *logoutJob) String() string {
+	return j.s.BrasIP + "/" + j.s.UserIP + " " + j.reason
+}
+
+func (j *logoutJob) Run(ctx context.Context) error {
+	if s, ok := Sessions.Get(j.s.BrasIP, j.s.UserIP); !ok || !s.LoginTime.Equal(j.s.LoginTime) {
+		return nil
+	}
+	return endSession(ctx, j.s, j.reason)
+}
+
+//serialFlush saves the serial counters to the journal
+type serialFlush struct{}
+
+func (serialFlush) Type() string {
+	return JOB_SERIAL_FLUSH
+}
+
+func (serialFlush) Key() string {
+	return JOB_SERIAL_FLUSH
+}
+
+func (serialFlush) Run(ctx context.Context) error {
+	saveSerials()
+	return nil
+}
+
+//basProbe probes one BAS, not retried as the next round comes soon
+type basProbe struct {
+	brasIP string
+}
+
+func (j basProbe) Type() string {
+	return JOB_BAS_PROBE
+}
+
+func (j basProbe) Key() string {
+	return JOB_BAS_PROBE + "/" + j.brasIP
+}
+
+func (j basProbe) String() string {
+	return j.brasIP
+}
+
+func (j basProbe) MaxAttempts() int {
+	return 1
+}
+
+func (j basProbe) Run(ctx context.Context) error {
+	return Health.Probe(ctx, j.brasIP)
+}
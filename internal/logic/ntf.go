@@ -0,0 +1,119 @@
+package logic
+
+import (
+	"context"
+	"net"
+
+	"github.com/gityf/portalserver/internal/config"
+	"github.com/gityf/portalserver/internal/session"
+	"github.com/gityf/portalserver/internal/webhook"
+	"github.com/gityf/portalserver/portal"
+
+	logger "github.com/gityf/portalserver/xlog4go"
+)
+
+//ServeNtf answers the NTF_LOGOUT the BAS send to addr until ctx is done,
+//dropping the sessions they end
+func ServeNtf(ctx context.Context, addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	logger.Info("ntf listener at %v", conn.LocalAddr())
+	replayNtfs(conn)
+
+	buf := make([]byte, portal.MAX_PORTALPACKET_LEN)
+	for {
+		n, raddr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		handleNtf(conn, raddr.(*net.UDPAddr), append([]byte(nil), buf[:n]...))
+	}
+}
+
+func handleNtf(conn net.PacketConn, raddr *net.UDPAddr, raw []byte) {
+	ntf, err := parseNtf(raw)
+	log := logger.With("basaddr", raddr.String())
+	if err != nil {
+		log.Warnw("malformed packet on the ntf port", "err", err)
+		return
+	}
+	if ntf.PortalType != portal.PACKETTYPE_NTFLOGOUT {
+		log.Warnw("unexpected packet on the ntf port", "type", ntf.PortalTypeString())
+		return
+	}
+	if ntf.PortalVersion == portal.DEF_PORTAL_VERSION2 && !ntf.VerifyAuthenticator() {
+		log.Warnw("ntf_logout dropped, authenticator mismatch, check the shared secret", "userip", ntf.UserIPStr)
+		return
+	}
+	//acked and the session ended after a restart if the server stops in between
+	id, journaled := journalPending(session.Pending{Op: "ntf_logout", BrasIP: raddr.IP.String(), UserIP: ntf.UserIPStr,
+		Packet: raw, BasAddr: raddr.String()})
+	ntfLogout(conn, raddr, ntf, log)
+	donePending(id, journaled)
+}
+
+//replayNtfs acks the NTF_LOGOUT journaled but not answered when the server stopped, and ends their sessions
+func replayNtfs(conn net.PacketConn) {
+	pending := restoredNtfs
+	restoredNtfs = nil
+	for _, p := range pending {
+		raddr, err := net.ResolveUDPAddr("udp", p.BasAddr)
+		var ntf *portal.PortalPacket
+		if err == nil {
+			ntf, err = parseNtf(p.Packet)
+		}
+		if err != nil {
+			logger.Warnw("journaled ntf_logout dropped", "basaddr", p.BasAddr, "userip", p.UserIP, "err", err)
+		} else {
+			ntfLogout(conn, raddr, ntf, logger.With("basaddr", p.BasAddr, "replayed", true))
+		}
+		donePending(p.ID, true)
+	}
+}
+
+//parseNtf unmarshals a packet of the ntf port
+func parseNtf(raw []byte) (ntf *portal.PortalPacket, err error) {
+	version := uint(config.Cfg.PortalVersion)
+	if version != portal.DEF_PORTAL_VERSION1 {
+		version = portal.DEF_PORTAL_VERSION2
+	}
+	ntf = &portal.PortalPacket{
+		Raw:           raw,
+		PackageLen:    len(raw),
+		PortalVersion: version,
+		PackageType:   portal.PACKETTYPE_REQ,
+		SharedSecret:  config.Cfg.SharedSecret,
+	}
+	err = ntf.UnMarshal()
+	return
+}
+
+//ntfLogout acks the NTF_LOGOUT ntf of raddr and ends the session of its user
+func ntfLogout(conn net.PacketConn, raddr *net.UDPAddr, ntf *portal.PortalPacket, log *logger.Entry) {
+	if _, err := conn.WriteTo(portal.NtfLogoutAck(ntf, config.Cfg.SharedSecret).Marshal(), raddr); err != nil {
+		log.Errorw("ack_logout send failed", "userip", ntf.UserIPStr, "err", err)
+	}
+
+	//the session is kept under the address that took the login, under the primary
+	//when restored from a journal written before the logins kept their address
+	brasIP := raddr.IP.String()
+	s, ok := dropSession(brasIP, ntf.UserIPStr)
+	if primary := primaryBas(brasIP); !ok && primary != brasIP {
+		s, ok = dropSession(primary, ntf.UserIPStr)
+	}
+	if !ok {
+		s = session.Session{BrasIP: brasIP, UserIP: ntf.UserIPStr}
+	}
+	log.Infow("user logged out by the bas", "brasip", brasIP, "userip", ntf.UserIPStr, "known", ok)
+	emitEvent(sessionEvent(webhook.EVENT_NTF_LOGOUT, s))
+}
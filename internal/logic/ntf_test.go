@@ -0,0 +1,159 @@
+package logic
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gityf/portalserver/internal/config"
+	"github.com/gityf/portalserver/internal/session"
+	"github.com/gityf/portalserver/internal/webhook"
+	"github.com/gityf/portalserver/portal"
+)
+
+func TestHandleNtf(t *testing.T) {
+	defer func(c config.PortalServerConfig) {
+		config.Cfg = c
+		Sessions = session.NewStore()
+		Webhooks = nil
+	}(config.Cfg)
+	config.Cfg.SharedSecret = "secret"
+	config.Cfg.PortalVersion = portal.DEF_PORTAL_VERSION2
+	config.Cfg.BrasBackups = config.BrasBackupsConfig{"10.0.0.1": {"127.0.0.1"}}
+
+	events := make(chan webhook.Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e webhook.Event
+		json.NewDecoder(r.Body).Decode(&e)
+		events <- e
+	}))
+	defer srv.Close()
+	d, err := webhook.NewDispatcher(webhook.Options{URL: srv.URL})
+	if err != nil {
+		t.Fatalf("dispatcher err:%v", err)
+	}
+	defer d.Close()
+	Webhooks = d
+	Sessions = session.NewStore()
+	Sessions.Put(session.Session{BrasIP: "10.0.0.1", UserIP: "10.1.0.5", UserName: "bob", LoginTime: time.Now()})
+
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err:%v", err)
+	}
+	defer server.Close()
+	bas, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen err:%v", err)
+	}
+	defer bas.Close()
+
+	ntf := &portal.PortalPacket{
+		Version:       portal.DEF_PORTAL_VERSION2,
+		PortalVersion: portal.DEF_PORTAL_VERSION2,
+		PackageType:   portal.PACKETTYPE_REQ,
+		PortalType:    portal.PACKETTYPE_NTFLOGOUT,
+		SerialNo:      42,
+		UserIP:        10<<24 | 1<<16 | 5,
+		SharedSecret:  "secret",
+	}
+	handleNtf(server, bas.LocalAddr().(*net.UDPAddr), ntf.Marshal())
+
+	buf := make([]byte, portal.MAX_PORTALPACKET_LEN)
+	bas.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := bas.Read(buf)
+	if err != nil {
+		t.Fatalf("no ack:%v", err)
+	}
+	ack := &portal.PortalPacket{Raw: buf[:n], PortalVersion: portal.DEF_PORTAL_VERSION2}
+	if ack.UnMarshal() != nil || ack.PortalType != portal.PACKETTYPE_ACKLOGOUT || ack.SerialNo != 42 {
+		t.Errorf("unexpected ack %+v", ack)
+	}
+	if _, ok := Sessions.Get("10.0.0.1", "10.1.0.5"); ok {
+		t.Errorf("session of the standby address not dropped")
+	}
+	select {
+	case e := <-events:
+		if e.Type != webhook.EVENT_NTF_LOGOUT || e.UserName != "bob" || e.BrasIP != "10.0.0.1" || e.LoginTime == nil {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+}
+
+func TestReplayNtf(t *testing.T) {
+	defer func(c config.PortalServerConfig) {
+		config.Cfg = c
+		Sessions = session.NewStore()
+		Journal = nil
+	}(config.Cfg)
+	config.Cfg.SharedSecret = "secret"
+	config.Cfg.PortalVersion = portal.DEF_PORTAL_VERSION2
+	Sessions = session.NewStore()
+	Sessions.Put(session.Session{BrasIP: "127.0.0.1", UserIP: "10.1.0.5", UserName: "bob", LoginTime: time.Now()})
+
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err:%v", err)
+	}
+	defer server.Close()
+	bas, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen err:%v", err)
+	}
+	defer bas.Close()
+
+	//received before the restart, not acked
+	ntf := &portal.PortalPacket{
+		Version:       portal.DEF_PORTAL_VERSION2,
+		PortalVersion: portal.DEF_PORTAL_VERSION2,
+		PackageType:   portal.PACKETTYPE_REQ,
+		PortalType:    portal.PACKETTYPE_NTFLOGOUT,
+		SerialNo:      43,
+		UserIP:        10<<24 | 1<<16 | 5,
+		SharedSecret:  "secret",
+	}
+	dir := t.TempDir()
+	j, _, err := session.OpenJournal(dir, session.JournalOptions{SyncInterval: -1})
+	if err != nil {
+		t.Fatalf("open err:%v", err)
+	}
+	if _, err = j.Begin(session.Pending{Op: "ntf_logout", BrasIP: "127.0.0.1", UserIP: "10.1.0.5",
+		Packet: ntf.Marshal(), BasAddr: bas.LocalAddr().String()}); err != nil {
+		t.Fatalf("begin err:%v", err)
+	}
+	j.Close()
+
+	config.Cfg.Persist.Dir = dir
+	if err = SetupPersist(); err != nil {
+		t.Fatalf("setup err:%v", err)
+	}
+	replayNtfs(server)
+	ClosePersist()
+
+	buf := make([]byte, portal.MAX_PORTALPACKET_LEN)
+	bas.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := bas.Read(buf)
+	if err != nil {
+		t.Fatalf("no ack:%v", err)
+	}
+	ack := &portal.PortalPacket{Raw: buf[:n], PortalVersion: portal.DEF_PORTAL_VERSION2}
+	if ack.UnMarshal() != nil || ack.PortalType != portal.PACKETTYPE_ACKLOGOUT || ack.SerialNo != 43 {
+		t.Errorf("unexpected ack %+v", ack)
+	}
+	if Sessions.Len() != 0 {
+		t.Errorf("session not ended: %+v", Sessions.List(nil))
+	}
+	j, state, err := session.OpenJournal(dir, session.JournalOptions{})
+	if err != nil {
+		t.Fatalf("reopen err:%v", err)
+	}
+	j.Close()
+	if len(state.Pending) != 0 {
+		t.Errorf("ntf_logout still pending: %+v", state.Pending)
+	}
+}
@@ -0,0 +1,258 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gityf/portalserver/internal/config"
+	"github.com/gityf/portalserver/internal/session"
+	"github.com/gityf/portalserver/portal"
+
+	logger "github.com/gityf/portalserver/xlog4go"
+)
+
+const (
+	//serial no skipped after a restart, more than a BAS gets between two saves
+	DEF_SERIAL_SKIP = 4096
+	//REQ_INFO in flight while reconciling
+	RECONCILE_CONCURRENCY = 16
+)
+
+//Journal persists the sessions, serial counters and pending transactions, nil when off
+var Journal *session.Journal
+
+//pending logins and logouts found by SetupPersist, reconciled by Reconcile
+var restoredPending []session.Pending
+
+//AFF_ACK_AUTH owed and NTF_LOGOUT not acked found by SetupPersist, sent by ReplayAffAcks and ServeNtf
+var restoredAffAcks, restoredNtfs []session.Pending
+
+//SetupPersist opens the journal of config.Cfg.Persist and restores its state,
+//nothing is done when no dir is set
+func SetupPersist() error {
+	pc := config.Cfg.Persist
+	if pc.Dir == "" {
+		return nil
+	}
+	j, state, err := session.OpenJournal(pc.Dir, session.JournalOptions{
+		CompactEvery: pc.CompactEvery,
+		SyncInterval: time.Duration(pc.SyncInterval) * time.Millisecond,
+	})
+	if err != nil {
+		return err
+	}
+	Journal = j
+	for _, s := range state.Sessions {
+		Sessions.Put(s)
+	}
+	for ip, next := range state.Serials {
+		portal.RestoreSerialAllocator(ip, next, DEF_SERIAL_SKIP)
+	}
+	for _, p := range state.Pending {
+		switch p.Op {
+		case "aff_ack_auth":
+			restoredAffAcks = append(restoredAffAcks, p)
+		case "ntf_logout":
+			restoredNtfs = append(restoredNtfs, p)
+		default:
+			restoredPending = append(restoredPending, p)
+		}
+	}
+	logger.Infow("state restored", "dir", pc.Dir, "sessions", len(state.Sessions),
+		"serials", len(state.Serials), "pending", len(state.Pending))
+	return nil
+}
+
+//saveSerials records the serial counters of every BAS, every second by the JOB_SERIAL_FLUSH jobs
+func saveSerials() {
+	for ip, next := range portal.SerialAllocatorsNext() {
+		if err := Journal.SetSerial(ip, next); err != nil {
+			logger.Errorw("journal serial save failed", "brasip", ip, "err", err)
+		}
+	}
+}
+
+//ClosePersist saves the serial counters and compacts the journal
+func ClosePersist() {
+	if Journal == nil {
+		return
+	}
+	saveSerials()
+	if err := Journal.Close(); err != nil {
+		logger.Errorw("journal close failed", "err", err)
+	}
+}
+
+//beginPending journals a transaction about to be sent to brasIP, 0 when there is no journal
+func beginPending(op, brasIP, userIP, userName string) (id uint64, ok bool) {
+	return journalPending(session.Pending{Op: op, BrasIP: brasIP, UserIP: userIP, UserName: userName})
+}
+
+//journalPending journals p started now, 0 when there is no journal
+func journalPending(p session.Pending) (id uint64, ok bool) {
+	if Journal == nil {
+		return
+	}
+	p.Started = time.Now()
+	id, err := Journal.Begin(p)
+	if err != nil {
+		logger.Errorw("journal begin failed", "op", p.Op, "userip", p.UserIP, "err", err)
+		return
+	}
+	return id, true
+}
+
+//ReplayAffAcks sends the AFF_ACK_AUTH the logins owed when the server stopped
+func ReplayAffAcks(ctx context.Context) {
+	pending := restoredAffAcks
+	restoredAffAcks = nil
+	for _, p := range pending {
+		client, err := GetPortalClient(p.BrasIP)
+		if err == nil {
+			err = client.SendAffAckAuth(ctx, portal.AffAckAuth{BasIP: p.BrasIP, UserIP: p.UserIP, SerialNo: p.SerialNo, ReqID: p.ReqID})
+		}
+		if err != nil {
+			logger.Warnw("owed aff_ack_auth not sent", "brasip", p.BrasIP, "userip", p.UserIP, "err", err)
+		} else {
+			logger.Infow("owed aff_ack_auth sent", "brasip", p.BrasIP, "userip", p.UserIP, "serialno", p.SerialNo)
+		}
+		//sent once, the BAS never acks it
+		donePending(p.ID, true)
+	}
+}
+
+func donePending(id uint64, ok bool) {
+	if !ok {
+		return
+	}
+	if err := Journal.Done(id); err != nil {
+		logger.Errorw("journal done failed", "id", id, "err", err)
+	}
+}
+
+//presence of a user on the BAS, as REQ_INFO tells
+const (
+	presenceUnknown = iota //no verified ack
+	presenceOnline
+	presenceOffline
+)
+
+//userPresence asks the address brasIP about the user ip: errcode 0 means online, errcode 1 that the BAS
+//does not support REQ_INFO and tells nothing, a higher errcode that it does not know the user
+func userPresence(ctx context.Context, brasIP, userIP string) (presence int, err error) {
+	client, err := GetPortalClient(brasIP)
+	if err != nil {
+		return
+	}
+	_, err = client.InfoAt(ctx, brasIP, userIP)
+	var pe *portal.Error
+	switch {
+	case err == nil:
+		presence = presenceOnline
+	case errors.As(err, &pe) && pe.Failure == portal.PCMFAIL_NONE && pe.Code != portal.PCMERR_UNKNOWN:
+		presence = presenceOffline
+	}
+	return
+}
+
+//loginPresence asks each address of the BAS of brasIP about the user ip, it returns the
+//address the user is online on, or offline when every address tells so
+func loginPresence(ctx context.Context, brasIP, userIP string) (at string, presence int, err error) {
+	at, presence = brasIP, presenceOffline
+	for _, ip := range basAddrs(brasIP) {
+		p, e := userPresence(ctx, ip, userIP)
+		switch p {
+		case presenceOnline:
+			return ip, p, nil
+		case presenceUnknown:
+			presence, err = p, e
+		}
+	}
+	return
+}
+
+//Reconcile checks the restored sessions and pending transactions against the BAS by REQ_INFO:
+//the sessions the BAS does not know are dropped, the logins it acked are added. Whatever
+//can not be checked is kept as it was.
+func Reconcile(ctx context.Context) {
+	if Journal == nil {
+		return
+	}
+	sessions := Sessions.List(nil)
+	pending := restoredPending
+	restoredPending = nil
+	begin := time.Now()
+	var (
+		mu                         sync.Mutex
+		kept, dropped, added, left int
+	)
+	count := func(n *int) {
+		mu.Lock()
+		*n++
+		mu.Unlock()
+	}
+
+	sem := make(chan struct{}, RECONCILE_CONCURRENCY)
+	var wg sync.WaitGroup
+	run := func(f func()) {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			f()
+		}()
+	}
+	for _, s := range sessions {
+		s := s
+		run(func() {
+			presence, err := userPresence(ctx, s.BrasIP, s.UserIP)
+			switch presence {
+			case presenceOffline:
+				dropSession(s.BrasIP, s.UserIP)
+				logger.Infow("restored session gone from the bas", "brasip", s.BrasIP, "userip", s.UserIP)
+				count(&dropped)
+			case presenceUnknown:
+				logger.Warnw("restored session not verified", "brasip", s.BrasIP, "userip", s.UserIP, "err", err)
+				count(&kept)
+			default:
+				count(&kept)
+			}
+		})
+	}
+	for _, p := range pending {
+		p := p
+		run(func() {
+			var (
+				presence int
+				err      error
+			)
+			if p.Op == "login" {
+				//a standby address may have taken the login
+				p.BrasIP, presence, err = loginPresence(ctx, p.BrasIP, p.UserIP)
+			} else {
+				presence, err = userPresence(ctx, p.BrasIP, p.UserIP)
+			}
+			if presence == presenceUnknown {
+				//asked again after the next restart
+				logger.Warnw("pending transaction not verified", "op", p.Op, "brasip", p.BrasIP,
+					"userip", p.UserIP, "err", err)
+				count(&left)
+				return
+			}
+			switch {
+			case p.Op == "login" && presence == presenceOnline:
+				addSession(session.Session{UserIP: p.UserIP, BrasIP: p.BrasIP, UserName: p.UserName, LoginTime: p.Started})
+				count(&added)
+			case p.Op == "logout" && presence == presenceOffline:
+				dropSession(p.BrasIP, p.UserIP)
+				count(&dropped)
+			}
+			donePending(p.ID, true)
+		})
+	}
+	wg.Wait()
+	logger.Infow("state reconciled", "kept", kept, "dropped", dropped, "added", added,
+		"unverified_pending", left, "cost", time.Since(begin))
+}
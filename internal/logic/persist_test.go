@@ -0,0 +1,63 @@
+package logic
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gityf/portalserver/internal/config"
+	"github.com/gityf/portalserver/internal/session"
+	"github.com/gityf/portalserver/portal"
+	"github.com/gityf/portalserver/portal/portaltest"
+)
+
+func TestReconcile(t *testing.T) {
+	defer func(c config.PortalServerConfig) {
+		config.Cfg = c
+		portalClients = make(map[string]*portal.Client)
+		Sessions = session.NewStore()
+	}(config.Cfg)
+	config.Cfg.SharedSecret = "secret"
+	config.Cfg.Timeout = 200
+	config.Cfg.RetryTime = 1
+
+	for _, c := range []struct {
+		errCode      uint8
+		wantSessions int //of the restored one and the pending login
+		wantPending  int
+	}{
+		{0, 2, 0}, //both online
+		{1, 1, 1}, //REQ_INFO not supported, nothing verified
+		{2, 0, 0}, //both unknown to the BAS
+	} {
+		port, stop := portaltest.FakeBAS(t, "secret", infoAck(c.errCode, ""))
+		config.Cfg.BrasPort = port
+		portalClients = make(map[string]*portal.Client)
+		Sessions = session.NewStore()
+
+		dir := t.TempDir()
+		j, _, err := session.OpenJournal(dir, session.JournalOptions{SyncInterval: -1})
+		if err != nil {
+			t.Fatalf("open err:%v", err)
+		}
+		Journal = j
+		addSession(session.Session{BrasIP: "127.0.0.1", UserIP: "10.0.0.1", LoginTime: time.Now()})
+		id, _ := j.Begin(session.Pending{Op: "login", BrasIP: "127.0.0.1", UserIP: "10.0.0.2", Started: time.Now()})
+		restoredPending = []session.Pending{{ID: id, Op: "login", BrasIP: "127.0.0.1", UserIP: "10.0.0.2"}}
+
+		Reconcile(context.Background())
+		stop()
+		j.Close()
+		Journal = nil
+
+		j, state, err := session.OpenJournal(dir, session.JournalOptions{})
+		if err != nil {
+			t.Fatalf("reopen err:%v", err)
+		}
+		j.Close()
+		if Sessions.Len() != c.wantSessions || len(state.Sessions) != c.wantSessions || len(state.Pending) != c.wantPending {
+			t.Errorf("errcode %v: sessions %v journaled %v pending %v", c.errCode,
+				Sessions.Len(), len(state.Sessions), len(state.Pending))
+		}
+	}
+}
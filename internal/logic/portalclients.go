@@ -0,0 +1,184 @@
+package logic
+
+import (
+	"context"
+	"github.com/gityf/portalserver/internal/config"
+	"github.com/gityf/portalserver/internal/portalctx"
+	"github.com/gityf/portalserver/internal/global"
+	"github.com/gityf/portalserver/internal/metrics"
+	"github.com/gityf/portalserver/portal"
+	"sync"
+	"time"
+
+	logger "github.com/gityf/portalserver/xlog4go"
+)
+
+var (
+	portalClientsMu sync.Mutex
+	portalClients   = make(map[string]*portal.Client)
+
+	breakerState = metrics.NewGauge("portal_bas_breaker_state",
+		"Circuit breaker of each BAS address, 0 closed, 1 open, 2 half-open.", "brasip")
+)
+
+//GetPortalClient returns the client of the BAS, config.Cfg.BrasIP when brasIP is empty.
+//A standby address of config.Cfg.BrasBackups gives the client of its primary
+func GetPortalClient(brasIP string) (client *portal.Client, err error) {
+	if brasIP == "" {
+		brasIP = config.Cfg.BrasIP
+	}
+	brasIP = primaryBas(brasIP)
+	portalClientsMu.Lock()
+	defer portalClientsMu.Unlock()
+	if client = portalClients[brasIP]; client != nil {
+		return
+	}
+	client, err = portal.NewClient(portal.Options{
+		BasIP:            brasIP,
+		BasPort:          config.Cfg.BrasPort,
+		SharedSecret:     config.Cfg.SharedSecret,
+		Version:          uint(config.Cfg.PortalVersion),
+		AuthMode:         config.Cfg.AuthType,
+		IsSendAffAckAuth: config.Cfg.AffAckAuth,
+		Retry:            NewRetryPolicy(),
+		Logger:           portalLogger{logger.Module(portal.LOG_MODULE_CLIENT)},
+		Capture:          PacketCapture,
+		Backups:          config.Cfg.BrasBackups[brasIP],
+		Breaker:          newBreakerOptions(),
+	})
+	if err != nil {
+		return
+	}
+	portalClients[brasIP] = client
+	return
+}
+
+//primaryBas returns the BAS ip of which ip is a standby address, ip itself when none
+func primaryBas(ip string) string {
+	for primary, backups := range config.Cfg.BrasBackups {
+		for _, backup := range backups {
+			if backup == ip {
+				return primary
+			}
+		}
+	}
+	return ip
+}
+
+//basAddrs returns the addresses of the BAS of brasIP, the primary then the standby ones
+func basAddrs(brasIP string) []string {
+	primary := primaryBas(brasIP)
+	return append([]string{primary}, config.Cfg.BrasBackups[primary]...)
+}
+
+//newBreakerOptions builds the breaker options from config.Cfg, nil when off
+func newBreakerOptions() *portal.BreakerOptions {
+	bc := config.Cfg.Breaker
+	if bc.Off {
+		return nil
+	}
+	return &portal.BreakerOptions{
+		Threshold:     bc.Threshold,
+		Cooldown:      time.Duration(bc.Cooldown) * time.Second,
+		OnStateChange: breakerChanged,
+	}
+}
+
+func breakerChanged(basIP string, from, to int) {
+	breakerState.Set(float64(to), basIP)
+	if to == portal.BREAKER_OPEN {
+		logger.Errorw("bas circuit open, requests fail fast", "brasip", basIP,
+			"from", portal.BreakerStateString(from))
+		return
+	}
+	logger.Warnw("bas circuit "+portal.BreakerStateString(to), "brasip", basIP,
+		"from", portal.BreakerStateString(from))
+}
+
+//PortalClients returns the clients created so far, by BAS ip
+func PortalClients() map[string]*portal.Client {
+	portalClientsMu.Lock()
+	defer portalClientsMu.Unlock()
+	clients := make(map[string]*portal.Client, len(portalClients))
+	for ip, client := range portalClients {
+		clients[ip] = client
+	}
+	return clients
+}
+
+//NewRetryPolicy builds the retry policy from config.Cfg
+func NewRetryPolicy() *portal.RetryPolicy {
+	rc := config.Cfg.Retry
+	r := &portal.RetryPolicy{
+		MaxAttempts:             config.Cfg.RetryTime,
+		Timeout:                 time.Duration(config.Cfg.Timeout) * time.Millisecond,
+		StepTimeout:             make(map[uint8]time.Duration),
+		BackoffBase:             time.Duration(rc.BackoffBase) * time.Millisecond,
+		BackoffMax:              time.Duration(rc.BackoffMax) * time.Millisecond,
+		Jitter:                  rc.Jitter,
+		Deadline:                time.Duration(rc.Deadline) * time.Millisecond,
+		RetryOnBadAuthenticator: rc.RetryOnBadAuthenticator,
+	}
+	for name, ms := range rc.StepTimeout {
+		if reqType, ok := portal.ReqTypeByName(name); ok && ms > 0 {
+			r.StepTimeout[reqType] = time.Duration(ms) * time.Millisecond
+		} else {
+			logger.Warn("ignore step timeout %v:%v", name, ms)
+		}
+	}
+	r.Normalize()
+	return r
+}
+
+//GetUserErrCode maps the error of the portal client to USER_RET_ERR_*
+func GetUserErrCode(err error) (userErrCode int32) {
+	switch portal.ErrorCode(err) {
+	case portal.PCMERR_OK:
+		userErrCode = global.USER_RET_ERR_OK
+	case portal.PCMERR_UNKNOWN:
+		userErrCode = global.USER_RET_ERR_UNKNOWN
+	case portal.PCMERR_CHALLENGEREFUSED:
+		userErrCode = global.USER_RET_ERR_CHALLENGE_REFUSED
+	case portal.PCMERR_CONNECTCREATED:
+		userErrCode = global.USER_RET_ERR_BAS_CONNECTCREATED
+	case portal.PCMERR_SAMEUSERAUTHING:
+		userErrCode = global.USER_RET_ERR_BAS_SAMEUSERAUTHING
+	case portal.PCMERR_AUTHREFUSED:
+		userErrCode = global.USER_RET_ERR_BAS_LOGIN_REFUSED
+	case portal.PCMERR_RECVTIMEOUT:
+		userErrCode = global.USER_RET_ERR_SEND_FAILED
+	case portal.PCMERR_LOGOUTREFUSED:
+		userErrCode = global.USER_RET_ERR_BAS_LOGOUT_REFUSED
+	case portal.PCMERR_CANCELED:
+		//the caller is gone, nothing more was sent
+		userErrCode = global.USER_RET_ERR_SEND_FAILED
+	default:
+		userErrCode = global.USER_RET_ERR_UNKNOWN
+	}
+	return
+}
+
+//portalLogger lets the portal client add its serialno to the fields of an entry,
+//and log each of its modules with the level of that module
+type portalLogger struct {
+	*logger.Entry
+}
+
+func (l portalLogger) WithField(key string, value interface{}) portal.Logger {
+	return portalLogger{l.Entry.With(key, value)}
+}
+
+func (l portalLogger) Module(name string) portal.Logger {
+	return portalLogger{l.Entry.Module(name)}
+}
+
+//transactionLog returns the entry of the request with the user and BAS address fields,
+//and the context making the portal client log the transaction to it
+func transactionLog(msg *portalctx.Message, brasIP string) (log *logger.Entry, ctx context.Context) {
+	log = logger.FromContext(msg.Context()).With("userip", msg.UserIP, "brasip", brasIP)
+	if msg.UserName != "" {
+		log = log.With("username", msg.UserName)
+	}
+	ctx = portal.ContextWithLogger(msg.Context(), portalLogger{log.Module(portal.LOG_MODULE_CLIENT)})
+	return
+}
@@ -0,0 +1,161 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/gityf/portalserver/internal/config"
+	"github.com/gityf/portalserver/internal/metrics"
+	"github.com/gityf/portalserver/internal/session"
+	"github.com/gityf/portalserver/internal/sessiontimer"
+	"github.com/gityf/portalserver/internal/webhook"
+
+	logger "github.com/gityf/portalserver/xlog4go"
+)
+
+//SessionTimer ends the sessions over the limits of config.Cfg.Limits, see SetupSessionLimits
+var SessionTimer *sessiontimer.Timer
+
+//sessions logged out by the server by group and reason, sessiontimer.REASON_* or KICK_REASON_ADMIN
+var sessionTerminations = metrics.NewCounter("portal_session_terminations_total",
+	"Sessions logged out by the server, by group and reason.", "group", "reason")
+
+//SetupSessionLimits checks config.Cfg.Limits, the checks run once SessionTimer.Run is called
+//and the logouts as jobs once SetupJobs is
+func SetupSessionLimits() error {
+	lc := config.Cfg.Limits
+	for i, g := range lc.Groups {
+		if g.Name == "" {
+			return fmt.Errorf("session_limits group %d without name", i)
+		}
+		if g.MaxDuration < 0 || g.IdleTimeout < 0 || g.IdleBytes < 0 {
+			return fmt.Errorf("session_limits group %v with a negative limit", g.Name)
+		}
+		for _, pattern := range g.UserNames {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("session_limits group %v: bad username pattern %q", g.Name, pattern)
+			}
+		}
+	}
+	SessionTimer = sessiontimer.NewTimer(sessiontimer.Options{
+		Interval: time.Duration(lc.Interval) * time.Second,
+		Sessions: func() []session.Session { return Sessions.List(nil) },
+		Limits:   sessionLimits,
+		Usage:    sessionUsage,
+		Logout:   deferLogout,
+	})
+	return nil
+}
+
+//limitGroup returns the first group of config.Cfg.Limits matching the login, nil when none.
+//A group of a BAS matches the logins taken by its standby addresses too
+func limitGroup(userName, ssid, brasIP string) *config.LimitGroupConfig {
+	groups := config.Cfg.Limits.Groups
+	for i := range groups {
+		g := &groups[i]
+		if matchAny(g.UserNames, userName, true) && matchAny(g.SSIDs, ssid, false) &&
+			(matchAny(g.BrasIPs, brasIP, false) || matchAny(g.BrasIPs, primaryBas(brasIP), false)) {
+			return g
+		}
+	}
+	return nil
+}
+
+//matchAny tells whether value is in list, by path.Match patterns when glob, an empty list matches all
+func matchAny(list []string, value string, glob bool) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+		if glob {
+			if ok, _ := path.Match(v, value); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//sessionLimits of the group of s, the online time granted at login shortening the maximum duration
+func sessionLimits(s session.Session) (limits sessiontimer.Limits) {
+	if g := limitGroup(s.UserName, s.SSID, s.BrasIP); g != nil {
+		limits.MaxDuration = time.Duration(g.MaxDuration) * time.Second
+		limits.IdleTimeout = time.Duration(g.IdleTimeout) * time.Second
+		limits.IdleBytes = uint64(g.IdleBytes)
+	}
+	if granted := time.Duration(s.OnlineTime) * time.Second; granted > 0 &&
+		(limits.MaxDuration == 0 || granted < limits.MaxDuration) {
+		limits.MaxDuration = granted
+	}
+	return
+}
+
+//sessionUsage asks the BAS for the flux and delay time of the user by REQ_INFO
+func sessionUsage(ctx context.Context, s session.Session) (usage sessiontimer.Usage, err error) {
+	client, err := GetPortalClient(s.BrasIP)
+	if err != nil {
+		return
+	}
+	res, err := client.InfoAt(ctx, s.BrasIP, s.UserIP)
+	if err != nil {
+		logger.Debugw("session usage unknown", "brasip", s.BrasIP, "userip", s.UserIP, "err", err)
+		return
+	}
+	usage.Bytes, usage.HasBytes = res.Usage.UplinkFlux+res.Usage.DownlinkFlux, res.Usage.HasFlux
+	usage.Idle, usage.HasIdle = res.Usage.DelayTime, res.Usage.HasDelayTime
+	return
+}
+
+//KICK_REASON_ADMIN is the reason of the sessions ended by Kick
+const KICK_REASON_ADMIN = "admin"
+
+var ErrNoSession = errors.New("no session of the user")
+
+//Kick logs the user out of the BAS on behalf of an admin, config.Cfg.BrasIP when brasIP is empty.
+//The session is found on any address of that BAS
+func Kick(ctx context.Context, brasIP, userIP string) error {
+	if brasIP == "" {
+		brasIP = config.Cfg.BrasIP
+	}
+	s, ok := basSession(brasIP, userIP)
+	if !ok {
+		return ErrNoSession
+	}
+	return endSession(ctx, s, KICK_REASON_ADMIN)
+}
+
+//endSession logs s out of the BAS for reason, a logout failing for a user the BAS no longer knows ends the session too
+func endSession(ctx context.Context, s session.Session, reason string) error {
+	client, err := GetPortalClient(s.BrasIP)
+	if err != nil {
+		return err
+	}
+	id, journaled := beginPending("logout", s.BrasIP, s.UserIP, s.UserName)
+	_, err = client.LogoutAt(ctx, s.BrasIP, s.UserName, s.UserIP)
+	donePending(id, journaled)
+	if err != nil {
+		if presence, _ := userPresence(ctx, s.BrasIP, s.UserIP); presence != presenceOffline {
+			logger.Warnw("session not logged out by the server", "brasip", s.BrasIP, "userip", s.UserIP,
+				"reason", reason, "err", err)
+			return err
+		}
+	}
+	dropSession(s.BrasIP, s.UserIP)
+	group := s.Group
+	if group == "" {
+		group = "none"
+	}
+	sessionTerminations.Inc(group, reason)
+	e := sessionEvent(webhook.EVENT_KICK, s)
+	e.Reason = reason
+	emitEvent(e)
+	logger.Infow("session ended by the server", "brasip", s.BrasIP, "userip", s.UserIP, "username", s.UserName,
+		"group", group, "reason", reason, "online", time.Since(s.LoginTime).Round(time.Second))
+	return nil
+}
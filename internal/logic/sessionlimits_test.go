@@ -0,0 +1,33 @@
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gityf/portalserver/internal/config"
+	"github.com/gityf/portalserver/internal/session"
+)
+
+func TestSessionLimits(t *testing.T) {
+	defer func(c config.PortalServerConfig) { config.Cfg = c }(config.Cfg)
+	config.Cfg.Limits.Groups = []config.LimitGroupConfig{
+		{Name: "guest", UserNames: []string{"guest-*"}, SSIDs: []string{"Guest"}, MaxDuration: 4 * 3600, IdleTimeout: 1800},
+		{Name: "staff", BrasIPs: []string{"10.0.0.1"}, IdleTimeout: 3600},
+	}
+	for _, c := range []struct {
+		s    session.Session
+		max  time.Duration
+		idle time.Duration
+	}{
+		{session.Session{UserName: "guest-42", SSID: "Guest", BrasIP: "10.0.0.2"}, 4 * time.Hour, 30 * time.Minute},
+		{session.Session{UserName: "guest-42", SSID: "Guest", OnlineTime: 3600}, time.Hour, 30 * time.Minute},
+		{session.Session{UserName: "guest-42", SSID: "Staff", BrasIP: "10.0.0.1"}, 0, time.Hour},
+		{session.Session{UserName: "bob", BrasIP: "10.0.0.2"}, 0, 0},
+		{session.Session{UserName: "bob", BrasIP: "10.0.0.2", OnlineTime: 600}, 10 * time.Minute, 0},
+	} {
+		limits := sessionLimits(c.s)
+		if limits.MaxDuration != c.max || limits.IdleTimeout != c.idle {
+			t.Errorf("%+v: limits %+v, want max %v idle %v", c.s, limits, c.max, c.idle)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package logic
+
+import (
+	"time"
+
+	"github.com/gityf/portalserver/internal/metrics"
+	"github.com/gityf/portalserver/internal/portalctx"
+	"github.com/gityf/portalserver/internal/session"
+	"github.com/gityf/portalserver/internal/webhook"
+
+	logger "github.com/gityf/portalserver/xlog4go"
+)
+
+//Sessions of the users logged in through this server
+var Sessions = session.NewStore()
+
+//transactions with the BAS by type and USER_RET_ERR_*
+var basTransactions = metrics.NewCounter("portal_bas_transactions_total",
+	"Transactions with the BAS by type and errno.", "type", "errno")
+
+func init() {
+	metrics.NewGaugeFunc("portal_sessions", "Users logged in through this server.", func() float64 {
+		return float64(Sessions.Len())
+	})
+}
+
+//loggedIn keeps the session of the user of msg on the address brasIP that took the login,
+//with its group of the session limits
+func loggedIn(msg *portalctx.Message, brasIP string) {
+	s := session.Session{
+		UserIP:    msg.UserIP,
+		BrasIP:    brasIP,
+		UserName:  msg.UserName,
+		UserMac:   msg.UserMac,
+		AcName:    msg.AcName,
+		SSID:      msg.SSID,
+		LoginTime: time.Now(),
+	}
+	if g := limitGroup(s.UserName, s.SSID, s.BrasIP); g != nil {
+		s.Group = g.Name
+	}
+	if msg.OnlineTime > 0 {
+		s.OnlineTime = msg.OnlineTime
+	}
+	addSession(s)
+}
+
+//loggedOut drops the session of the user of msg on the address brasIP and sends its logout event
+func loggedOut(msg *portalctx.Message, brasIP string) {
+	s, ok := dropSession(brasIP, msg.UserIP)
+	if !ok {
+		//logged in before the sessions were kept
+		s = session.Session{UserIP: msg.UserIP, BrasIP: brasIP, UserName: msg.UserName, UserMac: msg.UserMac}
+	}
+	emitEvent(sessionEvent(webhook.EVENT_LOGOUT, s))
+}
+
+//basSession returns the session of the user on any address of the BAS of brasIP
+func basSession(brasIP, userIP string) (s session.Session, ok bool) {
+	for _, ip := range basAddrs(brasIP) {
+		if s, ok = Sessions.Get(ip, userIP); ok {
+			return
+		}
+	}
+	return
+}
+
+//addSession keeps s in Sessions and in the journal if any
+func addSession(s session.Session) {
+	Sessions.Put(s)
+	if Journal != nil {
+		if err := Journal.Put(s); err != nil {
+			logger.Errorw("journal session put failed", "brasip", s.BrasIP, "userip", s.UserIP, "err", err)
+		}
+	}
+}
+
+//dropSession removes the session from Sessions and from the journal if any, ok tells whether it was kept
+func dropSession(brasIP, userIP string) (s session.Session, ok bool) {
+	s, ok = Sessions.Delete(brasIP, userIP)
+	if Journal != nil {
+		if err := Journal.Delete(brasIP, userIP); err != nil {
+			logger.Errorw("journal session delete failed", "brasip", brasIP, "userip", userIP, "err", err)
+		}
+	}
+	return
+}
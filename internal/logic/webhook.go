@@ -0,0 +1,153 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/gityf/portalserver/internal/config"
+	"github.com/gityf/portalserver/internal/global"
+	"github.com/gityf/portalserver/internal/metrics"
+	"github.com/gityf/portalserver/internal/portalctx"
+	"github.com/gityf/portalserver/internal/session"
+	"github.com/gityf/portalserver/internal/webhook"
+
+	logger "github.com/gityf/portalserver/xlog4go"
+)
+
+//Webhooks delivers the events of config.Cfg.Webhook, nil when off
+var Webhooks *webhook.Dispatcher
+
+//types of event sent, every type when empty
+var webhookTypes map[string]bool
+
+var (
+	//events by type and webhook.RESULT_*
+	webhookEvents = metrics.NewCounter("portal_webhook_events_total",
+		"Webhook events by type and delivery result.", "type", "result")
+	//writes of the backlog and the dead letters failed, by webhook.OP_*
+	webhookBacklogErrors = metrics.NewCounter("portal_webhook_backlog_errors_total",
+		"Webhook backlog and dead letter writes failed, by op.", "op")
+)
+
+func init() {
+	metrics.NewGaugeFunc("portal_webhook_backlog", "Webhook events not delivered yet.", func() float64 {
+		if Webhooks == nil {
+			return 0
+		}
+		return float64(Webhooks.Pending())
+	})
+}
+
+//SetupWebhooks starts the dispatcher of config.Cfg.Webhook on the Jobs of SetupJobs,
+//the events of its backlog are sent again
+func SetupWebhooks() error {
+	wc := config.Cfg.Webhook
+	if wc.URL == "" {
+		return nil
+	}
+	if u, err := url.Parse(wc.URL); err != nil || u.Host == "" || u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid webhook url %q", wc.URL)
+	}
+	types := make(map[string]bool)
+	for _, t := range wc.Events {
+		switch t {
+		case webhook.EVENT_LOGIN, webhook.EVENT_LOGIN_FAILED, webhook.EVENT_LOGOUT,
+			webhook.EVENT_NTF_LOGOUT, webhook.EVENT_KICK:
+			types[t] = true
+		default:
+			return fmt.Errorf("unknown webhook event %q", t)
+		}
+	}
+	d, err := webhook.NewDispatcher(webhook.Options{
+		URL:          wc.URL,
+		Secret:       wc.Secret,
+		Dir:          wc.Dir,
+		Timeout:      time.Duration(wc.Timeout) * time.Millisecond,
+		MaxAttempts:  wc.MaxAttempts,
+		Queue:        Jobs,
+		MaxBacklog:   wc.MaxBacklog,
+		SyncInterval: time.Duration(wc.SyncInterval) * time.Millisecond,
+		OnResult:     webhookResult,
+		OnError:      webhookBacklogError,
+	})
+	if err != nil {
+		return err
+	}
+	Webhooks, webhookTypes = d, types
+	logger.Infow("webhook dispatcher started", "url", wc.URL, "backlog", d.Pending())
+	return nil
+}
+
+//CloseWebhooks stops the deliveries, the events not delivered are kept for the next start
+func CloseWebhooks() {
+	if Webhooks == nil {
+		return
+	}
+	if err := Webhooks.Close(); err != nil {
+		logger.Errorw("webhook backlog save failed", "err", err)
+	}
+}
+
+func webhookResult(e webhook.Event, result string, err error) {
+	webhookEvents.Inc(e.Type, result)
+	switch result {
+	case webhook.RESULT_RETRY:
+		logger.Warnw("webhook delivery failed, retrying", "id", e.ID, "type", e.Type, "userip", e.UserIP, "err", err)
+	case webhook.RESULT_DEAD:
+		logger.Errorw("webhook event given up", "id", e.ID, "type", e.Type, "userip", e.UserIP, "err", err)
+	}
+}
+
+func webhookBacklogError(op string, err error) {
+	webhookBacklogErrors.Inc(op)
+	logger.Errorw("webhook backlog write failed", "op", op, "err", err)
+}
+
+//emitEvent queues e when its type is sent, it never waits for the receiver
+func emitEvent(e webhook.Event) {
+	if Webhooks == nil || len(webhookTypes) > 0 && !webhookTypes[e.Type] {
+		return
+	}
+	err := Webhooks.Emit(e)
+	switch {
+	case errors.Is(err, webhook.ErrBacklog):
+		webhookBacklogErrors.Inc(webhook.OP_WRITE)
+		logger.Errorw("webhook event not kept in the backlog", "type", e.Type, "userip", e.UserIP, "err", err)
+	case err != nil:
+		logger.Warnw("webhook event not queued", "type", e.Type, "userip", e.UserIP, "err", err)
+	}
+}
+
+//loginEvent of the login of msg on the address brasIP answered by resp
+func loginEvent(msg *portalctx.Message, brasIP string, resp *portalctx.BaseResponse) webhook.Event {
+	e := webhook.Event{
+		Type:     webhook.EVENT_LOGIN,
+		UserName: msg.UserName,
+		UserIP:   msg.UserIP,
+		UserMac:  msg.UserMac,
+		BrasIP:   brasIP,
+		Errno:    int(resp.Errno),
+		Errmsg:   resp.Errmsg,
+	}
+	if resp.Errno != global.USER_RET_ERR_OK {
+		e.Type = webhook.EVENT_LOGIN_FAILED
+	}
+	return e
+}
+
+//sessionEvent of the end of s, without login time when not known
+func sessionEvent(eventType string, s session.Session) webhook.Event {
+	e := webhook.Event{
+		Type:     eventType,
+		UserName: s.UserName,
+		UserIP:   s.UserIP,
+		UserMac:  s.UserMac,
+		BrasIP:   s.BrasIP,
+	}
+	if !s.LoginTime.IsZero() {
+		e.LoginTime = &s.LoginTime
+	}
+	return e
+}
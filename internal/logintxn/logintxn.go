@@ -0,0 +1,179 @@
+package logintxn
+
+/*
+	transactions of the asynchronous logins: the PCMSTATUS_* stage each one reached and its
+	result, kept for a while once done so that the pages polling them get the answer
+*/
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gityf/portalserver/portal"
+)
+
+const (
+	DEF_TTL         = 5 * time.Minute //of a transaction done
+	DEF_MAX_PENDING = 10000
+
+	//between two scans for the transactions past the TTL
+	PRUNE_INTERVAL = time.Second
+)
+
+var ErrTooMany = errors.New("too many logins pending")
+
+//Status of a transaction
+type Status struct {
+	ID      string    `json:"id"`
+	Status  uint8     `json:"status"` //PCMSTATUS_* reached
+	Stage   string    `json:"stage"`  //name of Status
+	Done    bool      `json:"done"`
+	Errno   int32     `json:"errno"` //USER_RET_ERR_* of the login once done
+	Errmsg  string    `json:"errmsg,omitempty"`
+	Version int       `json:"version"` //increased by each change
+	Started time.Time `json:"started"`
+	Updated time.Time `json:"updated"`
+}
+
+type txn struct {
+	status  Status
+	changed chan struct{} //closed by the next change
+}
+
+//Options of a Store
+type Options struct {
+	TTL        time.Duration //a transaction is kept once done, DEF_TTL when 0
+	MaxPending int           //transactions not done, DEF_MAX_PENDING when 0
+}
+
+//Store keeps the transactions in memory
+type Store struct {
+	opts Options
+
+	mu      sync.Mutex
+	txns    map[string]*txn
+	pending int
+	pruned  time.Time
+}
+
+func NewStore(opts Options) *Store {
+	if opts.TTL <= 0 {
+		opts.TTL = DEF_TTL
+	}
+	if opts.MaxPending <= 0 {
+		opts.MaxPending = DEF_MAX_PENDING
+	}
+	return &Store{opts: opts, txns: make(map[string]*txn)}
+}
+
+//Begin creates a transaction at PCMSTATUS_START
+func (s *Store) Begin() (status Status, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.pruned) >= PRUNE_INTERVAL {
+		s.prune(now)
+		s.pruned = now
+	}
+	if s.pending >= s.opts.MaxPending {
+		return status, ErrTooMany
+	}
+	t := &txn{
+		status:  Status{ID: newID(), Status: portal.PCMSTATUS_START, Stage: portal.StatusString(portal.PCMSTATUS_START), Started: now, Updated: now},
+		changed: make(chan struct{}),
+	}
+	s.txns[t.status.ID] = t
+	s.pending++
+	return t.status, nil
+}
+
+//SetStatus records the stage id entered
+func (s *Store) SetStatus(id string, status uint8) {
+	s.update(id, func(st *Status) {
+		st.Status, st.Stage = status, portal.StatusString(status)
+	})
+}
+
+//Finish records the result of id, kept for the TTL from now
+func (s *Store) Finish(id string, errno int32, errmsg string) {
+	s.update(id, func(st *Status) {
+		if !st.Done {
+			s.pending--
+		}
+		st.Done, st.Errno, st.Errmsg = true, errno, errmsg
+	})
+}
+
+func (s *Store) update(id string, f func(st *Status)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.txns[id]
+	if !ok {
+		return
+	}
+	f(&t.status)
+	t.status.Version++
+	t.status.Updated = time.Now()
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+//Get returns the status of id
+func (s *Store) Get(id string) (status Status, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.txns[id]
+	if !ok {
+		return
+	}
+	return t.status, true
+}
+
+//Wait returns the status of id once its version is past version or it is done,
+//or as it is when ctx is done first
+func (s *Store) Wait(ctx context.Context, id string, version int) (status Status, ok bool) {
+	for {
+		s.mu.Lock()
+		t, found := s.txns[id]
+		if !found {
+			s.mu.Unlock()
+			return
+		}
+		status, changed := t.status, t.changed
+		s.mu.Unlock()
+		if status.Version > version || status.Done {
+			return status, true
+		}
+		select {
+		case <-ctx.Done():
+			return status, true
+		case <-changed:
+		}
+	}
+}
+
+//Pending returns the transactions not done yet
+func (s *Store) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending
+}
+
+//prune forgets the transactions done for longer than the TTL, the caller holds s.mu
+func (s *Store) prune(now time.Time) {
+	for id, t := range s.txns {
+		if t.status.Done && now.Sub(t.status.Updated) > s.opts.TTL {
+			delete(s.txns, id)
+		}
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
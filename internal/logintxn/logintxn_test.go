@@ -0,0 +1,62 @@
+package logintxn
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gityf/portalserver/portal"
+)
+
+func TestStore(t *testing.T) {
+	s := NewStore(Options{MaxPending: 1, TTL: time.Millisecond})
+	st, err := s.Begin()
+	if err != nil || st.ID == "" || st.Status != portal.PCMSTATUS_START || st.Done {
+		t.Fatalf("begin %+v err:%v", st, err)
+	}
+	if _, err := s.Begin(); err != ErrTooMany {
+		t.Errorf("pending not limited: %v", err)
+	}
+
+	//the long-poll returns at the next change
+	changed := make(chan Status, 1)
+	go func() {
+		got, _ := s.Wait(context.Background(), st.ID, st.Version)
+		changed <- got
+	}()
+	time.Sleep(10 * time.Millisecond)
+	s.SetStatus(st.ID, portal.PCMSTATUS_AUTH)
+	select {
+	case got := <-changed:
+		if got.Status != portal.PCMSTATUS_AUTH || got.Stage != "auth" || got.Version != st.Version+1 {
+			t.Errorf("changed to %+v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait not woken")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if got, ok := s.Wait(ctx, st.ID, st.Version+1); !ok || got.Version != st.Version+1 {
+		t.Errorf("wait timed out with %+v", got)
+	}
+
+	s.Finish(st.ID, 15, "login refused")
+	if got, ok := s.Wait(context.Background(), st.ID, 100); !ok || !got.Done || got.Errno != 15 {
+		t.Errorf("finished %+v", got)
+	}
+	if s.Pending() != 0 {
+		t.Errorf("%d pending", s.Pending())
+	}
+
+	//done past the TTL, forgotten by the next Begin
+	time.Sleep(PRUNE_INTERVAL)
+	if _, err := s.Begin(); err != nil {
+		t.Errorf("begin err:%v", err)
+	}
+	if _, ok := s.Get(st.ID); ok {
+		t.Errorf("transaction kept past the TTL")
+	}
+	if _, ok := s.Wait(context.Background(), "nope", 0); ok {
+		t.Errorf("unknown id found")
+	}
+}
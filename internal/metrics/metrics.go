@@ -0,0 +1,289 @@
+package metrics
+
+/*
+	counters, gauges and histograms of the server, exposed in the prometheus text format
+*/
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//latency buckets in seconds, from a cached answer to the retry deadline
+var DefBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+var (
+	mu         sync.Mutex
+	collectors = map[string]collector{}
+)
+
+func register(name string, c collector) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := collectors[name]; ok {
+		panic("metrics: " + name + " registered twice")
+	}
+	collectors[name] = c
+}
+
+//vec holds the values of a metric by label values
+type vec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*series
+}
+
+type series struct {
+	labels []string
+	value  float64
+	counts []uint64 //of the histograms, by bucket
+	sum    float64
+}
+
+func newVec(name, help, kind string, labels []string) *vec {
+	v := &vec{name: name, help: help, kind: kind, labels: labels, values: map[string]*series{}}
+	register(name, v)
+	return v
+}
+
+//series of the label values, created on first use; the caller holds v.mu
+func (v *vec) series(values []string) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %v wants %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := v.values[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), values...)}
+		v.values[key] = s
+	}
+	return s
+}
+
+func (v *vec) sorted() []*series {
+	all := make([]*series, 0, len(v.values))
+	for _, s := range v.values {
+		all = append(all, s)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return strings.Join(all[i].labels, "\xff") < strings.Join(all[j].labels, "\xff")
+	})
+	return all
+}
+
+func (v *vec) write(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	writeHeader(w, v.name, v.help, v.kind)
+	for _, s := range v.sorted() {
+		fmt.Fprintf(w, "%v%v %v\n", v.name, labelString(v.labels, s.labels, "", ""), formatValue(s.value))
+	}
+}
+
+//Counter only goes up
+type Counter struct {
+	*vec
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{newVec(name, help, "counter", labels)}
+}
+
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *Counter) Add(n float64, values ...string) {
+	if n < 0 {
+		return
+	}
+	c.mu.Lock()
+	c.series(values).value += n
+	c.mu.Unlock()
+}
+
+//Value returns the count of the label values
+func (c *Counter) Value(values ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.series(values).value
+}
+
+//Gauge goes up and down
+type Gauge struct {
+	*vec
+}
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{newVec(name, help, "gauge", labels)}
+}
+
+func (g *Gauge) Set(n float64, values ...string) {
+	g.mu.Lock()
+	g.series(values).value = n
+	g.mu.Unlock()
+}
+
+func (g *Gauge) Add(n float64, values ...string) {
+	g.mu.Lock()
+	g.series(values).value += n
+	g.mu.Unlock()
+}
+
+func (g *Gauge) Value(values ...string) float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.series(values).value
+}
+
+type gaugeFunc struct {
+	name string
+	help string
+	f    func() float64
+}
+
+//NewGaugeFunc exposes the value of f, called on every scrape
+func NewGaugeFunc(name, help string, f func() float64) {
+	register(name, &gaugeFunc{name, help, f})
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%v %v\n", g.name, formatValue(g.f()))
+}
+
+//Histogram counts the observations by bucket
+type Histogram struct {
+	*vec
+	buckets []float64
+}
+
+//NewHistogram with the upper bounds of buckets, DefBuckets when nil
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	h := &Histogram{vec: &vec{name: name, help: help, kind: "histogram", labels: labels, values: map[string]*series{}}, buckets: buckets}
+	register(name, h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series(values)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.value++
+	s.sum += v
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.name, h.help, "histogram")
+	for _, s := range h.sorted() {
+		for i, bound := range h.buckets {
+			var count uint64
+			if s.counts != nil {
+				count = s.counts[i]
+			}
+			fmt.Fprintf(w, "%v_bucket%v %v\n", h.name, labelString(h.labels, s.labels, "le", formatValue(bound)), count)
+		}
+		fmt.Fprintf(w, "%v_bucket%v %v\n", h.name, labelString(h.labels, s.labels, "le", "+Inf"), formatValue(s.value))
+		fmt.Fprintf(w, "%v_sum%v %v\n", h.name, labelString(h.labels, s.labels, "", ""), formatValue(s.sum))
+		fmt.Fprintf(w, "%v_count%v %v\n", h.name, labelString(h.labels, s.labels, "", ""), formatValue(s.value))
+	}
+}
+
+//WritePrometheus writes every metric in the text exposition format, sorted by name
+func WritePrometheus(out io.Writer) error {
+	mu.Lock()
+	names := make([]string, 0, len(collectors))
+	for name := range collectors {
+		names = append(names, name)
+	}
+	all := make([]collector, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		all = append(all, collectors[name])
+	}
+	mu.Unlock()
+
+	w := bufio.NewWriter(out)
+	for _, c := range all {
+		c.write(w)
+	}
+	return w.Flush()
+}
+
+//Handler serves WritePrometheus
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "text/plain; version=0.0.4; charset=utf-8")
+		WritePrometheus(w)
+	})
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %v %v\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+	fmt.Fprintf(w, "# TYPE %v %v\n", name, kind)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+//labelString returns {name="value",...}, extra is appended when not empty
+func labelString(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%v="%v"`, name, labelEscaper.Replace(values[i]))
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%v="%v"`, extraName, extraValue)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	requests := NewCounter("test_requests_total", "Requests.", "handler", "errno")
+	requests.Inc("Login", "0")
+	requests.Add(2, "Login", "0")
+	requests.Inc("Logout", `"x"`)
+	online := NewGauge("test_online", "Online users.")
+	online.Set(7)
+	NewGaugeFunc("test_func", "Func.", func() float64 { return 1.5 })
+	latency := NewHistogram("test_seconds", "Latency.", []float64{0.1, 1}, "handler")
+	latency.Observe(0.05, "Login")
+	latency.Observe(0.5, "Login")
+
+	var out bytes.Buffer
+	WritePrometheus(&out)
+	for _, line := range []string{
+		"# TYPE test_requests_total counter",
+		`test_requests_total{handler="Login",errno="0"} 3`,
+		`test_requests_total{handler="Logout",errno="\"x\""} 1`,
+		"test_online 7",
+		"test_func 1.5",
+		`test_seconds_bucket{handler="Login",le="0.1"} 1`,
+		`test_seconds_bucket{handler="Login",le="1"} 2`,
+		`test_seconds_bucket{handler="Login",le="+Inf"} 2`,
+		`test_seconds_sum{handler="Login"} 0.55`,
+		`test_seconds_count{handler="Login"} 2`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("missing %v in\n%v", line, out.String())
+		}
+	}
+	if requests.Value("Login", "0") != 3 {
+		t.Errorf("Value %v", requests.Value("Login", "0"))
+	}
+}
@@ -1,17 +1,20 @@
-package context
+package portalctx
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"encoding/json"
-	logger "github.com/xlog4go"
-	"global"
+	logger "github.com/gityf/portalserver/xlog4go"
+	"github.com/gityf/portalserver/internal/global"
 	"net/http"
+	"net/url"
 )
 
 type BaseResponse struct {
 	Errno  int32  `json:"errno"`
 	Errmsg string `json:"errmsg"`
+	ID     string `json:"id,omitempty"` //transaction of an async login, see /portalserver/login/status
 }
 
 func DoResponse(result interface{}, w io.Writer) (n int, err error) {
@@ -72,8 +75,31 @@ type FormStruct struct {
 	BrasIP     string `json:"brasip"`
 	UserIP     string `json:"userip"`
 	UserMac    string `json:"usermac"`
+	AcName     string `json:"acname"`
+	SSID       string `json:"ssid"`
 	LogonTime  string `json:"logontime"`
 	OnlineTime int64  `json:"onlinetime"`
+	Async      bool   `json:"async"` //login answered at once with the id of its transaction
+}
+
+//Redacted returns a copy of f fit for the logs, the password masked
+func (f FormStruct) Redacted() FormStruct {
+	if f.Password != "" {
+		f.Password = logger.REDACTED
+	}
+	return f
+}
+
+//RedactForm returns a copy of form fit for the logs, credential fields masked
+func RedactForm(form url.Values) url.Values {
+	redacted := make(url.Values, len(form))
+	for k, v := range form {
+		if logger.IsRedactKey(k) {
+			v = []string{logger.REDACTED}
+		}
+		redacted[k] = v
+	}
+	return redacted
 }
 
 type Message struct {
@@ -81,6 +107,15 @@ type Message struct {
 	LogId       int64               //本地日志id
 	Source      string              //客户端的来源
 	Writer      http.ResponseWriter //http响应object
+	Ctx         context.Context     //请求的context, 客户端断开或服务退出时取消
 	MessageType uint64
 	*FormStruct
+}
+
+//Context returns the request context, never nil
+func (m *Message) Context() context.Context {
+	if m.Ctx == nil {
+		return context.Background()
+	}
+	return m.Ctx
 }
\ No newline at end of file
@@ -0,0 +1,383 @@
+package session
+
+/*
+	durable state of the server on the local disk, no database needed
+
+	<dir>/state.snap  json of the State at the seq of the last compaction
+	<dir>/state.log   one json Record per line since then, replayed over the snapshot
+
+	the records carry an increasing seq, those of the log not newer than the snapshot
+	are skipped, so a crash between the snapshot rename and the log truncation is harmless
+*/
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	SNAPSHOT_FILE = "state.snap"
+	LOG_FILE      = "state.log"
+
+	DEF_COMPACT_EVERY = 10000
+	DEF_SYNC_INTERVAL = time.Second
+)
+
+//ops of a Record
+const (
+	OP_PUT    = "put"    //Session logged in
+	OP_DELETE = "del"    //BrasIP/UserIP logged out
+	OP_SERIAL = "serial" //next Serial of the allocator of BrasIP
+	OP_BEGIN  = "begin"  //Pending transaction sent to the BAS
+	OP_DONE   = "done"   //transaction ID acked or abandoned
+)
+
+var ErrJournalClosed = errors.New("journal closed")
+
+//Pending is a transaction with the BAS not acked yet, or a packet of the BAS not answered yet
+type Pending struct {
+	ID       uint64    `json:"id"`
+	Op       string    `json:"op"` //login, logout, aff_ack_auth or ntf_logout
+	BrasIP   string    `json:"brasip"`
+	UserIP   string    `json:"userip"`
+	UserName string    `json:"username,omitempty"`
+	Started  time.Time `json:"started"`
+	SerialNo uint16    `json:"serialno,omitempty"` //of the aff_ack_auth owed
+	ReqID    uint16    `json:"reqid,omitempty"`    //of the aff_ack_auth owed
+	Packet   []byte    `json:"packet,omitempty"`   //ntf_logout received, not acked yet
+	BasAddr  string    `json:"basaddr,omitempty"`  //udp address the ntf_logout came from
+}
+
+//Record is one line of the log
+type Record struct {
+	Seq     uint64   `json:"seq"`
+	Op      string   `json:"op"`
+	Session *Session `json:"session,omitempty"`
+	BrasIP  string   `json:"brasip,omitempty"`
+	UserIP  string   `json:"userip,omitempty"`
+	Serial  uint16   `json:"serial,omitempty"`
+	Pending *Pending `json:"pending,omitempty"`
+	ID      uint64   `json:"id,omitempty"`
+}
+
+//State kept by the journal
+type State struct {
+	Seq      uint64            `json:"seq"`
+	Sessions []Session         `json:"sessions"`
+	Serials  map[string]uint16 `json:"serials"` //next serial no by BAS ip
+	Pending  []Pending         `json:"pending"`
+}
+
+//JournalOptions of a Journal
+type JournalOptions struct {
+	CompactEvery int           //log records between two compactions, DEF_COMPACT_EVERY when 0
+	SyncInterval time.Duration //between two fsync of the log, DEF_SYNC_INTERVAL when 0, every record when < 0
+}
+
+//Journal persists the sessions, the serial counters and the pending transactions.
+//It keeps its own copy of the state to write the snapshots.
+type Journal struct {
+	dir  string
+	opts JournalOptions
+
+	mu       sync.Mutex
+	file     *os.File
+	dirty    bool //written since the last fsync
+	records  int  //in the log
+	seq      uint64
+	nextId   uint64
+	sessions map[key]Session
+	serials  map[string]uint16
+	pending  map[uint64]Pending
+	done     chan struct{}
+}
+
+//OpenJournal loads the state of dir, compacts it and opens the log for appending
+func OpenJournal(dir string, opts JournalOptions) (j *Journal, state *State, err error) {
+	if opts.CompactEvery <= 0 {
+		opts.CompactEvery = DEF_COMPACT_EVERY
+	}
+	if opts.SyncInterval == 0 {
+		opts.SyncInterval = DEF_SYNC_INTERVAL
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+	j = &Journal{
+		dir:      dir,
+		opts:     opts,
+		sessions: make(map[key]Session),
+		serials:  make(map[string]uint16),
+		pending:  make(map[uint64]Pending),
+		done:     make(chan struct{}),
+	}
+	if err = j.load(); err != nil {
+		return nil, nil, err
+	}
+	if err = j.compact(); err != nil {
+		return nil, nil, err
+	}
+	state = j.state()
+	if opts.SyncInterval > 0 {
+		go j.syncLoop()
+	}
+	return
+}
+
+//load reads the snapshot and replays the log over it
+func (j *Journal) load() error {
+	cnt, err := os.ReadFile(filepath.Join(j.dir, SNAPSHOT_FILE))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var snap State
+		if err = json.Unmarshal(cnt, &snap); err != nil {
+			return err
+		}
+		j.seq = snap.Seq
+		for _, s := range snap.Sessions {
+			j.sessions[key{s.BrasIP, s.UserIP}] = s
+		}
+		for ip, serial := range snap.Serials {
+			j.serials[ip] = serial
+		}
+		for _, p := range snap.Pending {
+			j.pending[p.ID] = p
+			if p.ID >= j.nextId {
+				j.nextId = p.ID + 1
+			}
+		}
+	}
+
+	file, err := os.Open(filepath.Join(j.dir, LOG_FILE))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			//the last line of a crash, nothing after it was acknowledged
+			break
+		}
+		if r.Seq > j.seq {
+			j.apply(&r)
+			j.seq = r.Seq
+		}
+	}
+	return scanner.Err()
+}
+
+//apply updates the state by r, the caller holds j.mu or owns j
+func (j *Journal) apply(r *Record) {
+	switch r.Op {
+	case OP_PUT:
+		if r.Session != nil {
+			j.sessions[key{r.Session.BrasIP, r.Session.UserIP}] = *r.Session
+		}
+	case OP_DELETE:
+		delete(j.sessions, key{r.BrasIP, r.UserIP})
+	case OP_SERIAL:
+		j.serials[r.BrasIP] = r.Serial
+	case OP_BEGIN:
+		if r.Pending != nil {
+			j.pending[r.Pending.ID] = *r.Pending
+			if r.Pending.ID >= j.nextId {
+				j.nextId = r.Pending.ID + 1
+			}
+		}
+	case OP_DONE:
+		delete(j.pending, r.ID)
+	}
+}
+
+func (j *Journal) state() *State {
+	state := &State{Seq: j.seq, Sessions: []Session{}, Serials: make(map[string]uint16), Pending: []Pending{}}
+	for _, s := range j.sessions {
+		state.Sessions = append(state.Sessions, s)
+	}
+	sort.Slice(state.Sessions, func(a, b int) bool {
+		return state.Sessions[a].LoginTime.Before(state.Sessions[b].LoginTime)
+	})
+	for ip, serial := range j.serials {
+		state.Serials[ip] = serial
+	}
+	for _, p := range j.pending {
+		state.Pending = append(state.Pending, p)
+	}
+	sort.Slice(state.Pending, func(a, b int) bool { return state.Pending[a].ID < state.Pending[b].ID })
+	return state
+}
+
+//compact writes the snapshot of the state and starts an empty log, the caller holds j.mu or owns j
+func (j *Journal) compact() error {
+	cnt, err := json.Marshal(j.state())
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(j.dir, SNAPSHOT_FILE)
+	if err = writeFileSync(name+".tmp", cnt); err != nil {
+		return err
+	}
+	if err = os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+	syncDir(j.dir)
+
+	if j.file != nil {
+		j.file.Close()
+	}
+	j.file, err = os.OpenFile(filepath.Join(j.dir, LOG_FILE), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	j.records, j.dirty = 0, false
+	return err
+}
+
+//append writes r to the log and applies it
+func (j *Journal) append(r *Record) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return ErrJournalClosed
+	}
+	j.seq++
+	r.Seq = j.seq
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err = j.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	j.apply(r)
+	j.records++
+	j.dirty = true
+	if j.opts.SyncInterval < 0 {
+		if err = j.file.Sync(); err != nil {
+			return err
+		}
+		j.dirty = false
+	}
+	if j.records >= j.opts.CompactEvery {
+		return j.compact()
+	}
+	return nil
+}
+
+//Put records the login of a session
+func (j *Journal) Put(s Session) error {
+	return j.append(&Record{Op: OP_PUT, Session: &s})
+}
+
+//Delete records the logout of a session
+func (j *Journal) Delete(brasIP, userIP string) error {
+	return j.append(&Record{Op: OP_DELETE, BrasIP: brasIP, UserIP: userIP})
+}
+
+//SetSerial records the next serial no of the BAS, nothing is written when unchanged
+func (j *Journal) SetSerial(brasIP string, serial uint16) error {
+	j.mu.Lock()
+	old, ok := j.serials[brasIP]
+	j.mu.Unlock()
+	if ok && old == serial {
+		return nil
+	}
+	return j.append(&Record{Op: OP_SERIAL, BrasIP: brasIP, Serial: serial})
+}
+
+//Begin records a transaction sent to the BAS, the id returned is given to Done
+func (j *Journal) Begin(p Pending) (id uint64, err error) {
+	j.mu.Lock()
+	id = j.nextId
+	j.nextId++
+	j.mu.Unlock()
+	p.ID = id
+	err = j.append(&Record{Op: OP_BEGIN, Pending: &p})
+	return
+}
+
+//Done records the end of the transaction id, acked or not
+func (j *Journal) Done(id uint64) error {
+	return j.append(&Record{Op: OP_DONE, ID: id})
+}
+
+//Compact writes a snapshot now and empties the log
+func (j *Journal) Compact() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return ErrJournalClosed
+	}
+	return j.compact()
+}
+
+//Sync flushes the log to the disk
+func (j *Journal) Sync() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil || !j.dirty {
+		return nil
+	}
+	j.dirty = false
+	return j.file.Sync()
+}
+
+//Close compacts the state, nothing can be written after
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	close(j.done)
+	err := j.compact()
+	j.file.Close()
+	j.file = nil
+	return err
+}
+
+func (j *Journal) syncLoop() {
+	ticker := time.NewTicker(j.opts.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.done:
+			return
+		case <-ticker.C:
+			j.Sync()
+		}
+	}
+}
+
+func writeFileSync(name string, cnt []byte) error {
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(cnt); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+//syncDir makes a rename in dir durable, best effort
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
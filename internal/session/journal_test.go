@@ -0,0 +1,73 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournalReload(t *testing.T) {
+	dir := t.TempDir()
+	j, state, err := OpenJournal(dir, JournalOptions{SyncInterval: -1})
+	if err != nil || len(state.Sessions) != 0 {
+		t.Fatalf("OpenJournal %v %+v", err, state)
+	}
+	login := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	j.Put(Session{UserIP: "10.0.0.2", BrasIP: "10.0.0.1", UserName: "alice", LoginTime: login})
+	j.Put(Session{UserIP: "10.0.0.3", BrasIP: "10.0.0.1", UserName: "bob", LoginTime: login.Add(time.Minute)})
+	j.Delete("10.0.0.1", "10.0.0.2")
+	j.SetSerial("10.0.0.1", 4242)
+	id, _ := j.Begin(Pending{Op: "login", BrasIP: "10.0.0.1", UserIP: "10.0.0.4", UserName: "carol"})
+	done, _ := j.Begin(Pending{Op: "logout", BrasIP: "10.0.0.1", UserIP: "10.0.0.3"})
+	j.Done(done)
+
+	//a crash: the log is not compacted, its last line is torn
+	j.file.Write([]byte(`{"seq":99,"op":"put","sess`))
+	j.file.Close()
+
+	j, state, err = OpenJournal(dir, JournalOptions{})
+	if err != nil {
+		t.Fatalf("reopen err:%v", err)
+	}
+	if len(state.Sessions) != 1 || state.Sessions[0].UserName != "bob" || !state.Sessions[0].LoginTime.Equal(login.Add(time.Minute)) {
+		t.Errorf("sessions %+v", state.Sessions)
+	}
+	if state.Serials["10.0.0.1"] != 4242 {
+		t.Errorf("serials %+v", state.Serials)
+	}
+	if len(state.Pending) != 1 || state.Pending[0].ID != id || state.Pending[0].UserName != "carol" {
+		t.Errorf("pending %+v", state.Pending)
+	}
+	if next, _ := j.Begin(Pending{Op: "login"}); next <= done {
+		t.Errorf("pending id %v reused", next)
+	}
+	if info, _ := os.Stat(filepath.Join(dir, LOG_FILE)); info.Size() == 0 {
+		t.Errorf("begin not in the log")
+	}
+	if err = j.Close(); err != nil {
+		t.Fatalf("close err:%v", err)
+	}
+	if info, _ := os.Stat(filepath.Join(dir, LOG_FILE)); info.Size() != 0 {
+		t.Errorf("log not compacted on close")
+	}
+	if err = j.Put(Session{}); err != ErrJournalClosed {
+		t.Errorf("put after close: %v", err)
+	}
+}
+
+func TestJournalSnapshotNewerThanLog(t *testing.T) {
+	dir := t.TempDir()
+	j, _, _ := OpenJournal(dir, JournalOptions{SyncInterval: -1, CompactEvery: 1000})
+	j.Put(Session{UserIP: "10.0.0.2", BrasIP: "10.0.0.1"})
+	log, _ := os.ReadFile(filepath.Join(dir, LOG_FILE))
+	j.Delete("10.0.0.1", "10.0.0.2")
+	j.Close()
+
+	//a crash after the snapshot rename, before the log truncation
+	os.WriteFile(filepath.Join(dir, LOG_FILE), log, 0600)
+	_, state, err := OpenJournal(dir, JournalOptions{})
+	if err != nil || len(state.Sessions) != 0 {
+		t.Errorf("old records replayed: %v %+v", err, state.Sessions)
+	}
+}
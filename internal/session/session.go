@@ -0,0 +1,89 @@
+package session
+
+/*
+	users online through the portal, added on login and removed on logout
+*/
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+//Session of one user ip behind one BAS
+type Session struct {
+	UserIP     string    `json:"userip"`
+	BrasIP     string    `json:"brasip"`
+	UserName   string    `json:"username"`
+	UserMac    string    `json:"usermac,omitempty"`
+	AcName     string    `json:"acname,omitempty"`
+	SSID       string    `json:"ssid,omitempty"`
+	LoginTime  time.Time `json:"login_time"`
+	Group      string    `json:"group,omitempty"`       //group of the session limits
+	OnlineTime int64     `json:"online_time,omitempty"` //seconds granted by the login form, no limit of its own when 0
+}
+
+type key struct {
+	brasIP string
+	userIP string
+}
+
+//Store of the sessions, safe for concurrent use
+type Store struct {
+	mu       sync.RWMutex
+	sessions map[key]Session
+}
+
+func NewStore() *Store {
+	return &Store{sessions: make(map[key]Session)}
+}
+
+//Put adds or replaces the session of the user ip
+func (s *Store) Put(sess Session) {
+	s.mu.Lock()
+	s.sessions[key{sess.BrasIP, sess.UserIP}] = sess
+	s.mu.Unlock()
+}
+
+func (s *Store) Get(brasIP, userIP string) (sess Session, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sess, ok = s.sessions[key{brasIP, userIP}]
+	return
+}
+
+//Delete removes the session, ok tells whether it was there
+func (s *Store) Delete(brasIP, userIP string) (sess Session, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := key{brasIP, userIP}
+	if sess, ok = s.sessions[k]; ok {
+		delete(s.sessions, k)
+	}
+	return
+}
+
+//List returns the sessions kept by keep, every one when nil, the oldest first
+func (s *Store) List(keep func(Session) bool) []Session {
+	s.mu.RLock()
+	list := make([]Session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		if keep == nil || keep(sess) {
+			list = append(list, sess)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].LoginTime.Equal(list[j].LoginTime) {
+			return list[i].BrasIP+"/"+list[i].UserIP < list[j].BrasIP+"/"+list[j].UserIP
+		}
+		return list[i].LoginTime.Before(list[j].LoginTime)
+	})
+	return list
+}
+
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.sessions)
+}
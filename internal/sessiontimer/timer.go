@@ -0,0 +1,192 @@
+package sessiontimer
+
+/*
+	maximum duration and idle timeout of the sessions, checked every interval
+
+	the idle time is the DELAYTIME of the ACK_INFO when the BAS sends it, otherwise the
+	time since the flux of the ACK_INFO last grew by more than IdleBytes
+*/
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gityf/portalserver/internal/session"
+)
+
+const (
+	DEF_INTERVAL    = time.Minute
+	DEF_CONCURRENCY = 16
+
+	REASON_MAX_DURATION = "max-duration"
+	REASON_IDLE         = "idle"
+)
+
+//Limits of one session, no limit when 0
+type Limits struct {
+	MaxDuration time.Duration
+	IdleTimeout time.Duration
+	IdleBytes   uint64 //flux between two checks still idle
+}
+
+//Usage of a session as the BAS reports it
+type Usage struct {
+	Bytes    uint64 //uplink and downlink flux
+	HasBytes bool
+	Idle     time.Duration
+	HasIdle  bool
+}
+
+//Options of a Timer
+type Options struct {
+	Interval    time.Duration                                                     //between two checks, DEF_INTERVAL when 0
+	Concurrency int                                                               //usage queries and logouts in flight, DEF_CONCURRENCY when 0
+	Sessions    func() []session.Session                                          //sessions checked
+	Limits      func(s session.Session) Limits                                    //limits of the session
+	Usage       func(ctx context.Context, s session.Session) (Usage, error)       //asked only for an idle timeout
+	Logout      func(ctx context.Context, s session.Session, reason string) error //ends the session over a limit
+}
+
+//activity of a session judged by its flux
+type activity struct {
+	loginTime  time.Time //of the session, a new login starts over
+	bytes      uint64
+	lastActive time.Time
+}
+
+type key struct {
+	brasIP string
+	userIP string
+}
+
+//Timer logs the sessions out once over their limits
+type Timer struct {
+	opts    Options
+	started time.Time
+	now     func() time.Time
+
+	mu       sync.Mutex
+	activity map[key]*activity
+}
+
+func NewTimer(opts Options) *Timer {
+	if opts.Interval <= 0 {
+		opts.Interval = DEF_INTERVAL
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DEF_CONCURRENCY
+	}
+	return &Timer{opts: opts, started: time.Now(), now: time.Now, activity: make(map[key]*activity)}
+}
+
+//Run checks the sessions every interval until ctx is done
+func (t *Timer) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		t.CheckAll(ctx)
+	}
+}
+
+//CheckAll checks every session and waits for the logouts
+func (t *Timer) CheckAll(ctx context.Context) {
+	sessions := t.opts.Sessions()
+	t.prune(sessions)
+
+	sem := make(chan struct{}, t.opts.Concurrency)
+	var wg sync.WaitGroup
+	for _, s := range sessions {
+		limits := t.opts.Limits(s)
+		if limits.MaxDuration <= 0 && (limits.IdleTimeout <= 0 || t.opts.Usage == nil) {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(s session.Session) {
+			defer func() { <-sem; wg.Done() }()
+			t.check(ctx, s, limits)
+		}(s)
+	}
+	wg.Wait()
+}
+
+func (t *Timer) check(ctx context.Context, s session.Session, limits Limits) {
+	reason := t.overLimit(ctx, s, limits)
+	if reason == "" || t.opts.Logout(ctx, s, reason) != nil {
+		return
+	}
+	t.mu.Lock()
+	delete(t.activity, key{s.BrasIP, s.UserIP})
+	t.mu.Unlock()
+}
+
+//overLimit returns the REASON_* of the limit s is over, empty when none or unknown
+func (t *Timer) overLimit(ctx context.Context, s session.Session, limits Limits) string {
+	now := t.now()
+	if limits.MaxDuration > 0 && now.Sub(s.LoginTime) >= limits.MaxDuration {
+		return REASON_MAX_DURATION
+	}
+	if limits.IdleTimeout <= 0 || t.opts.Usage == nil {
+		return ""
+	}
+	usage, err := t.opts.Usage(ctx, s)
+	if err != nil {
+		return ""
+	}
+	idle, ok := usage.Idle, usage.HasIdle
+	if !ok && usage.HasBytes {
+		idle, ok = t.idleByFlux(s, usage.Bytes, limits.IdleBytes, now), true
+	}
+	if ok && idle >= limits.IdleTimeout {
+		return REASON_IDLE
+	}
+	return ""
+}
+
+//idleByFlux records the flux of s and returns the time since it last grew by more than idleBytes
+func (t *Timer) idleByFlux(s session.Session, bytes, idleBytes uint64, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	k := key{s.BrasIP, s.UserIP}
+	a, ok := t.activity[k]
+	if !ok || !a.loginTime.Equal(s.LoginTime) {
+		//the flux before the start of the timer is unknown, idle at most since then
+		a = &activity{loginTime: s.LoginTime, bytes: bytes, lastActive: s.LoginTime}
+		if a.lastActive.Before(t.started) {
+			a.lastActive = t.started
+		}
+		t.activity[k] = a
+	}
+	//a counter going back was reset by the BAS, that is traffic too
+	if bytes < a.bytes || bytes-a.bytes > idleBytes {
+		a.lastActive = now
+	}
+	a.bytes = bytes
+	return now.Sub(a.lastActive)
+}
+
+//prune forgets the activity of the sessions gone
+func (t *Timer) prune(sessions []session.Session) {
+	alive := make(map[key]bool, len(sessions))
+	for _, s := range sessions {
+		alive[key{s.BrasIP, s.UserIP}] = true
+	}
+	t.mu.Lock()
+	for k := range t.activity {
+		if !alive[k] {
+			delete(t.activity, k)
+		}
+	}
+	t.mu.Unlock()
+}
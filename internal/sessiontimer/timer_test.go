@@ -0,0 +1,68 @@
+package sessiontimer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gityf/portalserver/internal/session"
+)
+
+func TestCheckAll(t *testing.T) {
+	start := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	now := start
+	sessions := []session.Session{
+		{UserIP: "10.0.0.1", BrasIP: "bas", LoginTime: start.Add(-5 * time.Hour)},   //over the max duration
+		{UserIP: "10.0.0.2", BrasIP: "bas", LoginTime: start.Add(-time.Hour)},       //idle by DELAYTIME
+		{UserIP: "10.0.0.3", BrasIP: "bas", LoginTime: start.Add(-time.Hour)},       //flux growing
+		{UserIP: "10.0.0.4", BrasIP: "bas", LoginTime: start.Add(-time.Hour)},       //flux stalled
+		{UserIP: "10.0.0.5", BrasIP: "other", LoginTime: start.Add(-5 * time.Hour)}, //no limits
+	}
+	var flux uint64
+	var mu sync.Mutex
+	ended := make(map[string]string)
+
+	timer := NewTimer(Options{
+		Sessions: func() []session.Session { return sessions },
+		Limits: func(s session.Session) Limits {
+			if s.BrasIP == "other" {
+				return Limits{}
+			}
+			return Limits{MaxDuration: 4 * time.Hour, IdleTimeout: 30 * time.Minute, IdleBytes: 100}
+		},
+		Usage: func(ctx context.Context, s session.Session) (Usage, error) {
+			switch s.UserIP {
+			case "10.0.0.2":
+				return Usage{Idle: 40 * time.Minute, HasIdle: true}, nil
+			case "10.0.0.3":
+				return Usage{Bytes: flux * 1000, HasBytes: true}, nil
+			}
+			return Usage{Bytes: flux, HasBytes: true}, nil
+		},
+		Logout: func(ctx context.Context, s session.Session, reason string) error {
+			mu.Lock()
+			ended[s.UserIP] = reason
+			mu.Unlock()
+			return nil
+		},
+	})
+	timer.started = start
+	timer.now = func() time.Time { return now }
+
+	//every 10 minutes for 40 minutes
+	for i := 0; i <= 4; i++ {
+		flux += 10
+		timer.CheckAll(context.Background())
+		now = now.Add(10 * time.Minute)
+	}
+	want := map[string]string{"10.0.0.1": REASON_MAX_DURATION, "10.0.0.2": REASON_IDLE, "10.0.0.4": REASON_IDLE}
+	if len(ended) != len(want) {
+		t.Errorf("ended %v, want %v", ended, want)
+	}
+	for ip, reason := range want {
+		if ended[ip] != reason {
+			t.Errorf("%v ended by %q, want %q", ip, ended[ip], reason)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package static
+
+/*
+	static assets of the portal, served from a directory or from the files embedded in the binary.
+
+	the paths are resolved by io/fs, which refuses "..", so nothing outside the root is reachable.
+	hidden files, Go sources and the directories of Options.Deny are never served.
+*/
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	GZIP_MIN_SIZE = 1024    //smaller files are sent as they are
+	GZIP_MAX_SIZE = 4 << 20 //larger files are not compressed on the fly
+	sniff_len     = 512
+)
+
+func init() {
+	//types missing from the tables of some systems
+	for ext, typ := range map[string]string{
+		".css":         "text/css; charset=utf-8",
+		".js":          "text/javascript; charset=utf-8",
+		".mjs":         "text/javascript; charset=utf-8",
+		".json":        "application/json",
+		".map":         "application/json",
+		".svg":         "image/svg+xml",
+		".ico":         "image/x-icon",
+		".woff":        "font/woff",
+		".woff2":       "font/woff2",
+		".ttf":         "font/ttf",
+		".txt":         "text/plain; charset=utf-8",
+		".webmanifest": "application/manifest+json",
+		".wasm":        "application/wasm",
+	} {
+		mime.AddExtensionType(ext, typ)
+	}
+}
+
+//Options of a Server
+type Options struct {
+	Gzip        bool          //compress the text assets for the clients accepting gzip
+	MaxAge      time.Duration //Cache-Control max-age of the assets, 0 for no-cache
+	SPAFallback string        //file served for the unknown page paths, none when empty
+	Deny        []string      //directories never served, such as the templates
+}
+
+//Server serves the files of an fs.FS
+type Server struct {
+	fsys fs.FS
+	opts Options
+
+	mu    sync.Mutex
+	cache map[string]*asset
+}
+
+//asset is what is known of a file for a modification time and size
+type asset struct {
+	modTime time.Time
+	size    int64
+	etag    string
+	ctype   string
+	gz      []byte //compressed content, nil when not compressed
+}
+
+func New(fsys fs.FS, opts Options) *Server {
+	return &Server{fsys: fsys, opts: opts, cache: make(map[string]*asset)}
+}
+
+//Serve writes the file of the request path, false when there is none and nothing was written
+func (s *Server) Serve(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	name, ok := s.name(r.URL.Path)
+	if !ok {
+		return false
+	}
+	if s.serveFile(w, r, name, s.opts.MaxAge) {
+		return true
+	}
+	if s.opts.SPAFallback != "" && isPageRequest(r) {
+		//the client side router handles the path, never cache its answer
+		return s.serveFile(w, r, s.opts.SPAFallback, 0)
+	}
+	return false
+}
+
+//name returns the fs name of a url path, ok is false for the paths never served
+func (s *Server) name(urlPath string) (name string, ok bool) {
+	name = strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if name == "" {
+		name = "."
+	}
+	if !fs.ValidPath(name) {
+		return "", false
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if strings.HasPrefix(elem, ".") && elem != "." {
+			return "", false
+		}
+	}
+	if strings.HasSuffix(name, ".go") {
+		return "", false
+	}
+	for _, dir := range s.opts.Deny {
+		dir = strings.Trim(dir, "/")
+		if name == dir || strings.HasPrefix(name, dir+"/") {
+			return "", false
+		}
+	}
+	return name, true
+}
+
+//isPageRequest tells a browser navigation from an asset or api request
+func isPageRequest(r *http.Request) bool {
+	return path.Ext(r.URL.Path) == "" && strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, name string, maxAge time.Duration) bool {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		if err == nil && name != "." {
+			//a directory serves its index.html
+			return s.serveFile(w, r, path.Join(name, "index.html"), maxAge)
+		}
+		return false
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		return false
+	}
+	a, err := s.asset(name, info, content)
+	if err != nil {
+		return false
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", a.ctype)
+	header.Set("X-Content-Type-Options", "nosniff")
+	if maxAge > 0 {
+		header.Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge/time.Second)))
+	} else {
+		header.Set("Cache-Control", "no-cache")
+	}
+	if a.gz != nil {
+		header.Add("Vary", "Accept-Encoding")
+		if acceptsGzip(r) {
+			header.Set("Content-Encoding", "gzip")
+			header.Set("ETag", strings.TrimSuffix(a.etag, `"`)+`-gz"`)
+			http.ServeContent(w, r, name, a.modTime, bytes.NewReader(a.gz))
+			return true
+		}
+	}
+	header.Set("ETag", a.etag)
+	http.ServeContent(w, r, name, a.modTime, content)
+	return true
+}
+
+//asset returns the etag, type and compressed content of a file, computed once for each version
+func (s *Server) asset(name string, info fs.FileInfo, content io.ReadSeeker) (*asset, error) {
+	s.mu.Lock()
+	a := s.cache[name]
+	s.mu.Unlock()
+	if a != nil && a.modTime.Equal(info.ModTime()) && a.size == info.Size() {
+		return a, nil
+	}
+
+	a = &asset{modTime: info.ModTime(), size: info.Size()}
+	h := sha1.New()
+	head := make([]byte, sniff_len)
+	n, _ := io.ReadFull(content, head)
+	h.Write(head[:n])
+	if _, err := io.Copy(h, content); err != nil {
+		return nil, err
+	}
+	a.etag = `"` + hex.EncodeToString(h.Sum(nil))[:20] + `"`
+	if a.ctype = mime.TypeByExtension(path.Ext(name)); a.ctype == "" {
+		a.ctype = http.DetectContentType(head[:n])
+	}
+
+	if s.opts.Gzip && compressible(a.ctype) && a.size >= GZIP_MIN_SIZE && a.size <= GZIP_MAX_SIZE {
+		if a.gz = s.precompressed(name, info); a.gz == nil {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			content.Seek(0, io.SeekStart)
+			if _, err := io.Copy(zw, content); err == nil && zw.Close() == nil {
+				a.gz = buf.Bytes()
+			}
+		}
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.cache[name] = a
+	s.mu.Unlock()
+	return a, nil
+}
+
+//precompressed returns the content of name.gz when it is not older than name
+func (s *Server) precompressed(name string, info fs.FileInfo) []byte {
+	gzInfo, err := fs.Stat(s.fsys, name+".gz")
+	if err != nil || gzInfo.ModTime().Before(info.ModTime()) || gzInfo.Size() > GZIP_MAX_SIZE {
+		return nil
+	}
+	gz, err := fs.ReadFile(s.fsys, name+".gz")
+	if err != nil {
+		return nil
+	}
+	return gz
+}
+
+func compressible(ctype string) bool {
+	if strings.HasPrefix(ctype, "text/") {
+		return true
+	}
+	for _, t := range []string{"javascript", "json", "xml", "svg", "wasm"} {
+		if strings.Contains(ctype, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		enc = strings.TrimSpace(enc)
+		if enc == "gzip" || strings.HasPrefix(enc, "gzip;") && !strings.HasSuffix(strings.ReplaceAll(enc, " ", ""), "q=0") {
+			return true
+		}
+	}
+	return false
+}
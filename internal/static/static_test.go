@@ -0,0 +1,115 @@
+package static
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var modTime = time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"index.html":          {Data: []byte("<!DOCTYPE html><p>app</p>"), ModTime: modTime},
+		"css/portal.css":      {Data: []byte(strings.Repeat("body { margin: 0; }\n", 100)), ModTime: modTime},
+		"img/logo.png":        {Data: []byte("\x89PNG\r\n\x1a\n0000"), ModTime: modTime},
+		"data.bin":            {Data: []byte{0, 1, 2}, ModTime: modTime},
+		"js/app.js":           {Data: []byte(strings.Repeat("x();", 400)), ModTime: modTime},
+		"js/app.js.gz":        {Data: []byte("precompressed"), ModTime: modTime.Add(time.Second)},
+		".env":                {Data: []byte("secret"), ModTime: modTime},
+		"templates/page.html": {Data: []byte("{{.}}"), ModTime: modTime},
+		"embed.go":            {Data: []byte("package web"), ModTime: modTime},
+	}
+}
+
+func get(s *Server, target string, header map[string]string) (*httptest.ResponseRecorder, bool) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.URL.Path = target //not cleaned, as a raw request could send it
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	return w, s.Serve(w, r)
+}
+
+func TestServeRefused(t *testing.T) {
+	s := New(testFS(), Options{Deny: []string{"templates"}})
+	for _, target := range []string{"/.env", "/templates/page.html", "/embed.go", "/nope.css", "/css/../.env"} {
+		if w, ok := get(s, target, nil); ok {
+			t.Errorf("%v served: %v %q", target, w.Code, w.Body)
+		}
+	}
+	//cleaned to /conf/portalserver.json of the root, which does not exist
+	if _, ok := get(s, "/../conf/portalserver.json", nil); ok {
+		t.Errorf("traversal served")
+	}
+	if name, ok := s.name("/../../etc/passwd"); ok && name != "etc/passwd" {
+		t.Errorf("traversal resolved to %v", name)
+	}
+}
+
+func TestServeTypesAndCaching(t *testing.T) {
+	s := New(testFS(), Options{MaxAge: time.Hour})
+	for target, ctype := range map[string]string{
+		"/css/portal.css": "text/css; charset=utf-8",
+		"/img/logo.png":   "image/png",
+		"/data.bin":       "application/octet-stream",
+	} {
+		w, ok := get(s, target, nil)
+		if !ok || w.Code != 200 || w.Header().Get("Content-Type") != ctype {
+			t.Errorf("%v: %v type %q", target, w.Code, w.Header().Get("Content-Type"))
+		}
+	}
+
+	w, _ := get(s, "/css/portal.css", nil)
+	etag := w.Header().Get("ETag")
+	if etag == "" || w.Header().Get("Last-Modified") == "" || w.Header().Get("Cache-Control") != "public, max-age=3600" {
+		t.Fatalf("caching headers %v", w.Header())
+	}
+	if w, _ := get(s, "/css/portal.css", map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: %v", w.Code)
+	}
+	if w, _ := get(s, "/img/logo.png", map[string]string{"If-Modified-Since": modTime.Format(http.TimeFormat)}); w.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since: %v", w.Code)
+	}
+}
+
+func TestServeGzip(t *testing.T) {
+	s := New(testFS(), Options{Gzip: true})
+	w, _ := get(s, "/css/portal.css", map[string]string{"Accept-Encoding": "br, gzip"})
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("not compressed: %v", w.Header())
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip err:%v", err)
+	}
+	if body, _ := io.ReadAll(zr); string(body) != string(testFS()["css/portal.css"].Data) {
+		t.Errorf("compressed body differs")
+	}
+	if w, _ := get(s, "/css/portal.css", nil); w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("compressed without Accept-Encoding")
+	}
+	if w, _ := get(s, "/js/app.js", map[string]string{"Accept-Encoding": "gzip"}); w.Body.String() != "precompressed" {
+		t.Errorf("precompressed file not used")
+	}
+}
+
+func TestServeFallback(t *testing.T) {
+	s := New(testFS(), Options{SPAFallback: "index.html"})
+	w, ok := get(s, "/account/profile", map[string]string{"Accept": "text/html,*/*"})
+	if !ok || !strings.Contains(w.Body.String(), "app") || w.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("fallback: %v %v", ok, w.Header())
+	}
+	if _, ok := get(s, "/missing.js", map[string]string{"Accept": "text/html"}); ok {
+		t.Errorf("fallback for an asset")
+	}
+	if _, ok := get(s, "/account/profile", map[string]string{"Accept": "application/json"}); ok {
+		t.Errorf("fallback for an api client")
+	}
+}
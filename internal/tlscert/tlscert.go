@@ -0,0 +1,144 @@
+package tlscert
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	logger "github.com/gityf/portalserver/xlog4go"
+)
+
+const DEF_CHECK_INTERVAL = 10 * time.Second
+
+//versions accepted by ParseVersion
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+//ParseVersion returns the tls version of "1.0" to "1.3", tls.VersionTLS12 when empty
+func ParseVersion(s string) (uint16, error) {
+	if s == "" {
+		return tls.VersionTLS12, nil
+	}
+	if v, ok := versions[s]; ok {
+		return v, nil
+	}
+	return 0, fmt.Errorf("unknown tls version %q, want 1.0, 1.1, 1.2 or 1.3", s)
+}
+
+//Reloader holds the certificate of a key pair and loads it again when the files change,
+//the connections get the certificate in force at their handshake.
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	certStat fileStat
+	keyStat  fileStat
+}
+
+type fileStat struct {
+	modTime time.Time
+	size    int64
+}
+
+//NewReloader loads the key pair, the error is returned when it is invalid
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+//Reload loads the key pair now, the certificate in force is kept on error
+func (r *Reloader) Reload() error {
+	certStat, keyStat := stat(r.certFile), stat(r.keyFile)
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	cert.Leaf = leaf
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.certStat, r.keyStat = certStat, keyStat
+	r.mu.Unlock()
+	logger.Infow("tls certificate loaded", "file", r.certFile, "subject", leaf.Subject.String(),
+		"dns", leaf.DNSNames, "not_after", leaf.NotAfter.Format(time.RFC3339))
+	if time.Now().After(leaf.NotAfter) {
+		logger.Warnw("tls certificate expired", "file", r.certFile, "not_after", leaf.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+//Changed tells whether a file differs from the ones loaded
+func (r *Reloader) Changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return stat(r.certFile) != r.certStat || stat(r.keyFile) != r.keyStat
+}
+
+//Watch reloads the key pair when the files change, every interval until ctx is done
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DEF_CHECK_INTERVAL
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !r.Changed() {
+			continue
+		}
+		if err := r.Reload(); err != nil {
+			//likely caught between the writes of the cert and the key, retried on the next tick
+			logger.Errorw("tls certificate reload failed, the previous one stays in force",
+				"file", r.certFile, "err", err)
+		}
+	}
+}
+
+//Certificate returns the certificate in force
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+//GetCertificate is the tls.Config callback
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+//TLSConfig returns a server config with the certificate of r and the min version
+func (r *Reloader) TLSConfig(minVersion uint16) *tls.Config {
+	return &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+func stat(name string) fileStat {
+	info, err := os.Stat(name)
+	if err != nil {
+		return fileStat{}
+	}
+	return fileStat{info.ModTime(), info.Size()}
+}
@@ -0,0 +1,93 @@
+package tlscert
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//writePair writes a self-signed key pair for name
+func writePair(t *testing.T, certFile, keyFile, name string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+}
+
+func commonName(r *Reloader) string {
+	cert, _ := r.GetCertificate(&tls.ClientHelloInfo{})
+	return cert.Leaf.Subject.CommonName
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "portal.crt"), filepath.Join(dir, "portal.key")
+	if _, err := NewReloader(certFile, keyFile); err == nil {
+		t.Fatalf("missing files loaded")
+	}
+	writePair(t, certFile, keyFile, "old.portal")
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewReloader err:%v", err)
+	}
+	if r.Changed() || commonName(r) != "old.portal" {
+		t.Fatalf("loaded %v", commonName(r))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, 10*time.Millisecond)
+
+	//a broken key keeps the certificate in force
+	os.WriteFile(keyFile, []byte("broken"), 0600)
+	time.Sleep(50 * time.Millisecond)
+	if commonName(r) != "old.portal" {
+		t.Fatalf("broken pair replaced the certificate")
+	}
+
+	writePair(t, certFile, keyFile, "new.portal")
+	for i := 0; i < 100 && commonName(r) != "new.portal"; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if commonName(r) != "new.portal" {
+		t.Errorf("certificate not reloaded, got %v", commonName(r))
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	for s, want := range map[string]uint16{"": tls.VersionTLS12, "1.0": tls.VersionTLS10, "1.3": tls.VersionTLS13} {
+		if v, err := ParseVersion(s); err != nil || v != want {
+			t.Errorf("ParseVersion(%q) = %x, %v", s, v, err)
+		}
+	}
+	if _, err := ParseVersion("TLS1.2"); err == nil {
+		t.Errorf("TLS1.2 accepted")
+	}
+}
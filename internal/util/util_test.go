@@ -3,7 +3,6 @@ package util
 import (
 	"testing"
 	"time"
-	"fmt"
 )
 
 func TestTransToString(t *testing.T) {
@@ -63,7 +62,7 @@ func TestTransToUInt64(t *testing.T) {
 	}
 	//Warning, too large number
 	val6, _ := ToUInt64(float64(4611615694780401600))
-	if uint64(4611615694780401600) != val6 {
+	if uint64(float64(4611615694780401600)) != val6 {
 		t.Errorf("float64 to string err:%v.", val6)
 	}
 	val7, _ := ToUInt64(string("123"))
@@ -0,0 +1,580 @@
+package webhook
+
+/*
+	events of the sessions POSTed as signed JSON to a receiver, the caller never waits
+
+	<dir>/webhook.log   one line per event emitted or finished, replayed on start
+	<dir>/webhook.dead  events given up after the last attempt or with the backlog full
+
+	X-Portal-Event      type of the event
+	X-Portal-Delivery   id of the event, the same for every attempt
+	X-Portal-Timestamp  unix seconds of the attempt
+	X-Portal-Signature  sha256=hex(HMAC-SHA256(secret, timestamp + "." + body))
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gityf/portalserver/internal/jobs"
+)
+
+//types of Event
+const (
+	EVENT_LOGIN        = "login"
+	EVENT_LOGIN_FAILED = "login_failed"
+	EVENT_LOGOUT       = "logout"
+	EVENT_NTF_LOGOUT   = "ntf_logout" //the BAS logged the user out
+	EVENT_KICK         = "kick"       //the server logged the user out, see Reason
+)
+
+//results given to Options.OnResult
+const (
+	RESULT_DELIVERED = "delivered"
+	RESULT_RETRY     = "retry"
+	RESULT_DEAD      = "dead"
+)
+
+//ops given to Options.OnError
+const (
+	OP_WRITE = "write" //an event or its end appended to the backlog, with the fsync or the compaction it triggers
+	OP_SYNC  = "sync"  //fsync of the backlog every SyncInterval
+	OP_DEAD  = "dead"  //a dead letter appended
+)
+
+const (
+	BACKLOG_FILE     = "webhook.log"
+	DEAD_LETTER_FILE = "webhook.dead"
+	JOB_TYPE         = "webhook" //of the deliveries in the job queue
+
+	DEF_TIMEOUT       = 5 * time.Second
+	DEF_MAX_ATTEMPTS  = 8
+	DEF_BACKOFF       = time.Second
+	DEF_MAX_BACKOFF   = 5 * time.Minute
+	DEF_WORKERS       = 4
+	DEF_MAX_BACKLOG   = 100000
+	DEF_COMPACT_EVERY = 10000
+	DEF_SYNC_INTERVAL = time.Second
+
+	//of the answer read to reuse the connection
+	MAX_RESPONSE_BODY = 4096
+)
+
+var (
+	ErrClosed  = errors.New("webhook dispatcher closed")
+	ErrBacklog = errors.New("webhook backlog not written") //the event is queued, not kept for the next start
+)
+
+//Event of a session
+type Event struct {
+	ID        string     `json:"id"`
+	Type      string     `json:"type"`
+	Time      time.Time  `json:"time"`
+	UserName  string     `json:"username,omitempty"`
+	UserIP    string     `json:"userip"`
+	UserMac   string     `json:"usermac,omitempty"`
+	BrasIP    string     `json:"brasip"`
+	Errno     int        `json:"errno"` //USER_RET_ERR_* of the login or logout, 0 for success
+	Errmsg    string     `json:"errmsg,omitempty"`
+	Reason    string     `json:"reason,omitempty"`     //of a kick: admin, max-duration or idle
+	LoginTime *time.Time `json:"login_time,omitempty"` //of the session ended
+}
+
+//Options of a Dispatcher
+type Options struct {
+	URL          string
+	Secret       string        //key of the signature, unsigned when empty
+	Dir          string        //backlog and dead letters, in memory only when empty
+	Timeout      time.Duration //of one POST, DEF_TIMEOUT when 0
+	MaxAttempts  int           //before an event goes to the dead letters, DEF_MAX_ATTEMPTS when 0
+	Backoff      time.Duration //before the first retry, doubled after each, DEF_BACKOFF when 0
+	MaxBackoff   time.Duration //DEF_MAX_BACKOFF when 0
+	Queue        *jobs.Queue   //runs the POSTs, a queue of Workers owned by the dispatcher when nil
+	Workers      int           //of the queue owned, DEF_WORKERS when 0
+	MaxBacklog   int           //events not delivered yet, the next ones are dead letters, DEF_MAX_BACKLOG when 0
+	SyncInterval time.Duration //between two fsync of the backlog, DEF_SYNC_INTERVAL when 0, every record when < 0
+	OnResult     func(e Event, result string, err error)
+	OnError      func(op string, err error) //the backlog or the dead letters failing to be written, not called for the errors Emit returns
+}
+
+//record is one line of the backlog
+type record struct {
+	Op    string `json:"op"` //add or done
+	Event *Event `json:"event,omitempty"`
+	ID    string `json:"id,omitempty"`
+}
+
+//deadLetter is one line of the dead letters
+type deadLetter struct {
+	Event    Event     `json:"event"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	Time     time.Time `json:"time"`
+}
+
+type entry struct {
+	event    Event
+	attempts int
+}
+
+//Dispatcher delivers the events emitted in the background, retrying with backoff
+type Dispatcher struct {
+	opts   Options
+	client *http.Client
+	ctx    context.Context
+	cancel context.CancelFunc
+	queue  *jobs.Queue
+	owned  bool           //queue drained by Close
+	wg     sync.WaitGroup //deliveries running
+
+	mu      sync.Mutex
+	closed  bool
+	pending map[string]*entry //not delivered yet, queued or waiting for a retry
+	backlog *os.File
+	records int  //in the backlog
+	dirty   bool //written since the last fsync
+	dead    *os.File
+}
+
+//NewDispatcher replays the backlog of opts.Dir and queues its events
+func NewDispatcher(opts Options) (d *Dispatcher, err error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DEF_TIMEOUT
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DEF_MAX_ATTEMPTS
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DEF_BACKOFF
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DEF_MAX_BACKOFF
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = DEF_WORKERS
+	}
+	if opts.MaxBacklog <= 0 {
+		opts.MaxBacklog = DEF_MAX_BACKLOG
+	}
+	if opts.SyncInterval == 0 {
+		opts.SyncInterval = DEF_SYNC_INTERVAL
+	}
+	d = &Dispatcher{
+		opts:    opts,
+		client:  &http.Client{Timeout: opts.Timeout},
+		pending: make(map[string]*entry),
+	}
+	var replay []*entry
+	if opts.Dir != "" {
+		if err = os.MkdirAll(opts.Dir, 0700); err != nil {
+			return nil, err
+		}
+		if replay, err = d.load(); err != nil {
+			return nil, err
+		}
+		if err = d.compact(); err != nil {
+			return nil, err
+		}
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	d.queue = opts.Queue
+	if d.queue == nil {
+		d.queue, d.owned = jobs.NewQueue(jobs.Options{Workers: opts.Workers, QueueSize: opts.MaxBacklog}), true
+	}
+	for _, e := range replay {
+		d.submit(e)
+	}
+	if opts.Dir != "" && opts.SyncInterval > 0 {
+		go d.syncLoop()
+	}
+	return
+}
+
+//load reads the events of the backlog not done yet, in the order emitted
+func (d *Dispatcher) load() (list []*entry, err error) {
+	file, err := os.Open(filepath.Join(d.opts.Dir, BACKLOG_FILE))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			//the last line of a crash
+			break
+		}
+		switch {
+		case r.Op == "add" && r.Event != nil:
+			d.pending[r.Event.ID] = &entry{event: *r.Event}
+		case r.Op == "done":
+			delete(d.pending, r.ID)
+		}
+	}
+	for _, e := range d.pending {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].event.Time.Before(list[j].event.Time) })
+	return list, scanner.Err()
+}
+
+//compact rewrites the backlog with the pending events only, the caller holds d.mu or owns d
+func (d *Dispatcher) compact() error {
+	list := make([]*entry, 0, len(d.pending))
+	for _, e := range d.pending {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].event.Time.Before(list[j].event.Time) })
+	var buf bytes.Buffer
+	for _, e := range list {
+		line, _ := json.Marshal(&record{Op: "add", Event: &e.event})
+		buf.Write(append(line, '\n'))
+	}
+	name := filepath.Join(d.opts.Dir, BACKLOG_FILE)
+	if err := writeFileSync(name+".tmp", buf.Bytes()); err != nil {
+		return err
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+	if d.backlog != nil {
+		d.backlog.Close()
+	}
+	var err error
+	d.backlog, err = os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0600)
+	d.records, d.dirty = len(list), false
+	return err
+}
+
+//write appends r to the backlog, the caller holds d.mu
+func (d *Dispatcher) write(r *record) error {
+	if d.backlog == nil {
+		return nil
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err = d.backlog.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	d.records++
+	d.dirty = true
+	if d.opts.SyncInterval < 0 {
+		if err = d.backlog.Sync(); err != nil {
+			return err
+		}
+		d.dirty = false
+	}
+	if d.records >= DEF_COMPACT_EVERY && d.records > 2*len(d.pending) {
+		return d.compact()
+	}
+	return nil
+}
+
+//Sync flushes the backlog to the disk
+func (d *Dispatcher) Sync() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.backlog == nil || !d.dirty {
+		return nil
+	}
+	d.dirty = false
+	return d.backlog.Sync()
+}
+
+func (d *Dispatcher) syncLoop() {
+	ticker := time.NewTicker(d.opts.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.Sync(); err != nil {
+				d.fail(OP_SYNC, err)
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) fail(op string, err error) {
+	if d.opts.OnError != nil {
+		d.opts.OnError(op, err)
+	}
+}
+
+//Emit queues e for delivery, its ID and Time are set when empty.
+//An ErrBacklog error tells e is queued but not kept for the next start
+func (d *Dispatcher) Emit(e Event) error {
+	if e.ID == "" {
+		e.ID = newID()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return ErrClosed
+	}
+	if len(d.pending) >= d.opts.MaxBacklog {
+		err := fmt.Errorf("backlog full, %d events", len(d.pending))
+		d.writeDead(&entry{event: e}, err)
+		d.mu.Unlock()
+		d.result(e, RESULT_DEAD, err)
+		return err
+	}
+	en := &entry{event: e}
+	d.pending[e.ID] = en
+	err := d.write(&record{Op: "add", Event: &e})
+	d.mu.Unlock()
+	d.submit(en)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBacklog, err)
+	}
+	return nil
+}
+
+//submit queues the delivery of e, again after a backoff while the queue is full
+func (d *Dispatcher) submit(e *entry) {
+	switch d.queue.Submit(&delivery{d: d, e: e}) {
+	case jobs.ErrQueueFull:
+		time.AfterFunc(d.opts.Backoff, func() {
+			if d.ctx.Err() == nil {
+				d.submit(e)
+			}
+		})
+	case jobs.ErrClosed:
+		//shutting down, sent again after the next start
+	}
+}
+
+//Pending returns the count of events not delivered yet
+func (d *Dispatcher) Pending() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.pending)
+}
+
+//Close stops the deliveries, the events not delivered stay in the backlog for the next start
+func (d *Dispatcher) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	d.mu.Unlock()
+	d.cancel()
+	if d.owned {
+		d.queue.Drain(d.ctx)
+	}
+	d.wg.Wait()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var err error
+	if d.backlog != nil {
+		err = d.compact()
+		d.backlog.Close()
+		d.backlog = nil
+	}
+	if d.dead != nil {
+		d.dead.Close()
+		d.dead = nil
+	}
+	return err
+}
+
+//delivery is the job of one event, retried by the queue
+type delivery struct {
+	d *Dispatcher
+	e *entry
+}
+
+func (j *delivery) Type() string {
+	return JOB_TYPE
+}
+
+func (j *delivery) Key() string {
+	return JOB_TYPE + "/" + j.e.event.ID
+}
+
+func (j *delivery) String() string {
+	return j.e.event.Type + " " + j.e.event.ID
+}
+
+func (j *delivery) MaxAttempts() int {
+	return j.d.opts.MaxAttempts
+}
+
+func (j *delivery) Backoff(attempts int) time.Duration {
+	return j.d.backoff(attempts)
+}
+
+//Run posts the event once, the backlog keeps it when the dispatcher closes meanwhile
+func (j *delivery) Run(ctx context.Context) error {
+	d, e := j.d, j.e
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return jobs.Permanent(ErrClosed)
+	}
+	d.wg.Add(1)
+	d.mu.Unlock()
+	defer d.wg.Done()
+
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(d.ctx, cancel)
+	err := d.post(ctx, e.event)
+	canceled := errors.Is(ctx.Err(), context.Canceled)
+	stop()
+	cancel()
+	if err != nil && canceled {
+		//closing, sent again after the next start
+		return jobs.Permanent(err)
+	}
+	d.mu.Lock()
+	e.attempts++
+	result := RESULT_DELIVERED
+	switch {
+	case err == nil:
+		d.finish(e)
+	case e.attempts >= d.opts.MaxAttempts:
+		result = RESULT_DEAD
+		d.writeDead(e, err)
+		d.finish(e)
+	default:
+		result = RESULT_RETRY
+	}
+	d.mu.Unlock()
+	d.result(e.event, result, err)
+	return err
+}
+
+//finish forgets the event delivered or dead, the caller holds d.mu
+func (d *Dispatcher) finish(e *entry) {
+	delete(d.pending, e.event.ID)
+	if err := d.write(&record{Op: "done", ID: e.event.ID}); err != nil {
+		//sent again after the next start
+		d.fail(OP_WRITE, err)
+	}
+}
+
+//backoff before the retry following the attempts made
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.opts.Backoff
+	for i := 1; i < attempts && delay < d.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.opts.MaxBackoff {
+		delay = d.opts.MaxBackoff
+	}
+	return delay
+}
+
+//writeDead appends e to the dead letters, the caller holds d.mu
+func (d *Dispatcher) writeDead(e *entry, cause error) {
+	if d.opts.Dir == "" {
+		return
+	}
+	if d.dead == nil {
+		file, err := os.OpenFile(filepath.Join(d.opts.Dir, DEAD_LETTER_FILE), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			d.fail(OP_DEAD, err)
+			return
+		}
+		d.dead = file
+	}
+	line, _ := json.Marshal(&deadLetter{Event: e.event, Attempts: e.attempts, Error: cause.Error(), Time: time.Now()})
+	if _, err := d.dead.Write(append(line, '\n')); err != nil {
+		d.fail(OP_DEAD, err)
+	}
+}
+
+func (d *Dispatcher) result(e Event, result string, err error) {
+	if d.opts.OnResult != nil {
+		d.opts.OnResult(e, result, err)
+	}
+}
+
+//post sends e once, any answer but 2xx is a failure
+func (d *Dispatcher) post(ctx context.Context, e Event) error {
+	body, err := json.Marshal(&e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "portalserver-webhook")
+	req.Header.Set("X-Portal-Event", e.Type)
+	req.Header.Set("X-Portal-Delivery", e.ID)
+	req.Header.Set("X-Portal-Timestamp", timestamp)
+	if d.opts.Secret != "" {
+		req.Header.Set("X-Portal-Signature", "sha256="+Sign(d.opts.Secret, timestamp, body))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, MAX_RESPONSE_BODY))
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %v", resp.Status)
+	}
+	return nil
+}
+
+//Sign returns the hex HMAC-SHA256 of timestamp.body, as the receivers check it
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func writeFileSync(name string, cnt []byte) error {
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(cnt); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func newID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,154 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//receiver answers status for each POST in turn, 200 once they are used up
+func receiver(t *testing.T, secret string, statuses ...int) (*httptest.Server, chan Event) {
+	events := make(chan Event, 100)
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		want := "sha256=" + Sign(secret, r.Header.Get("X-Portal-Timestamp"), body)
+		if secret != "" && r.Header.Get("X-Portal-Signature") != want {
+			t.Errorf("bad signature %q", r.Header.Get("X-Portal-Signature"))
+		}
+		mu.Lock()
+		status := http.StatusOK
+		if len(statuses) > 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+		mu.Unlock()
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			var e Event
+			json.Unmarshal(body, &e)
+			events <- e
+		}
+	})), events
+}
+
+func wait(t *testing.T, events chan Event) Event {
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event delivered")
+	}
+	return Event{}
+}
+
+func TestDeliverRetry(t *testing.T) {
+	srv, events := receiver(t, "key", http.StatusInternalServerError, http.StatusBadGateway)
+	defer srv.Close()
+	d, err := NewDispatcher(Options{URL: srv.URL, Secret: "key", Backoff: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("new err:%v", err)
+	}
+	defer d.Close()
+
+	d.Emit(Event{Type: EVENT_LOGIN, UserIP: "10.0.0.1", BrasIP: "10.1.0.1", UserName: "bob"})
+	if e := wait(t, events); e.Type != EVENT_LOGIN || e.UserName != "bob" || e.ID == "" || e.Time.IsZero() {
+		t.Errorf("unexpected event %+v", e)
+	}
+	for i := 0; i < 100 && d.Pending() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if d.Pending() != 0 {
+		t.Errorf("%v events pending", d.Pending())
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	srv, _ := receiver(t, "", http.StatusInternalServerError, http.StatusInternalServerError)
+	defer srv.Close()
+	dir := t.TempDir()
+	dead := make(chan Event, 1)
+	d, err := NewDispatcher(Options{URL: srv.URL, Dir: dir, MaxAttempts: 2, Backoff: 10 * time.Millisecond,
+		OnResult: func(e Event, result string, err error) {
+			if result == RESULT_DEAD {
+				dead <- e
+			}
+		}})
+	if err != nil {
+		t.Fatalf("new err:%v", err)
+	}
+	d.Emit(Event{Type: EVENT_KICK, UserIP: "10.0.0.2", Reason: "idle"})
+	select {
+	case <-dead:
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not dead")
+	}
+	d.Close()
+	cnt, _ := os.ReadFile(filepath.Join(dir, DEAD_LETTER_FILE))
+	if !strings.Contains(string(cnt), `"reason":"idle"`) || !strings.Contains(string(cnt), `"attempts":2`) {
+		t.Errorf("dead letters %s", cnt)
+	}
+}
+
+func TestBacklogReplay(t *testing.T) {
+	dir := t.TempDir()
+	//nothing listens there, the event waits for a retry when closed
+	d, err := NewDispatcher(Options{URL: "http://127.0.0.1:1/", Dir: dir, Backoff: time.Hour})
+	if err != nil {
+		t.Fatalf("new err:%v", err)
+	}
+	d.Emit(Event{Type: EVENT_LOGOUT, UserIP: "10.0.0.3"})
+	d.Close()
+	if d.Emit(Event{Type: EVENT_LOGOUT}) != ErrClosed {
+		t.Errorf("emit after close accepted")
+	}
+
+	srv, events := receiver(t, "")
+	defer srv.Close()
+	d, err = NewDispatcher(Options{URL: srv.URL, Dir: dir})
+	if err != nil {
+		t.Fatalf("reopen err:%v", err)
+	}
+	defer d.Close()
+	if e := wait(t, events); e.Type != EVENT_LOGOUT || e.UserIP != "10.0.0.3" {
+		t.Errorf("unexpected event %+v", e)
+	}
+}
+
+func TestBacklogErrors(t *testing.T) {
+	srv, events := receiver(t, "")
+	defer srv.Close()
+	failed := make(chan string, 1)
+	d, err := NewDispatcher(Options{URL: srv.URL, Dir: t.TempDir(), SyncInterval: -1,
+		OnError: func(op string, err error) { failed <- op }})
+	if err != nil {
+		t.Fatalf("new err:%v", err)
+	}
+	defer d.Close()
+
+	//the backlog file gone bad, the event is still sent
+	d.mu.Lock()
+	d.backlog.Close()
+	d.mu.Unlock()
+	if err := d.Emit(Event{Type: EVENT_LOGIN, UserIP: "10.0.0.4"}); !errors.Is(err, ErrBacklog) {
+		t.Errorf("emit err:%v", err)
+	}
+	if e := wait(t, events); e.UserIP != "10.0.0.4" {
+		t.Errorf("unexpected event %+v", e)
+	}
+	select {
+	case op := <-failed:
+		if op != OP_WRITE {
+			t.Errorf("failed op %v", op)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("done record error not reported")
+	}
+}
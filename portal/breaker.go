@@ -0,0 +1,147 @@
+package portal
+
+import (
+	"sync"
+	"time"
+)
+
+//states of a Breaker
+const (
+	BREAKER_CLOSED    = 0 //requests go to the BAS
+	BREAKER_OPEN      = 1 //requests fail fast until the cooldown is over
+	BREAKER_HALF_OPEN = 2 //one request probes the BAS
+)
+
+const (
+	DEF_BREAKER_THRESHOLD = 5
+	DEF_BREAKER_COOLDOWN  = 30 * time.Second
+)
+
+//BreakerOptions of the circuit breaker of each BAS address
+type BreakerOptions struct {
+	Threshold     int                              //consecutive failures opening the breaker, DEF_BREAKER_THRESHOLD when 0
+	Cooldown      time.Duration                    //open time before a probe, DEF_BREAKER_COOLDOWN when 0
+	OnStateChange func(basIP string, from, to int) //called with the BREAKER_* states, lock free
+}
+
+//BreakerStatus of one BAS address
+type BreakerStatus struct {
+	BasIP    string    `json:"basip"`
+	State    string    `json:"state"`
+	Failures int       `json:"failures"` //consecutive
+	OpenedAt time.Time `json:"opened_at,omitempty"`
+}
+
+//Breaker stops sending to a BAS address after consecutive failures without any ack,
+//then lets one request through after the cooldown to find out if it is back.
+type Breaker struct {
+	basIP string
+	opts  BreakerOptions
+	now   func() time.Time
+
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+	probing  bool //the request of the half-open state is in flight
+}
+
+func NewBreaker(basIP string, opts BreakerOptions) *Breaker {
+	if opts.Threshold <= 0 {
+		opts.Threshold = DEF_BREAKER_THRESHOLD
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = DEF_BREAKER_COOLDOWN
+	}
+	return &Breaker{basIP: basIP, opts: opts, now: time.Now}
+}
+
+//Allow tells whether a request may be sent, the one allowed in half-open state
+//must be followed by Success, Failure or Release
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	from := b.state
+	allowed := false
+	switch b.state {
+	case BREAKER_CLOSED:
+		allowed = true
+	case BREAKER_OPEN:
+		if b.now().Sub(b.openedAt) >= b.opts.Cooldown {
+			b.state, b.probing, allowed = BREAKER_HALF_OPEN, true, true
+		}
+	case BREAKER_HALF_OPEN:
+		if !b.probing {
+			b.probing, allowed = true, true
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.changed(from, to)
+	return allowed
+}
+
+//Success records an ack of the BAS, whatever its errcode
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	from := b.state
+	b.state, b.failures, b.probing = BREAKER_CLOSED, 0, false
+	b.mu.Unlock()
+	b.changed(from, BREAKER_CLOSED)
+}
+
+//Failure records a request the BAS never acked
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	from := b.state
+	b.failures++
+	if b.state == BREAKER_HALF_OPEN || b.failures >= b.opts.Threshold {
+		b.state, b.openedAt = BREAKER_OPEN, b.now()
+	}
+	b.probing = false
+	to := b.state
+	b.mu.Unlock()
+	b.changed(from, to)
+}
+
+//Release gives back the probe of the half-open state without a verdict, when the caller gave up
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+func (b *Breaker) State() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := BreakerStatus{BasIP: b.basIP, State: BreakerStateString(b.state), Failures: b.failures}
+	if b.state != BREAKER_CLOSED {
+		s.OpenedAt = b.openedAt
+	}
+	return s
+}
+
+func (b *Breaker) changed(from, to int) {
+	if from != to && b.opts.OnStateChange != nil {
+		b.opts.OnStateChange(b.basIP, from, to)
+	}
+}
+
+func BreakerStateString(state int) (desc string) {
+	switch state {
+	case BREAKER_CLOSED:
+		desc = "closed"
+	case BREAKER_OPEN:
+		desc = "open"
+	case BREAKER_HALF_OPEN:
+		desc = "half-open"
+	default:
+		desc = "unknown"
+	}
+	return
+}
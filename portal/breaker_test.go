@@ -0,0 +1,53 @@
+package portal
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	var changes []string
+	b := NewBreaker("10.0.0.1", BreakerOptions{Threshold: 2, Cooldown: time.Second,
+		OnStateChange: func(basIP string, from, to int) {
+			changes = append(changes, BreakerStateString(to))
+		}})
+	b.now = func() time.Time { return now }
+
+	b.Failure()
+	if !b.Allow() {
+		t.Fatalf("open below the threshold")
+	}
+	b.Failure()
+	if b.Allow() || b.State() != BREAKER_OPEN {
+		t.Fatalf("not open at the threshold")
+	}
+
+	now = now.Add(time.Second)
+	if !b.Allow() || b.State() != BREAKER_HALF_OPEN {
+		t.Fatalf("no probe after the cooldown")
+	}
+	if b.Allow() {
+		t.Errorf("two probes in flight")
+	}
+	b.Release()
+	if !b.Allow() {
+		t.Errorf("probe not given back")
+	}
+	b.Failure()
+	if b.Allow() || b.State() != BREAKER_OPEN {
+		t.Errorf("failed probe did not open")
+	}
+
+	now = now.Add(time.Second)
+	b.Allow()
+	b.Success()
+	if !b.Allow() || b.Status().Failures != 0 {
+		t.Errorf("not closed by a successful probe: %+v", b.Status())
+	}
+	want := "open half-open open half-open closed"
+	if got := strings.Join(changes, " "); got != want {
+		t.Errorf("state changes %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,309 @@
+package portal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//pcap file format, with raw IPv4 packets as the link layer
+const (
+	PCAP_MAGIC         = 0xa1b2c3d4
+	PCAP_VERSION_MAJOR = 2
+	PCAP_VERSION_MINOR = 4
+	PCAP_SNAPLEN       = 65535
+	PCAP_LINKTYPE_RAW  = 101
+
+	pcap_file_header_len   = 24
+	pcap_record_header_len = 16
+	ipv4_header_len        = 20
+	udp_header_len         = 8
+)
+
+const (
+	DEF_CAPTURE_PREFIX   = "portal"
+	DEF_CAPTURE_MAX_SIZE = 64 << 20
+	DEF_CAPTURE_MAX_FILE = 10
+)
+
+var ErrCaptureNotIPv4 = errors.New("capture supports IPv4 only")
+
+//CaptureOptions of a Capture
+type CaptureOptions struct {
+	Dir      string   //directory of the pcap files
+	Prefix   string   //files are named <Prefix>-<time>.pcap, DEF_CAPTURE_PREFIX when empty
+	MaxSize  int64    //rotate past this size in bytes, DEF_CAPTURE_MAX_SIZE when 0
+	MaxFiles int      //files kept, DEF_CAPTURE_MAX_FILE when 0
+	BasIPs   []string //only the traffic of these BAS, every BAS when empty
+}
+
+//Capture writes the datagrams exchanged with the BAS to rotating pcap files,
+//with synthesized IPv4/UDP headers so that they open directly in Wireshark.
+//It is safe for concurrent use and does nothing until enabled.
+type Capture struct {
+	enabled int32
+
+	mu     sync.Mutex
+	opts   CaptureOptions
+	filter map[string]bool
+	file   *os.File
+	size   int64
+	ipId   uint16
+	count  uint64 //packets written
+}
+
+func NewCapture(opts CaptureOptions) *Capture {
+	if opts.Prefix == "" {
+		opts.Prefix = DEF_CAPTURE_PREFIX
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DEF_CAPTURE_MAX_SIZE
+	}
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = DEF_CAPTURE_MAX_FILE
+	}
+	c := &Capture{opts: opts}
+	c.SetFilter(opts.BasIPs)
+	return c
+}
+
+//Enable starts writing packets, a new file is opened on the first one
+func (c *Capture) Enable() {
+	atomic.StoreInt32(&c.enabled, 1)
+}
+
+//Disable stops writing packets and closes the current file
+func (c *Capture) Disable() error {
+	atomic.StoreInt32(&c.enabled, 0)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeFile()
+}
+
+func (c *Capture) Enabled() bool {
+	return c != nil && atomic.LoadInt32(&c.enabled) == 1
+}
+
+//SetFilter captures only the traffic of the BAS ips, of every BAS when empty
+func (c *Capture) SetFilter(basIPs []string) {
+	filter := make(map[string]bool, len(basIPs))
+	for _, ip := range basIPs {
+		if ip = strings.TrimSpace(ip); ip != "" {
+			filter[ip] = true
+		}
+	}
+	c.mu.Lock()
+	c.filter = filter
+	c.mu.Unlock()
+}
+
+//Filter returns the BAS ips captured, empty for every BAS
+func (c *Capture) Filter() (basIPs []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ip := range c.filter {
+		basIPs = append(basIPs, ip)
+	}
+	sort.Strings(basIPs)
+	return
+}
+
+//File returns the path of the current file, empty when none is open
+func (c *Capture) File() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.file == nil {
+		return ""
+	}
+	return c.file.Name()
+}
+
+//Count returns the number of packets written
+func (c *Capture) Count() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.count
+}
+
+//Packet records one datagram from src to dst, bas is the address of the BAS side
+func (c *Capture) Packet(src, dst net.Addr, bas string, payload []byte) error {
+	if !c.Enabled() {
+		return nil
+	}
+	from, ok1 := src.(*net.UDPAddr)
+	to, ok2 := dst.(*net.UDPAddr)
+	if !ok1 || !ok2 || from.IP.To4() == nil || to.IP.To4() == nil {
+		return ErrCaptureNotIPv4
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.filter) > 0 && !c.filter[bas] {
+		return nil
+	}
+
+	c.ipId++
+	record := pcapRecord(time.Now(), from, to, c.ipId, payload)
+	if c.file != nil && c.size+int64(len(record)) > c.opts.MaxSize {
+		if err := c.closeFile(); err != nil {
+			return err
+		}
+	}
+	if c.file == nil {
+		if err := c.openFile(); err != nil {
+			return err
+		}
+	}
+	n, err := c.file.Write(record)
+	c.size += int64(n)
+	if err == nil {
+		c.count++
+	}
+	return err
+}
+
+//Close closes the current file, the capture stays enabled
+func (c *Capture) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeFile()
+}
+
+func (c *Capture) closeFile() (err error) {
+	if c.file != nil {
+		err = c.file.Close()
+		c.file = nil
+		c.size = 0
+	}
+	return
+}
+
+func (c *Capture) openFile() error {
+	if err := os.MkdirAll(c.opts.Dir, 0700); err != nil {
+		return err
+	}
+	name := c.nextName(time.Now())
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, pcap_file_header_len)
+	binary.LittleEndian.PutUint32(header[0:], PCAP_MAGIC)
+	binary.LittleEndian.PutUint16(header[4:], PCAP_VERSION_MAJOR)
+	binary.LittleEndian.PutUint16(header[6:], PCAP_VERSION_MINOR)
+	//thiszone and sigfigs stay 0
+	binary.LittleEndian.PutUint32(header[16:], PCAP_SNAPLEN)
+	binary.LittleEndian.PutUint32(header[20:], PCAP_LINKTYPE_RAW)
+	if _, err = file.Write(header); err != nil {
+		file.Close()
+		return err
+	}
+	c.file = file
+	c.size = pcap_file_header_len
+	c.removeOldFiles()
+	return nil
+}
+
+//nextName returns a free file name for t, the names of one second sort in creation order
+func (c *Capture) nextName(t time.Time) string {
+	base := filepath.Join(c.opts.Dir, c.opts.Prefix+"-"+t.Format("20060102-150405"))
+	name := base + ".pcap"
+	for n := 1; ; n++ {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			return name
+		}
+		name = fmt.Sprintf("%v_%03d.pcap", base, n)
+	}
+}
+
+//removeOldFiles keeps the newest MaxFiles files, the current one included
+func (c *Capture) removeOldFiles() {
+	files, err := filepath.Glob(filepath.Join(c.opts.Dir, c.opts.Prefix+"-*.pcap"))
+	if err != nil || len(files) <= c.opts.MaxFiles {
+		return
+	}
+	type pcapFile struct {
+		name    string
+		modTime time.Time
+	}
+	infos := make([]pcapFile, 0, len(files))
+	for _, name := range files {
+		if info, err := os.Stat(name); err == nil {
+			infos = append(infos, pcapFile{name, info.ModTime()})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].modTime.Equal(infos[j].modTime) {
+			return infos[i].name > infos[j].name
+		}
+		return infos[i].modTime.After(infos[j].modTime)
+	})
+	for i := c.opts.MaxFiles; i < len(infos); i++ {
+		if c.file != nil && infos[i].name == c.file.Name() {
+			continue
+		}
+		os.Remove(infos[i].name)
+	}
+}
+
+//pcapRecord returns the record header, IPv4 header, UDP header and payload of one datagram
+func pcapRecord(t time.Time, src, dst *net.UDPAddr, ipId uint16, payload []byte) []byte {
+	ipLen := ipv4_header_len + udp_header_len + len(payload)
+	record := make([]byte, pcap_record_header_len+ipLen)
+
+	binary.LittleEndian.PutUint32(record[0:], uint32(t.Unix()))
+	binary.LittleEndian.PutUint32(record[4:], uint32(t.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(record[8:], uint32(ipLen))
+	binary.LittleEndian.PutUint32(record[12:], uint32(ipLen))
+
+	ip := record[pcap_record_header_len:]
+	ip[0] = 0x45 //version 4, 5 words header
+	binary.BigEndian.PutUint16(ip[2:], uint16(ipLen))
+	binary.BigEndian.PutUint16(ip[4:], ipId)
+	ip[8] = 64 //ttl
+	ip[9] = 17 //udp
+	copy(ip[12:16], src.IP.To4())
+	copy(ip[16:20], dst.IP.To4())
+	binary.BigEndian.PutUint16(ip[10:], checksum(ip[:ipv4_header_len], 0))
+
+	udp := ip[ipv4_header_len:]
+	binary.BigEndian.PutUint16(udp[0:], uint16(src.Port))
+	binary.BigEndian.PutUint16(udp[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint16(udp[4:], uint16(udp_header_len+len(payload)))
+	copy(udp[udp_header_len:], payload)
+
+	//pseudo header: addresses, protocol and udp length
+	var sum uint32
+	for i := 12; i < 20; i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(ip[i:]))
+	}
+	sum += 17 + uint32(udp_header_len+len(payload))
+	udpSum := checksum(udp, sum)
+	if udpSum == 0 {
+		udpSum = 0xffff
+	}
+	binary.BigEndian.PutUint16(udp[6:], udpSum)
+	return record
+}
+
+//internet checksum of b, sum carries a partial sum
+func checksum(b []byte, sum uint32) uint16 {
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,63 @@
+package portal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//readPcap returns the ip packets of a pcap file
+func readPcap(t *testing.T, name string) (packets [][]byte) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("read pcap err:%v", err)
+	}
+	if len(data) < pcap_file_header_len || binary.LittleEndian.Uint32(data) != PCAP_MAGIC ||
+		binary.LittleEndian.Uint32(data[20:]) != PCAP_LINKTYPE_RAW {
+		t.Fatalf("bad pcap header % x", data[:pcap_file_header_len])
+	}
+	for off := pcap_file_header_len; off < len(data); {
+		n := int(binary.LittleEndian.Uint32(data[off+8:]))
+		off += pcap_record_header_len
+		packets = append(packets, data[off:off+n])
+		off += n
+	}
+	return
+}
+
+func TestCaptureFilterAndRotate(t *testing.T) {
+	dir := t.TempDir()
+	record := pcapRecord(time.Time{}, &net.UDPAddr{IP: net.IPv4(1, 1, 1, 1), Port: 1}, &net.UDPAddr{IP: net.IPv4(2, 2, 2, 2), Port: 2}, 1, make([]byte, 100))
+	capture := NewCapture(CaptureOptions{Dir: dir, MaxSize: int64(pcap_file_header_len + 2*len(record)), MaxFiles: 2, BasIPs: []string{"2.2.2.2"}})
+	capture.Enable()
+	defer capture.Close()
+
+	src := &net.UDPAddr{IP: net.IPv4(1, 1, 1, 1), Port: 1}
+	if err := capture.Packet(src, &net.UDPAddr{IP: net.IPv4(3, 3, 3, 3), Port: 2}, "3.3.3.3", make([]byte, 100)); err != nil {
+		t.Fatalf("packet err:%v", err)
+	}
+	if capture.Count() != 0 {
+		t.Fatalf("filtered bas captured")
+	}
+	for i := 0; i < 7; i++ {
+		if err := capture.Packet(src, &net.UDPAddr{IP: net.IPv4(2, 2, 2, 2), Port: 2}, "2.2.2.2", make([]byte, 100)); err != nil {
+			t.Fatalf("packet err:%v", err)
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, DEF_CAPTURE_PREFIX+"-*.pcap"))
+	if len(files) != 2 {
+		t.Fatalf("got %v files, want 2 kept", files)
+	}
+	packets := readPcap(t, capture.File())
+	if len(packets) != 1 || !bytes.Equal(packets[0][ipv4_header_len:], record[pcap_record_header_len+ipv4_header_len:]) {
+		t.Errorf("last file holds %v packets", len(packets))
+	}
+
+	if err := capture.Packet(src, &net.UDPAddr{IP: net.ParseIP("::1"), Port: 2}, "2.2.2.2", nil); err != ErrCaptureNotIPv4 {
+		t.Errorf("ipv6 err:%v", err)
+	}
+}
@@ -0,0 +1,341 @@
+package portal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+//Options of a Client, one Client talks to one BAS
+type Options struct {
+	BasIP            string
+	BasPort          int //DEF_BAS_PORT when 0
+	SharedSecret     string
+	Version          uint          //DEF_PORTAL_VERSION1 or DEF_PORTAL_VERSION2, 2 when 0
+	AuthMode         string        //"PAP" or "CHAP", PAP when empty
+	Timeout          time.Duration //ack timeout of each attempt, DEF_TIMEOUT when 0
+	Retries          int           //attempts of each request, DEF_RETRY when 0
+	Retry            *RetryPolicy  //overrides Timeout and Retries when set
+	IsSendAffAckAuth bool
+	Logger           Logger          //nil for no log
+	Capture          *Capture        //nil for no packet capture
+	Backups          []string        //standby addresses of the BAS, in the order they are tried
+	Breaker          *BreakerOptions //circuit breaker of each address, nil for none unless Backups are set
+}
+
+//Client is safe for concurrent use, every call runs its own transaction
+type Client struct {
+	opts  Options
+	retry *RetryPolicy
+	addrs []*basAddr //BasIP then the Backups
+}
+
+//basAddr is one address of the BAS, with its breaker if any
+type basAddr struct {
+	ip      string
+	breaker *Breaker
+}
+
+//Result of a successful request
+type Result struct {
+	SerialNo uint16
+	ReqID    uint16
+	TextInfo string
+	PortInfo string //only for Info
+	Usage    Usage  //only for Info
+	BasIP    string //address that answered, BasIP or one of the Backups
+}
+
+//Error of a failed request
+type Error struct {
+	Op       string //login, logout or info
+	Code     uint8  //PCMERR_*
+	Failure  uint8  //PCMFAIL_* of the last request/ack exchange
+	TextInfo string //TEXTINFO attribute from the BAS if any
+}
+
+func (e *Error) Error() string {
+	desc := fmt.Sprintf("portal %v: %v", e.Op, ErrCodeString(e.Code))
+	if e.Failure != PCMFAIL_NONE {
+		desc += ", " + FailureString(e.Failure)
+	}
+	if e.TextInfo != "" {
+		desc += ", " + e.TextInfo
+	}
+	return desc
+}
+
+//ErrorCode returns the PCMERR_* code of err, PCMERR_OK for nil
+func ErrorCode(err error) uint8 {
+	if err == nil {
+		return PCMERR_OK
+	}
+	var pe *Error
+	if errors.As(err, &pe) {
+		return pe.Code
+	}
+	return PCMERR_UNKNOWN
+}
+
+//NewClient checks opts and creates a client of the BAS
+func NewClient(opts Options) (*Client, error) {
+	if net.ParseIP(opts.BasIP) == nil {
+		return nil, fmt.Errorf("portal: invalid bas ip %q", opts.BasIP)
+	}
+	if opts.BasPort < 0 || opts.BasPort > 0xFFFF {
+		return nil, fmt.Errorf("portal: invalid bas port %v", opts.BasPort)
+	}
+	if opts.BasPort == 0 {
+		opts.BasPort = DEF_BAS_PORT
+	}
+	switch opts.Version {
+	case 0:
+		opts.Version = DEF_PORTAL_VERSION2
+	case DEF_PORTAL_VERSION1, DEF_PORTAL_VERSION2:
+	default:
+		return nil, fmt.Errorf("portal: invalid version %v", opts.Version)
+	}
+	switch opts.AuthMode {
+	case "":
+		opts.AuthMode = "PAP"
+	case "PAP", "CHAP":
+	default:
+		return nil, fmt.Errorf("portal: invalid auth mode %q", opts.AuthMode)
+	}
+	if opts.Version == DEF_PORTAL_VERSION2 && opts.SharedSecret == "" {
+		return nil, errors.New("portal: shared secret is required by version 2")
+	}
+	for _, ip := range opts.Backups {
+		if net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("portal: invalid backup bas ip %q", ip)
+		}
+	}
+	if opts.Breaker == nil && len(opts.Backups) > 0 {
+		//the backups are used when the breaker of the BAS is open
+		opts.Breaker = &BreakerOptions{}
+	}
+
+	c := &Client{opts: opts}
+	for _, ip := range append([]string{opts.BasIP}, opts.Backups...) {
+		addr := &basAddr{ip: ip}
+		if opts.Breaker != nil {
+			addr.breaker = NewBreaker(ip, *opts.Breaker)
+		}
+		c.addrs = append(c.addrs, addr)
+	}
+	if opts.Retry != nil {
+		c.retry = opts.Retry
+		c.retry.Normalize()
+	} else {
+		retries := opts.Retries
+		if retries == 0 {
+			retries = DEF_RETRY
+		}
+		c.retry = NewRetryPolicy(retries, opts.Timeout)
+	}
+	return c, nil
+}
+
+//Options returns the options in use, defaults filled
+func (c *Client) Options() Options {
+	return c.opts
+}
+
+//NewPortalClient creates the state of one transaction with the options of c
+func (c *Client) NewPortalClient(userName, password, userIP string) *PortalClient {
+	return &PortalClient{
+		UserName:         userName,
+		Password:         password,
+		BrasIP:           c.opts.BasIP,
+		UserIP:           userIP,
+		AuthType:         c.opts.AuthMode,
+		IsSendAffAckAuth: c.opts.IsSendAffAckAuth,
+		RetryPolicy:      c.retry,
+		SharedSecret:     c.opts.SharedSecret,
+		BrasPort:         c.opts.BasPort,
+		PortalVersion:    c.opts.Version,
+		Logger:           c.opts.Logger,
+		Capture:          c.opts.Capture,
+	}
+}
+
+//Breakers returns the status of the breaker of each address, none without breaker
+func (c *Client) Breakers() (list []BreakerStatus) {
+	for _, addr := range c.addrs {
+		if addr.breaker != nil {
+			list = append(list, addr.breaker.Status())
+		}
+	}
+	return
+}
+
+//newTransaction is NewPortalClient of the address, logging to the Logger of ctx if any
+func (c *Client) newTransaction(ctx context.Context, addr *basAddr, userName, password, userIP string) *PortalClient {
+	p := c.NewPortalClient(userName, password, userIP)
+	p.BrasIP = addr.ip
+	if l := LoggerFromContext(ctx); l != nil {
+		p.Logger = l
+	}
+	p.OnStatus = StatusFuncFromContext(ctx)
+	p.OnAffAck = AffAckFuncFromContext(ctx)
+	return p
+}
+
+type statusFuncKey struct{}
+
+//ContextWithStatusFunc returns a copy of ctx carrying f, a Login with that ctx
+//calls f with each PCMSTATUS_* stage it enters
+func ContextWithStatusFunc(ctx context.Context, f func(status uint8)) context.Context {
+	return context.WithValue(ctx, statusFuncKey{}, f)
+}
+
+//StatusFuncFromContext returns the function carried by ctx, nil if none
+func StatusFuncFromContext(ctx context.Context) func(status uint8) {
+	if ctx == nil {
+		return nil
+	}
+	f, _ := ctx.Value(statusFuncKey{}).(func(status uint8))
+	return f
+}
+
+//AffAckAuth is the AFF_ACK_AUTH a login owes the address BasIP once its ACK_AUTH is accepted
+type AffAckAuth struct {
+	BasIP    string
+	UserIP   string
+	SerialNo uint16 //of the REQ_AUTH
+	ReqID    uint16 //of the ACK_AUTH
+}
+
+type affAckFuncKey struct{}
+
+//ContextWithAffAckFunc returns a copy of ctx carrying f, a Login with that ctx
+//calls f before sending the AFF_ACK_AUTH it owes
+func ContextWithAffAckFunc(ctx context.Context, f func(a AffAckAuth)) context.Context {
+	return context.WithValue(ctx, affAckFuncKey{}, f)
+}
+
+//AffAckFuncFromContext returns the function carried by ctx, nil if none
+func AffAckFuncFromContext(ctx context.Context) func(a AffAckAuth) {
+	if ctx == nil {
+		return nil
+	}
+	f, _ := ctx.Value(affAckFuncKey{}).(func(a AffAckAuth))
+	return f
+}
+
+//candidates returns the address basIP, or every address in order when basIP is empty or not one of them
+func (c *Client) candidates(basIP string) []*basAddr {
+	for _, addr := range c.addrs {
+		if basIP != "" && addr.ip == basIP {
+			return []*basAddr{addr}
+		}
+	}
+	return c.addrs
+}
+
+//run runs the transaction on the first address whose breaker lets it through, and on the next
+//ones while the BAS does not answer and ctx is not done, telling each breaker how the BAS answered
+func (c *Client) run(ctx context.Context, op, basIP, userName, password, userIP string, do func(*PortalClient) bool) (*Result, error) {
+	var p *PortalClient
+	for _, addr := range c.candidates(basIP) {
+		if addr.breaker != nil && !addr.breaker.Allow() {
+			continue
+		}
+		p = c.newTransaction(ctx, addr, userName, password, userIP)
+		ok := do(p)
+		if addr.breaker != nil {
+			switch {
+			case ok:
+				addr.breaker.Success()
+			case p.LastFailure == PCMFAIL_SEND, p.LastFailure == PCMFAIL_TIMEOUT, p.LastFailure == PCMFAIL_DEADLINE:
+				addr.breaker.Failure()
+			case p.LastFailure == PCMFAIL_CANCELED:
+				addr.breaker.Release()
+			default:
+				//acked, a refusal or a bad authenticator says nothing of the reachability
+				addr.breaker.Success()
+			}
+		}
+		if ok {
+			return p.result(), nil
+		}
+		if p.LastFailure != PCMFAIL_SEND && p.LastFailure != PCMFAIL_TIMEOUT || ctx.Err() != nil {
+			break
+		}
+	}
+	if p == nil {
+		//fail fast, the BAS did not answer the last requests
+		return nil, &Error{Op: op, Code: PCMERR_RECVTIMEOUT, Failure: PCMFAIL_CIRCUIT_OPEN}
+	}
+	return nil, p.newError(op)
+}
+
+//Login authenticates the user, with REQ_CHALLENGE first for CHAP
+func (c *Client) Login(ctx context.Context, userName, password, userIP string) (*Result, error) {
+	return c.run(ctx, "login", "", userName, password, userIP, func(p *PortalClient) bool {
+		return p.ReqLoginContext(ctx)
+	})
+}
+
+//Logout logs the user off the BAS
+func (c *Client) Logout(ctx context.Context, userName, userIP string) (*Result, error) {
+	return c.LogoutAt(ctx, "", userName, userIP)
+}
+
+//LogoutAt logs the user off the address basIP, the Result.BasIP of its login, without failover
+//as no other address holds the session. An address c does not know falls back to Logout
+func (c *Client) LogoutAt(ctx context.Context, basIP, userName, userIP string) (*Result, error) {
+	return c.run(ctx, "logout", basIP, userName, "", userIP, func(p *PortalClient) bool {
+		return p.ReqLogoutContext(ctx)
+	})
+}
+
+//Info queries the port info of the user by REQ_INFO
+func (c *Client) Info(ctx context.Context, userIP string) (*Result, error) {
+	return c.InfoAt(ctx, "", userIP)
+}
+
+//InfoAt queries the address basIP only, the one holding the session of the user.
+//An address c does not know falls back to Info
+func (c *Client) InfoAt(ctx context.Context, basIP, userIP string) (*Result, error) {
+	return c.run(ctx, "info", basIP, "", "", userIP, func(p *PortalClient) bool {
+		return p.ReqVlaninfoContext(ctx)
+	})
+}
+
+//SendAffAckAuth sends the AFF_ACK_AUTH a, owed by a login stopped before sending it
+func (c *Client) SendAffAckAuth(ctx context.Context, a AffAckAuth) error {
+	p := c.newTransaction(ctx, c.candidates(a.BasIP)[0], "", "", a.UserIP)
+	p.SerialNo, p.ReqId = a.SerialNo, a.ReqID
+	if !p.MakeRequestPacket(PACKETTYPE_AFFACKAUTH) || !p.SendReqAndRecvAckPktContext(ctx, PACKETTYPE_AFFACKAUTH) {
+		return p.newError("aff_ack_auth")
+	}
+	return nil
+}
+
+func (p *PortalClient) newError(op string) *Error {
+	code := p.ErrCode
+	if code == PCMERR_OK {
+		//failed before any ack was checked
+		code = PCMERR_UNKNOWN
+	}
+	return &Error{
+		Op:       op,
+		Code:     code,
+		Failure:  p.LastFailure,
+		TextInfo: p.TextInfo,
+	}
+}
+
+func (p *PortalClient) result() *Result {
+	return &Result{
+		SerialNo: p.SerialNo,
+		ReqID:    p.ReqId,
+		TextInfo: p.TextInfo,
+		PortInfo: p.PortInfo,
+		Usage:    p.Usage,
+		BasIP:    p.BrasIP,
+	}
+}
@@ -0,0 +1,352 @@
+package portal_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gityf/portalserver/portal"
+	"github.com/gityf/portalserver/portal/portaltest"
+)
+
+func newTestClient(t *testing.T, port int, secret, authMode string) *portal.Client {
+	c, err := portal.NewClient(portal.Options{
+		BasIP:        "127.0.0.1",
+		BasPort:      port,
+		SharedSecret: secret,
+		AuthMode:     authMode,
+		Timeout:      100 * time.Millisecond,
+		Retries:      2,
+	})
+	if err != nil {
+		t.Fatalf("new client err:%v", err)
+	}
+	return c
+}
+
+func TestClientLoginChap(t *testing.T) {
+	port, stop := portaltest.FakeBAS(t, "secret", func(req *portal.PortalPacket) *portal.PortalPacket {
+		switch req.PortalType {
+		case portal.PACKETTYPE_REQCHALLENGE:
+			return &portal.PortalPacket{
+				PortalType: portal.PACKETTYPE_ACKCHALLENGE,
+				ReqID:      7,
+				AVPS: []portal.AttributeValuePair{
+					{Type: portal.ATTRTYPE_CHALLENGE, Length: 16, Content: "0123456789abcdef"},
+				},
+			}
+		case portal.PACKETTYPE_REQAUTH:
+			if exist, _ := req.GetAttrByType(portal.ATTRTYPE_CHAPPASSWD); !exist || req.ReqID != 7 {
+				return &portal.PortalPacket{PortalType: portal.PACKETTYPE_ACKAUTH, ErrCode: 1}
+			}
+			return &portal.PortalPacket{
+				PortalType: portal.PACKETTYPE_ACKAUTH,
+				ReqID:      7,
+				AVPS:       []portal.AttributeValuePair{{Type: portal.ATTRTYPE_TEXTINFO, Length: 7, Content: "welcome"}},
+			}
+		}
+		return nil
+	})
+	defer stop()
+
+	var stages []uint8
+	ctx := portal.ContextWithStatusFunc(context.Background(), func(status uint8) { stages = append(stages, status) })
+	res, err := newTestClient(t, port, "secret", "CHAP").Login(ctx, "user", "pass", "10.0.0.3")
+	if err != nil {
+		t.Fatalf("login err:%v", err)
+	}
+	if res.ReqID != 7 || res.TextInfo != "welcome" {
+		t.Errorf("unexpected result:%+v", res)
+	}
+	if len(stages) != 2 || stages[0] != portal.PCMSTATUS_CHALLENGE || stages[1] != portal.PCMSTATUS_AUTH {
+		t.Errorf("stages %v", stages)
+	}
+}
+
+func TestClientLoginRefused(t *testing.T) {
+	port, stop := portaltest.FakeBAS(t, "secret", func(req *portal.PortalPacket) *portal.PortalPacket {
+		return &portal.PortalPacket{PortalType: portal.PACKETTYPE_ACKAUTH, ErrCode: 1}
+	})
+	defer stop()
+
+	_, err := newTestClient(t, port, "secret", "PAP").Login(context.Background(), "user", "bad", "10.0.0.4")
+	if portal.ErrorCode(err) != portal.PCMERR_AUTHREFUSED {
+		t.Errorf("expect auth refused, got:%v", err)
+	}
+}
+
+func TestClientWrongSecret(t *testing.T) {
+	port, stop := portaltest.FakeBAS(t, "secret", func(req *portal.PortalPacket) *portal.PortalPacket {
+		return &portal.PortalPacket{PortalType: portal.PACKETTYPE_ACKINFO}
+	})
+	defer stop()
+
+	//the fake BAS drops requests it can not verify, sign the acks with the
+	//right secret and check them with the wrong one instead
+	c := newTestClient(t, port, "secret", "PAP")
+	p := c.NewPortalClient("", "", "10.0.0.5")
+	p.MakeRequestPacket(portal.PACKETTYPE_REQINFO)
+	p.Packet.SharedSecret = "wrong"
+	if p.SendReqAndRecvAckPkt(portal.PACKETTYPE_REQINFO) || p.LastFailure != portal.PCMFAIL_AUTHENTICATOR {
+		t.Errorf("expect authenticator mismatch, got:%v", portal.FailureString(p.LastFailure))
+	}
+	p.ReleaseSerialNo()
+
+	if _, err := c.Info(context.Background(), "10.0.0.5"); err != nil {
+		t.Errorf("info err:%v", err)
+	}
+}
+
+func TestClientInfoUsage(t *testing.T) {
+	port, stop := portaltest.FakeBAS(t, "secret", func(req *portal.PortalPacket) *portal.PortalPacket {
+		return &portal.PortalPacket{
+			PortalType: portal.PACKETTYPE_ACKINFO,
+			AVPS: []portal.AttributeValuePair{
+				{Type: portal.ATTRTYPE_UPLINKFLUX, Length: 4, Content: "\x00\x00\x01\x00"},
+				{Type: portal.ATTRTYPE_DOWNLINKFLUX, Length: 8, Content: "\x00\x00\x00\x01\x00\x00\x00\x00"},
+				{Type: portal.ATTRTYPE_DELAYTIME, Length: 4, Content: "\x00\x00\x00\x3c"},
+			},
+		}
+	})
+	defer stop()
+
+	res, err := newTestClient(t, port, "secret", "PAP").Info(context.Background(), "10.0.0.6")
+	if err != nil {
+		t.Fatalf("info err:%v", err)
+	}
+	want := portal.Usage{UplinkFlux: 256, DownlinkFlux: 1 << 32, HasFlux: true, DelayTime: time.Minute, HasDelayTime: true}
+	if res.Usage != want {
+		t.Errorf("usage %+v, want %+v", res.Usage, want)
+	}
+}
+
+func TestNewClientOptions(t *testing.T) {
+	bad := []portal.Options{
+		{BasIP: "bas", SharedSecret: "s"},
+		{BasIP: "127.0.0.1", SharedSecret: "s", Version: 3},
+		{BasIP: "127.0.0.1", SharedSecret: "s", AuthMode: "EAP"},
+		{BasIP: "127.0.0.1"},
+	}
+	for _, opts := range bad {
+		if _, err := portal.NewClient(opts); err == nil {
+			t.Errorf("expect error for %+v", opts)
+		}
+	}
+	c, err := portal.NewClient(portal.Options{BasIP: "127.0.0.1", SharedSecret: "s"})
+	if err != nil {
+		t.Fatalf("new client err:%v", err)
+	}
+	if opts := c.Options(); opts.BasPort != portal.DEF_BAS_PORT || opts.AuthMode != "PAP" || opts.Version != portal.DEF_PORTAL_VERSION2 {
+		t.Errorf("defaults not filled:%+v", opts)
+	}
+}
+
+func TestClientFailover(t *testing.T) {
+	port, stop := portaltest.FakeBAS(t, "secret", func(req *portal.PortalPacket) *portal.PortalPacket {
+		return &portal.PortalPacket{PortalType: portal.PACKETTYPE_ACKINFO}
+	})
+	defer stop()
+	newClient := func(backups ...string) *portal.Client {
+		c, err := portal.NewClient(portal.Options{
+			BasIP:        "127.0.0.2", //nothing listens there
+			BasPort:      port,
+			SharedSecret: "secret",
+			Timeout:      100 * time.Millisecond,
+			Retries:      1,
+			Backups:      backups,
+			Breaker:      &portal.BreakerOptions{Threshold: 1, Cooldown: time.Hour},
+		})
+		if err != nil {
+			t.Fatalf("NewClient err:%v", err)
+		}
+		return c
+	}
+
+	c := newClient("127.0.0.1")
+	res, err := c.Info(context.Background(), "10.0.0.5")
+	if err != nil || res.BasIP != "127.0.0.1" {
+		t.Fatalf("no failover to the backup: %v %+v", err, res)
+	}
+	//the primary is not tried while its breaker is open
+	begin := time.Now()
+	res, err = c.Info(context.Background(), "10.0.0.5")
+	if err != nil || res.BasIP != "127.0.0.1" || time.Since(begin) > 50*time.Millisecond {
+		t.Fatalf("primary tried again: %v %+v in %v", err, res, time.Since(begin))
+	}
+	if states := c.Breakers(); len(states) != 2 || states[0].State != "open" || states[1].State != "closed" {
+		t.Errorf("breakers %+v", states)
+	}
+
+	c = newClient()
+	c.Info(context.Background(), "10.0.0.5")
+	begin = time.Now()
+	_, err = c.Info(context.Background(), "10.0.0.5")
+	var pe *portal.Error
+	if !errors.As(err, &pe) || pe.Code != portal.PCMERR_RECVTIMEOUT || pe.Failure != portal.PCMFAIL_CIRCUIT_OPEN || time.Since(begin) > 10*time.Millisecond {
+		t.Errorf("not failing fast: %v in %v", err, time.Since(begin))
+	}
+}
+
+func TestClientLoginFailover(t *testing.T) {
+	port, stop := portaltest.FakeBAS(t, "secret", func(req *portal.PortalPacket) *portal.PortalPacket {
+		if req.PortalType == portal.PACKETTYPE_REQLOGOUT {
+			return &portal.PortalPacket{PortalType: portal.PACKETTYPE_ACKLOGOUT}
+		}
+		return &portal.PortalPacket{PortalType: portal.PACKETTYPE_ACKAUTH}
+	})
+	defer stop()
+	c, err := portal.NewClient(portal.Options{
+		BasIP:        "127.0.0.2", //nothing listens there
+		BasPort:      port,
+		SharedSecret: "secret",
+		Timeout:      100 * time.Millisecond,
+		Retries:      1,
+		Backups:      []string{"127.0.0.1"},
+		Breaker:      &portal.BreakerOptions{Threshold: 5, Cooldown: time.Hour},
+	})
+	if err != nil {
+		t.Fatalf("NewClient err:%v", err)
+	}
+
+	//the breaker of the primary still closed, the same call moves on to the backup
+	res, err := c.Login(context.Background(), "user", "pass", "10.0.0.7")
+	if err != nil || res.BasIP != "127.0.0.1" {
+		t.Fatalf("login not failed over: %v %+v", err, res)
+	}
+	if states := c.Breakers(); states[0].State != "closed" || states[0].Failures != 1 {
+		t.Errorf("breakers %+v", states)
+	}
+
+	//the logout goes to the address of the login only
+	if res, err := c.LogoutAt(context.Background(), res.BasIP, "user", "10.0.0.7"); err != nil || res.BasIP != "127.0.0.1" {
+		t.Errorf("logout at the backup: %v %+v", err, res)
+	}
+	if _, err := c.LogoutAt(context.Background(), "127.0.0.2", "user", "10.0.0.7"); portal.ErrorCode(err) != portal.PCMERR_RECVTIMEOUT {
+		t.Errorf("logout at the primary failed over: %v", err)
+	}
+}
+
+func TestAffAckAuth(t *testing.T) {
+	affs := make(chan *portal.PortalPacket, 2)
+	port, stop := portaltest.FakeBAS(t, "secret", func(req *portal.PortalPacket) *portal.PortalPacket {
+		if req.PortalType == portal.PACKETTYPE_AFFACKAUTH {
+			affs <- req
+			return nil
+		}
+		return &portal.PortalPacket{PortalType: portal.PACKETTYPE_ACKAUTH, ReqID: 9}
+	})
+	defer stop()
+	c, err := portal.NewClient(portal.Options{
+		BasIP:            "127.0.0.1",
+		BasPort:          port,
+		SharedSecret:     "secret",
+		Timeout:          100 * time.Millisecond,
+		IsSendAffAckAuth: true,
+	})
+	if err != nil {
+		t.Fatalf("new client err:%v", err)
+	}
+
+	var owed portal.AffAckAuth
+	ctx := portal.ContextWithAffAckFunc(context.Background(), func(a portal.AffAckAuth) { owed = a })
+	if _, err := c.Login(ctx, "user", "pass", "10.0.0.7"); err != nil {
+		t.Fatalf("login err:%v", err)
+	}
+	if owed.BasIP != "127.0.0.1" || owed.UserIP != "10.0.0.7" || owed.ReqID != 9 || owed.SerialNo == 0 {
+		t.Fatalf("owed %+v", owed)
+	}
+
+	//sent again as after a restart, the same serial no and req id
+	if err := c.SendAffAckAuth(context.Background(), owed); err != nil {
+		t.Fatalf("send err:%v", err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case aff := <-affs:
+			if aff.SerialNo != owed.SerialNo || aff.ReqID != owed.ReqID {
+				t.Errorf("aff_ack_auth %v: serialno %v reqid %v", i, aff.SerialNo, aff.ReqID)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("aff_ack_auth %v not received", i)
+		}
+	}
+}
+
+func TestCaptureInfo(t *testing.T) {
+	port, stop := portaltest.FakeBAS(t, "secret", func(req *portal.PortalPacket) *portal.PortalPacket {
+		return &portal.PortalPacket{PortalType: portal.PACKETTYPE_ACKINFO}
+	})
+	defer stop()
+
+	dir := t.TempDir()
+	capture := portal.NewCapture(portal.CaptureOptions{Dir: dir})
+	c, err := portal.NewClient(portal.Options{
+		BasIP:        "127.0.0.1",
+		BasPort:      port,
+		SharedSecret: "secret",
+		Timeout:      100 * time.Millisecond,
+		Capture:      capture,
+	})
+	if err != nil {
+		t.Fatalf("new client err:%v", err)
+	}
+
+	//off until enabled
+	if _, err := c.Info(context.Background(), "10.0.0.1"); err != nil {
+		t.Fatalf("info err:%v", err)
+	}
+	if capture.File() != "" {
+		t.Fatalf("capture wrote while disabled")
+	}
+
+	capture.Enable()
+	if _, err := c.Info(context.Background(), "10.0.0.1"); err != nil {
+		t.Fatalf("info err:%v", err)
+	}
+	name := capture.File()
+	if err := capture.Disable(); err != nil {
+		t.Fatalf("disable err:%v", err)
+	}
+
+	packets := portal.ReadPcapPackets(t, name)
+	if len(packets) != 2 {
+		t.Fatalf("got %v packets, want request and ack", len(packets))
+	}
+	for i, ip := range packets {
+		if portal.Checksum(ip[:portal.IPV4_HEADER_LEN], 0) != 0 {
+			t.Errorf("packet %v: bad ip checksum", i)
+		}
+		udp := ip[portal.IPV4_HEADER_LEN:]
+		var sum uint32
+		for j := 12; j < 20; j += 2 {
+			sum += uint32(binary.BigEndian.Uint16(ip[j:]))
+		}
+		sum += 17 + uint32(len(udp))
+		if portal.Checksum(udp, sum) != 0 {
+			t.Errorf("packet %v: bad udp checksum", i)
+		}
+		p := &portal.PortalPacket{Raw: udp[portal.UDP_HEADER_LEN:], PackageLen: len(udp) - portal.UDP_HEADER_LEN, PortalVersion: portal.DEF_PORTAL_VERSION2}
+		if err := p.UnMarshal(); err != nil {
+			t.Fatalf("packet %v: unmarshal err:%v", i, err)
+		}
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatalf("open err:%v", err)
+	}
+	defer file.Close()
+	datagrams, err := portal.ReadPcap(file)
+	if err != nil || len(datagrams) != 2 {
+		t.Fatalf("read pcap: %v datagrams, err:%v", len(datagrams), err)
+	}
+	if datagrams[0].Dst.Port != port || datagrams[1].Src.Port != port || datagrams[1].Index != 2 {
+		t.Errorf("ports not those of the bas %v: %v -> %v", port, datagrams[0].Src, datagrams[0].Dst)
+	}
+	if !bytes.Equal(datagrams[0].Payload, packets[0][portal.IPV4_HEADER_LEN+portal.UDP_HEADER_LEN:]) {
+		t.Errorf("payload differs")
+	}
+}
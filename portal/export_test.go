@@ -0,0 +1,13 @@
+package portal
+
+//internals checked by the tests of package portal_test
+
+const (
+	IPV4_HEADER_LEN = ipv4_header_len
+	UDP_HEADER_LEN  = udp_header_len
+)
+
+var (
+	Checksum        = checksum
+	ReadPcapPackets = readPcap
+)
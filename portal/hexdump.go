@@ -0,0 +1,44 @@
+package portal
+
+import (
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var ErrNoHexDump = errors.New("no hex bytes found")
+
+//a line of hex.Dump: offset, up to 16 bytes and the ascii column
+var hexDumpLine = regexp.MustCompile(`^\s*[0-9a-fA-F]{8}\s{2}((?:[0-9a-fA-F]{2}\s{1,2}){0,15}[0-9a-fA-F]{2})`)
+
+//ParseHexDump returns the bytes of the output of HexDumpString, log line prefixes and the
+//full dump header ignored. text without any dump line is read as plain hex, where spaces,
+//colons, commas and 0x prefixes are ignored.
+func ParseHexDump(text string) (raw []byte, err error) {
+	var dump strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		//the log prefix of the first line ends before the dump
+		if i := strings.Index(line, "00000000  "); i > 0 {
+			line = line[i:]
+		}
+		if m := hexDumpLine.FindStringSubmatch(line); m != nil {
+			dump.WriteString(m[1])
+		}
+	}
+	hexText := dump.String()
+	if hexText == "" {
+		hexText = strings.NewReplacer("0x", "", "0X", "").Replace(text)
+	}
+	hexText = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n', ':', ',':
+			return -1
+		}
+		return r
+	}, hexText)
+	if hexText == "" {
+		return nil, ErrNoHexDump
+	}
+	return hex.DecodeString(hexText)
+}
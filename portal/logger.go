@@ -0,0 +1,60 @@
+package portal
+
+import (
+	"context"
+)
+
+//Logger receives the protocol logs of the client, *xlog4go.Logger satisfies it
+type Logger interface {
+	Trace(format string, args ...interface{})
+	Debug(format string, args ...interface{})
+	Info(format string, args ...interface{})
+	Warn(format string, args ...interface{})
+	Error(format string, args ...interface{})
+}
+
+//FieldLogger is a Logger able to derive a child logger carrying one more field,
+//the client adds the serialno of the transaction to the records of such a logger
+type FieldLogger interface {
+	Logger
+	WithField(key string, value interface{}) Logger
+}
+
+//modules of the client logs, a ModuleLogger gives each its own logger
+const (
+	LOG_MODULE_CLIENT = "portal" //request/ack state machine
+	LOG_MODULE_CODEC  = "codec"  //packet encoding and decoding
+	LOG_MODULE_UDP    = "udp"    //socket io with the BAS
+)
+
+//ModuleLogger is a Logger able to derive the logger of a module, so that each
+//module of the client can have its own level
+type ModuleLogger interface {
+	Logger
+	Module(name string) Logger
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Trace(format string, args ...interface{}) {}
+func (nopLogger) Debug(format string, args ...interface{}) {}
+func (nopLogger) Info(format string, args ...interface{})  {}
+func (nopLogger) Warn(format string, args ...interface{})  {}
+func (nopLogger) Error(format string, args ...interface{}) {}
+
+type loggerKey struct{}
+
+//ContextWithLogger returns a copy of ctx carrying l, requests of a Client
+//with that ctx log to l instead of Options.Logger
+func ContextWithLogger(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+//LoggerFromContext returns the Logger carried by ctx, nil if none
+func LoggerFromContext(ctx context.Context) Logger {
+	if ctx == nil {
+		return nil
+	}
+	l, _ := ctx.Value(loggerKey{}).(Logger)
+	return l
+}
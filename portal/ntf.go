@@ -0,0 +1,20 @@
+package portal
+
+//DEF_NTF_PORT is the port of the portal server the BAS sends NTF_LOGOUT to
+const DEF_NTF_PORT = 50100
+
+//NtfLogoutAck returns the ACK_LOGOUT answering the NTF_LOGOUT ntf, signed with secret
+func NtfLogoutAck(ntf *PortalPacket, secret string) *PortalPacket {
+	return &PortalPacket{
+		Version:       ntf.Version,
+		PortalVersion: ntf.PortalVersion,
+		PackageType:   PACKETTYPE_RSP,
+		PortalType:    PACKETTYPE_ACKLOGOUT,
+		AuthMode:      ntf.AuthMode,
+		SerialNo:      ntf.SerialNo,
+		ReqID:         ntf.ReqID,
+		UserIP:        ntf.UserIP,
+		SharedSecret:  secret,
+		Authenticator: ntf.Authenticator,
+	}
+}
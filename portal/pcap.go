@@ -0,0 +1,128 @@
+package portal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+//link types read by ReadPcap besides PCAP_LINKTYPE_RAW
+const (
+	PCAP_LINKTYPE_ETHERNET  = 1
+	PCAP_LINKTYPE_LINUX_SLL = 113
+	PCAP_LINKTYPE_IPV4      = 228
+
+	pcap_magic_nsec     = 0xa1b23c4d
+	pcap_record_max_len = 262144
+)
+
+var ErrNotPcap = errors.New("not a pcap file")
+
+//PcapPacket is one UDP datagram of a pcap file
+type PcapPacket struct {
+	Index   int //1 based number of the record in the file, as shown by Wireshark
+	Time    time.Time
+	Src     *net.UDPAddr
+	Dst     *net.UDPAddr
+	Payload []byte
+}
+
+//ReadPcap returns the UDP datagrams over IPv4 of a pcap file, the other records are skipped.
+//ethernet, linux cooked and raw IP link types are supported
+func ReadPcap(r io.Reader) (packets []PcapPacket, err error) {
+	header := make([]byte, pcap_file_header_len)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return nil, ErrNotPcap
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	magic := order.Uint32(header)
+	if magic != PCAP_MAGIC && magic != pcap_magic_nsec {
+		order = binary.BigEndian
+		if magic = order.Uint32(header); magic != PCAP_MAGIC && magic != pcap_magic_nsec {
+			return nil, ErrNotPcap
+		}
+	}
+	linkType := order.Uint32(header[20:]) & 0x0fffffff
+	switch linkType {
+	case PCAP_LINKTYPE_RAW, PCAP_LINKTYPE_IPV4, PCAP_LINKTYPE_ETHERNET, PCAP_LINKTYPE_LINUX_SLL:
+	default:
+		return nil, fmt.Errorf("pcap link type %v not supported", linkType)
+	}
+
+	record := make([]byte, pcap_record_header_len)
+	for index := 1; ; index++ {
+		if _, err = io.ReadFull(r, record); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		size := order.Uint32(record[8:])
+		if size > pcap_record_max_len {
+			return packets, fmt.Errorf("pcap record %v of %v bytes, file corrupt", index, size)
+		}
+		data := make([]byte, size)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return
+		}
+		frac := time.Duration(order.Uint32(record[4:]))
+		if magic == PCAP_MAGIC {
+			frac *= time.Microsecond
+		}
+		packet, ok := udpOf(linkType, data)
+		if !ok {
+			continue
+		}
+		packet.Index = index
+		packet.Time = time.Unix(int64(order.Uint32(record[0:])), int64(frac))
+		packets = append(packets, packet)
+	}
+}
+
+//udpOf strips the link, IPv4 and UDP headers of a frame, ok is false for anything else
+func udpOf(linkType uint32, data []byte) (packet PcapPacket, ok bool) {
+	switch linkType {
+	case PCAP_LINKTYPE_ETHERNET:
+		if len(data) < 14 {
+			return
+		}
+		etherType, off := binary.BigEndian.Uint16(data[12:]), 14
+		if etherType == 0x8100 && len(data) >= 18 {
+			//802.1Q vlan tag
+			etherType, off = binary.BigEndian.Uint16(data[16:]), 18
+		}
+		if etherType != 0x0800 {
+			return
+		}
+		data = data[off:]
+	case PCAP_LINKTYPE_LINUX_SLL:
+		if len(data) < 16 || binary.BigEndian.Uint16(data[14:]) != 0x0800 {
+			return
+		}
+		data = data[16:]
+	}
+
+	if len(data) < ipv4_header_len || data[0]>>4 != 4 || data[9] != 17 {
+		return
+	}
+	ihl := int(data[0]&0x0f) * 4
+	total := int(binary.BigEndian.Uint16(data[2:]))
+	if fragment := binary.BigEndian.Uint16(data[6:]) & 0x1fff; fragment != 0 {
+		return
+	}
+	if total < ihl+udp_header_len || total > len(data) {
+		return
+	}
+	udp := data[ihl:total]
+	udpLen := int(binary.BigEndian.Uint16(udp[4:]))
+	if udpLen < udp_header_len || udpLen > len(udp) {
+		return
+	}
+	packet.Src = &net.UDPAddr{IP: net.IP(append([]byte(nil), data[12:16]...)), Port: int(binary.BigEndian.Uint16(udp[0:]))}
+	packet.Dst = &net.UDPAddr{IP: net.IP(append([]byte(nil), data[16:20]...)), Port: int(binary.BigEndian.Uint16(udp[2:]))}
+	packet.Payload = udp[udp_header_len:udpLen]
+	return packet, true
+}
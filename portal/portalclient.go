@@ -0,0 +1,1000 @@
+package portal
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"crypto/md5"
+	"net"
+	"strconv"
+	"time"
+)
+
+//const variables definition
+const (
+	PCMERR_OK = 0
+	PCMERR_UNKNOWN = 1
+	PCMERR_CHALLENGEREFUSED = 2
+	PCMERR_CONNECTCREATED = 3
+	PCMERR_SAMEUSERAUTHING = 4
+	PCMERR_AUTHREFUSED = 5
+	PCMERR_RECVTIMEOUT = 6
+	PCMERR_LOGOUTREFUSED = 7
+	PCMERR_CANCELED = 8
+)
+
+const (
+	DEF_BAS_PORT = 2000
+	DEF_RETRY    = 3
+)
+
+//status code
+const (
+	PCMSTATUS_START = 1
+	PCMSTATUS_CHALLENGE = 2           //CHALLENGE stage
+	PCMSTATUS_AUTH = 3                //AUTH stage
+	PCMSTATUS_LOGOUT = 4              //LOGOUT stage
+	PCMSTATUS_VLANINFO = 5
+	PCMSTATUS_NTFLOGOUT = 6
+)
+
+type PortalClient struct {
+	UserName         string
+	Password         string
+	BrasIP           string
+	UserIP           string
+	UserMac          string
+	ChapPassword     string
+	SerialNo         uint16
+	ErrCode          uint8
+	ReqId            uint16
+	Status           uint8
+	Packet           *PortalPacket
+	PortInfo         string
+	Usage            Usage //of the ACK_INFO
+	TextInfo         string
+	AuthType         string
+	IsSendAffAckAuth bool
+	RetryPolicy      *RetryPolicy
+	LastFailure      uint8
+	SharedSecret     string
+	BrasPort         int    //DEF_BAS_PORT when 0
+	PortalVersion    uint   //DEF_PORTAL_VERSION2 when 0
+	Logger           Logger   //nil for no log
+	Capture          *Capture //nil for no packet capture
+	OnPacket         func(src, dst net.Addr, payload []byte) //called for every datagram sent or received
+	OnStatus         func(status uint8)                      //called when a login reaches a PCMSTATUS_* stage
+	OnAffAck         func(a AffAckAuth)                      //called when a login owes the BAS its AFF_ACK_AUTH, before it is sent
+
+	serialNoHeld bool
+	logs         map[string]Logger //logger of each module, with the serialno field of logsSerialNo
+	logsSerialNo uint16
+}
+
+//Get a new serial no from the allocator of the BAS
+//the serial no held before is released, 0 is returned when none is free
+func (p *PortalClient) NewSerialNo() uint16 {
+	p.ReleaseSerialNo()
+	serialNo, err := GetSerialAllocator(p.BrasIP).Acquire()
+	if err != nil {
+		p.log().Error("allocate serial no for bras:%v err:%v", p.BrasIP, err)
+		return 0
+	}
+	p.SerialNo = serialNo
+	p.serialNoHeld = true
+	return p.SerialNo
+}
+
+//Give back the serial no held by this client
+func (p *PortalClient) ReleaseSerialNo() {
+	if p.serialNoHeld {
+		GetSerialAllocator(p.BrasIP).Release(p.SerialNo)
+		p.serialNoHeld = false
+	}
+}
+
+//do REQ_CHALLENGE
+func (p *PortalClient) ReqChallenge() (ret bool) {
+	return p.ReqChallengeContext(context.Background())
+}
+
+//do REQ_CHALLENGE, stop retransmitting when ctx is done
+func (p *PortalClient) ReqChallengeContext(ctx context.Context) (ret bool) {
+	//set the default error code
+	p.ErrCode = PCMERR_UNKNOWN
+
+	//make REQ_CHALLENGE packet
+	if !p.MakeRequestPacket(PACKETTYPE_REQCHALLENGE) {
+		p.log().Error("make CHALLENGE request packet failed.")
+		return
+	}
+
+	p.log().Debug("make CHALLENGE request packet ok.")
+	p.log().Debug("CHALLENGE serial:%v,requ:\n%v", p.SerialNo, p.Packet.HexDumpString())
+
+	//send REQ_CHALLENGE packet and receive ack
+	if !p.SendReqAndRecvAckPktContext(ctx, PACKETTYPE_REQCHALLENGE) {
+		p.log().Error("receive chanllege ack failed.")
+		p.setExchangeErrCode()
+		p.SendAbandonLogout()
+		return
+	}
+	p.log().Debug("send CHALLENGE request packet ok.")
+	//Analyze the ACK_CHALLENGE packet
+	p.Packet.PackageType = PACKETTYPE_RSP
+	p.Packet.PortalVersion = p.version()
+	//analyze the ack packet
+	p.Packet.UnMarshal()
+
+	p.log().Debug("parse CHALLENGE ack packet ok.")
+
+	//dump ack packet to buffer
+	p.log().Debug("CHALLENGE serial:%v,resp:\n%v", p.SerialNo, p.Packet.HexDumpString())
+
+	//check the serial no and packet type
+	if p.SerialNo != p.Packet.SerialNo || p.Packet.PortalType != PACKETTYPE_ACKCHALLENGE {
+		//serial no not matched.
+		p.log().Error("serial not matched for CHALLENGE ack. [%v/%v]", p.SerialNo, p.Packet.SerialNo)
+		return
+	}
+
+	//check error code
+	switch p.Packet.ErrCode {
+	case 0:
+		//ok
+		p.ErrCode = PCMERR_OK
+	case 1:
+		//REQ_CHALLENGE refused
+		p.ErrCode = PCMERR_CHALLENGEREFUSED
+	case 2:
+		//connection created
+		p.ErrCode = PCMERR_CONNECTCREATED
+	case 3:
+		//same user authenticating
+		p.ErrCode = PCMERR_SAMEUSERAUTHING
+	default:
+		p.ErrCode = PCMERR_UNKNOWN
+	}
+
+	var exist bool
+	var attr AttributeValuePair
+	//get the TEXTINFO attrib if have
+	exist, attr = p.Packet.GetAttrByType(ATTRTYPE_TEXTINFO)
+	if !exist {
+		p.log().Error("get textinfo is NULL!")
+	} else {
+		p.TextInfo = attr.Content
+	}
+
+	//if ack failed, return
+	if p.ErrCode != PCMERR_OK {
+		p.log().Error("CHALLENGE return error. [%v]", p.ErrCode)
+		return
+	}
+
+	//save the req id
+	p.ReqId = p.Packet.ReqID
+
+	//Get the chap challenge attrib
+	exist, attr = p.Packet.GetAttrByType(ATTRTYPE_CHALLENGE)
+	if !exist {
+		p.log().Error("get CHAP challenge is failed!")
+		return
+	} else {
+		p.ChapPassword = attr.Content
+	}
+
+	p.log().Debug("get CHALLENGE attrib from ack packet ok.")
+
+	//calculate CHAP_CHALLENGE attrib
+	p.ChapPassword = p.CalcChapPassword(p.ReqId, p.Password, p.ChapPassword)
+
+	p.log().Debug("do CHALLENGE request ok.")
+	ret = true
+	return
+}
+
+//do REQ_AUTH
+func (p *PortalClient) ReqAuth() (ret bool) {
+	return p.ReqAuthContext(context.Background())
+}
+
+//do REQ_AUTH, stop retransmitting when ctx is done
+func (p *PortalClient) ReqAuthContext(ctx context.Context) (ret bool) {
+	//set default error code
+	p.ErrCode = PCMERR_UNKNOWN
+
+	//make REQ_AUTH packet
+	if !p.MakeRequestPacket(PACKETTYPE_REQAUTH) {
+		p.log().Error("make AUTHEN packet failed during login.")
+		return
+	}
+	p.log().Debug("make AUTHEN packet ok during login.")
+	p.log().Debug("AUTHEN serial:%v,requ:\n%v", p.SerialNo, p.Packet.HexDumpString())
+
+	//send REQ_CHALLENGE packet and receive ack
+	if !p.SendReqAndRecvAckPktContext(ctx, PACKETTYPE_REQAUTH) {
+		p.log().Error("send AUTHEN request or recv AUTHEN ack failed.")
+		p.setExchangeErrCode()
+		p.SendAbandonLogout()
+		return
+	}
+
+	p.log().Debug("send AUTHEN request or recv AUTHEN ack ok.")
+	//Analyze the ACK_CHALLENGE packet
+	//request authenticator saved in the m_pppAuthenticator
+	p.Packet.PackageType = PACKETTYPE_RSP
+	p.Packet.PortalVersion = p.version()
+
+
+	//analyze the ack packet
+	if err := p.Packet.UnMarshal(); err != nil {
+		p.log().Error("parse AUTHEN ack packet failed.")
+		return
+	}
+	//dump ack packet to buffer
+	p.log().Debug("Auth serial:%v,resp:\n%v", p.SerialNo, p.Packet.HexDumpString())
+
+	//set error code
+	switch p.Packet.ErrCode {
+	case 0:
+		//authen ok
+		p.ErrCode = PCMERR_OK
+	case 1:
+		//authen refused
+		p.ErrCode = PCMERR_AUTHREFUSED
+	case 2:
+		//connection created
+		p.ErrCode = PCMERR_CONNECTCREATED
+	case 3:
+		//same user authenticating
+		p.ErrCode = PCMERR_SAMEUSERAUTHING
+	default:
+		p.ErrCode = PCMERR_UNKNOWN
+	}
+	var exist bool
+	var attr AttributeValuePair
+	//save the port info
+	exist, attr = p.Packet.GetAttrByType(ATTRTYPE_TEXTINFO)
+	if !exist {
+		p.log().Error("get textinfo is NULL!")
+	} else {
+		p.TextInfo = attr.Content
+	}
+
+	//check the error code
+	if p.ErrCode != PCMERR_OK {
+		p.log().Error("REQ_AUTH error. [%v]", p.ErrCode)
+		return
+	} else {
+		//check the serial no and packet type
+		if p.SerialNo != p.Packet.SerialNo || p.Packet.PortalType != PACKETTYPE_ACKAUTH {
+			p.log().Error("serial no not matched or packet type invalid.")
+			p.ErrCode = PCMERR_UNKNOWN
+			return
+		}
+	}
+
+	p.log().Debug("parse AUTHEN ack packet ok.")
+
+	//send the AFF_ACK_AUTH according to the
+	if (p.IsSendAffAckAuth) {
+		//make AFF_ACK_AUTH packet
+
+		//save the req id for PAP
+		p.ReqId = p.Packet.ReqID
+		if p.OnAffAck != nil {
+			p.OnAffAck(AffAckAuth{BasIP: p.BrasIP, UserIP: p.UserIP, SerialNo: p.SerialNo, ReqID: p.ReqId})
+		}
+		if !p.MakeRequestPacket(PACKETTYPE_AFFACKAUTH) {
+			p.log().Error("make AFF AUTHEN ack request packet failed.")
+			p.ErrCode = PCMERR_UNKNOWN
+			return
+		}
+
+		//send the AFF_ACK_AUTH packet
+		if !p.SendReqAndRecvAckPktContext(ctx, PACKETTYPE_AFFACKAUTH) {
+			p.log().Error("send AFF AUTHEN request or receive AFF AUTHEN ack failed.")
+			p.ErrCode = PCMERR_UNKNOWN
+			return
+		}
+		p.log().Debug("send AFF AUTHEN request and receive AFF AUTHEN ack ok.")
+	}
+	p.log().Debug("do AUTHEN step ok during login")
+	ret = true
+	return
+}
+
+//do login
+func (p *PortalClient) ReqLogin() (ret bool) {
+	return p.ReqLoginContext(context.Background())
+}
+
+//do login, a cancelled ctx stops retransmitting and drops the half-done challenge
+func (p *PortalClient) ReqLoginContext(ctx context.Context) (ret bool) {
+	defer p.ReleaseSerialNo()
+	p.Status = PCMSTATUS_AUTH
+	if p.AuthType == "CHAP" {
+		//need do CHALLENGE
+		p.setStatus(PCMSTATUS_CHALLENGE)
+		if !p.ReqChallengeContext(ctx) {
+			p.log().Error("do CHALLENGE failed during login step.")
+			return
+		}
+		if ctx.Err() != nil {
+			p.log().Warn("login canceled after CHALLENGE: %v", ctx.Err())
+			p.ErrCode = PCMERR_CANCELED
+			p.LastFailure = PCMFAIL_CANCELED
+			p.SendAbandonLogout()
+			return
+		}
+	}
+	p.log().Info("do CHALLENGE ok during login step.")
+	p.setStatus(PCMSTATUS_AUTH)
+	if !p.ReqAuthContext(ctx) {
+		p.log().Error("do AUTHEN failed during login step.")
+		return
+	}
+	p.log().Info("do AUTHEN ok during login step.")
+	ret = true
+	return
+}
+
+//setStatus enters a stage of the login and tells OnStatus
+func (p *PortalClient) setStatus(status uint8) {
+	p.Status = status
+	if p.OnStatus != nil {
+		p.OnStatus(status)
+	}
+}
+
+//do REQ_LOGOUT
+func (p *PortalClient) ReqLogout() (ret bool) {
+	return p.ReqLogoutContext(context.Background())
+}
+
+//do REQ_LOGOUT, stop retransmitting when ctx is done
+func (p *PortalClient) ReqLogoutContext(ctx context.Context) (ret bool) {
+	defer p.ReleaseSerialNo()
+	p.Status = PCMSTATUS_LOGOUT
+
+	//set default error code
+	p.ErrCode = PCMERR_UNKNOWN
+
+	//make REQ_LOGOUT packet
+	if !p.MakeRequestPacket(PACKETTYPE_REQLOGOUT) {
+		p.log().Error("make LOGOUT packet failed.")
+		return
+	}
+
+	p.log().Debug("make LOGOUT request packet ok.")
+	p.log().Debug("LOGOUT serial:%v,requ:\n%v", p.SerialNo, p.Packet.HexDumpString())
+
+	//send and recv ack
+	if !p.SendReqAndRecvAckPktContext(ctx, PACKETTYPE_REQLOGOUT) {
+		p.log().Error("send LOGOUT request packet failed.")
+		p.setExchangeErrCode()
+		return
+	}
+
+	p.log().Debug("send LOGOUT request packet and receive response packet ok.")
+
+	//if REQ_LOGOUT for REQ_CHALLENGE or REQ_AUTH, return directly
+	if p.Status == PCMSTATUS_CHALLENGE || p.Status == PCMSTATUS_AUTH {
+		p.log().Warn("logout do nothing for CHALLENGE or AUTHEN.  [%v]", p.Status)
+		return
+	}
+	p.Packet.PackageType = PACKETTYPE_RSP
+	p.Packet.PortalVersion = p.version()
+	if err := p.Packet.UnMarshal(); err != nil {
+		p.log().Error("parse LOGOUT ack packet failed.")
+		return
+	}
+
+	p.log().Debug("parse LOGOUT ack packet ok.")
+
+	//dump ack packet to buffer
+	p.log().Debug("Logout serial:%v, resp:\n%v", p.SerialNo, p.Packet.HexDumpString())
+
+	//check the serial no and packet type
+	if p.SerialNo != p.Packet.SerialNo || p.Packet.PortalType != PACKETTYPE_ACKLOGOUT {
+		p.log().Error("serial no or portal type not matched.")
+		return
+	}
+
+	//check error code
+	switch p.Packet.ErrCode {
+	case 0:
+		//logout ok
+		p.ErrCode = PCMERR_OK
+	case 1:
+		//logout refused
+		p.ErrCode = PCMERR_LOGOUTREFUSED
+	default:
+		p.ErrCode = PCMERR_UNKNOWN
+	}
+	var attr AttributeValuePair
+	var exist bool
+	//get the TEXTINFO attrib if have
+	exist, attr = p.Packet.GetAttrByType(ATTRTYPE_TEXTINFO)
+	if !exist {
+		p.log().Error("get textinfo is NULL!")
+	} else {
+		p.TextInfo = attr.Content
+	}
+
+	//if ack failed, return
+	if p.ErrCode != PCMERR_OK {
+		p.log().Error("do LOGOUT failed. [%v]", p.ErrCode)
+		return
+	}
+
+	p.log().Debug("do LOGOUT ok.")
+	ret = true
+	return
+}
+
+func (p *PortalClient) ReqVlaninfo() (ret bool) {
+	return p.ReqVlaninfoContext(context.Background())
+}
+
+//do REQ_INFO, stop retransmitting when ctx is done
+func (p *PortalClient) ReqVlaninfoContext(ctx context.Context) (ret bool) {
+	defer p.ReleaseSerialNo()
+	p.Status = PCMSTATUS_VLANINFO
+	//set default error code
+	p.ErrCode = PCMERR_UNKNOWN
+
+	//make REQ_GETVLANINFO packet
+	if !p.MakeRequestPacket(PACKETTYPE_REQINFO) {
+		p.log().Error("make getvlaninfo packet failed.")
+		return
+	}
+
+	p.log().Debug("make getvlaninfo request packet ok.")
+	p.log().Debug("VLANINFO serial:%v,requ:\n%v", p.SerialNo, p.Packet.HexDumpString())
+
+	//send and recv ack
+	if !p.SendReqAndRecvAckPktContext(ctx, PACKETTYPE_REQINFO) {
+		p.log().Error("send getvlaninfo request packet failed.")
+		p.setExchangeErrCode()
+		return
+	}
+
+	p.log().Debug("send getvlaninfo request packet and receive response packet ok.")
+
+	//if REQ_LOGOUT for REQ_CHALLENGE or REQ_AUTH, return directly
+	if p.Status == PCMSTATUS_CHALLENGE || p.Status == PCMSTATUS_AUTH {
+		p.log().Warn("getvlaninfo do nothing for CHALLENGE or AUTHEN.  [%V]", p.Status)
+		return
+	}
+
+	p.Packet.PackageType = PACKETTYPE_RSP
+	p.Packet.PortalVersion = p.version()
+	//analyze the ack packet
+	if err := p.Packet.UnMarshal(); err != nil {
+		p.log().Error("parse VLANINFO ack packet failed.")
+		return
+	}
+
+	p.log().Debug("parse VLANINFO ack packet ok.")
+	//dump ack packet to buffer
+	p.log().Debug("VLANINFO serial:%v, resp:\n%v", p.SerialNo, p.Packet.HexDumpString())
+
+	//check the serial no and packet type
+	if p.SerialNo != p.Packet.SerialNo || p.Packet.PortalType != PACKETTYPE_ACKINFO {
+		p.log().Error("serial no or portal type not matched.")
+		return
+	}
+
+	var exist bool
+	var attr AttributeValuePair
+	//save the port info
+	exist, attr = p.Packet.GetAttrByType(ATTRTYPE_PORT)
+	if !exist {
+		p.log().Error("get tlvAttrib forportinfo is NULL!")
+	} else {
+		p.PortInfo = attr.Content
+	}
+	p.Usage = p.Packet.Usage()
+	p.ErrCode = p.Packet.ErrCode
+	//if ack failed, return
+	if p.ErrCode != PCMERR_OK {
+		p.log().Error("do GETVLANINFO failed. [%lu]", p.ErrCode)
+		return
+	}
+
+	p.log().Debug("do GETVLANINFO ok.")
+	ret = true
+	return
+}
+
+//make request packet according current status
+//used by portal server
+func (p *PortalClient) MakeRequestPacket(reqType uint8) (ret bool) {
+	//check the request type
+	if reqType < PACKETTYPE_REQCHALLENGE || reqType > PACKETTYPE_REQINFO {
+		p.log().Error("req type invalid. ")
+		return
+	}
+	p.Packet = &PortalPacket{}
+	p.Packet.SharedSecret = p.SharedSecret
+	p.Packet.Version = uint8(p.version())
+	p.Packet.PortalType = reqType
+	p.Packet.PortalVersion = p.version()
+	p.Packet.UserIP = inet_aton(p.UserIP)
+	p.Packet.UserPort = 0
+	p.Packet.PackageType = PACKETTYPE_REQ
+
+	//get the serial no of request
+	//if AFF_ACK_AUTH, we use current error code
+	//if REQ_LOGOUT, we need check the current error code
+	if reqType == PACKETTYPE_AFFACKAUTH ||
+	(reqType == PACKETTYPE_REQLOGOUT) && (p.Status == PCMSTATUS_CHALLENGE || p.Status == PCMSTATUS_AUTH) {
+		//if REQ_CHALLENGE or REQ_AUTH failed, we use the current serial no
+		//it's not necessary to get a new serial no
+		p.log().Warn("REQ_LOGOUT for REQ_AUTH or REQ_CHALLENGE. [%v]", p.ErrCode)
+	} else {
+		//get a new serial no
+		//get vlaninfo use new  serial no
+		if p.NewSerialNo() == 0 {
+			p.log().Error("no serial no available for bras:%v", p.BrasIP)
+			return
+		}
+		p.log().Info("new serial no: %v", p.SerialNo)
+	}
+	p.Packet.SerialNo = p.SerialNo
+
+	if p.AuthType == "CHAP" {
+		//reqid is valid for CHAP
+		if reqType == PACKETTYPE_REQAUTH || reqType == PACKETTYPE_AFFACKAUTH || reqType == PACKETTYPE_REQLOGOUT {
+			//if REQ_AUTH, AFF_ACK_AUTH or REQ_LOGOUT
+			//m_pcmCurReqID got in ACK_CHALLENGE
+			//get the request id
+			p.Packet.ReqID = p.ReqId
+		}
+		p.Packet.AuthMode = AUTHMODE_CHAP
+	} else if p.AuthType == "PAP" {
+		// aff_ack_auth req_id is equal to ack_auth
+		if reqType == PACKETTYPE_AFFACKAUTH {
+			p.Packet.ReqID = p.ReqId
+			p.log().Info("AFF_ACK_AUTH PAP request id: %v", p.Packet.ReqID)
+		}
+		p.Packet.AuthMode = AUTHMODE_PAP
+	}
+
+	if reqType == PACKETTYPE_REQLOGOUT {
+		//check current error code
+		if p.Status == PCMSTATUS_CHALLENGE || p.Status == PCMSTATUS_AUTH {
+			//REQ_LOGOUT from REQ_CHALLENGE or REQ_AUTH
+			//we need set it to 1
+			p.Packet.ErrCode = 1
+		}
+	}
+
+	//append all the attribs
+	if reqType == PACKETTYPE_REQAUTH {
+		//attrib number is 2: user name and user passwd
+		p.Packet.AttrNum = 2
+		//append the username
+		var attr AttributeValuePair
+		attr.Type = ATTRTYPE_USERNAME
+		attr.Content = p.UserName
+		attr.Length = uint8(len(attr.Content))
+		p.Packet.AVPS = append(p.Packet.AVPS, attr)
+		p.log().Debug("username type:%v,len:%v", attr.Type, attr.Length)
+
+		//append the passwd or chap-passwd attrib
+		if p.AuthType == "CHAP" {
+			//append the user passwd
+			attr.Type = ATTRTYPE_CHAPPASSWD
+			attr.Content = p.ChapPassword
+			attr.Length = uint8(len(attr.Content))
+			p.Packet.AVPS = append(p.Packet.AVPS, attr)
+			p.Packet.AuthMode = AUTHMODE_CHAP
+		} else {
+			//append the user passwd
+			attr.Type = ATTRTYPE_PASSWD
+			attr.Content = p.Password
+			attr.Length = uint8(len(attr.Content))
+			p.Packet.AVPS = append(p.Packet.AVPS, attr)
+			p.Packet.AuthMode = AUTHMODE_PAP
+		}
+	}
+	if reqType == PACKETTYPE_REQINFO {
+		p.Packet.AttrNum = 1
+		//append port type and len
+		var attr AttributeValuePair
+		attr.Type = ATTRTYPE_PORT
+		attr.Content = ""
+		attr.Length = 0
+		p.Packet.AVPS = append(p.Packet.AVPS, attr)
+	}
+	//convert to packet buffer
+	p.Packet.Logger = p.logOf(LOG_MODULE_CODEC)
+	p.Packet.Marshal()
+	ret = true
+	return
+}
+
+//get request type according current status
+func (p *PortalClient) GetReqTypeByStatus() (desc string) {
+	switch p.Status {
+	case PCMSTATUS_CHALLENGE:
+		desc = "REQ_CHALLENGE"
+	case PCMSTATUS_AUTH:
+		desc = "REQ_AUTH"
+	case PCMSTATUS_LOGOUT:
+		desc = "REQ_LOGOUT"
+	default:
+		break
+	}
+	return
+}
+
+//send the request packet and receive ack packet
+//this function must be called after MakeRequestPacket
+//received ack packet stored in p.Packet.Raw, the failure kind in p.LastFailure.
+func (p *PortalClient) SendReqAndRecvAckPkt(requType uint8) (ret bool) {
+	return p.SendReqAndRecvAckPktContext(context.Background(), requType)
+}
+
+//same as SendReqAndRecvAckPkt, no more attempt is made once ctx is done
+func (p *PortalClient) SendReqAndRecvAckPktContext(ctx context.Context, requType uint8) (ret bool) {
+	p.LastFailure = PCMFAIL_NONE
+	//check the request type
+	if (requType < PACKETTYPE_REQCHALLENGE) || (requType > PACKETTYPE_REQINFO) {
+		p.log().Error("request type invalid. ")
+		return
+	}
+	var bRecvAck bool
+	//It's not necessary to receive ack
+	switch requType {
+	case PACKETTYPE_AFFACKAUTH:
+		bRecvAck = false
+	case PACKETTYPE_REQLOGOUT:
+		//REQ_LOGOUT for REQ_CHALLENGE or REQ_AUTH has no ack
+		bRecvAck = p.Status != PCMSTATUS_CHALLENGE && p.Status != PCMSTATUS_AUTH
+	default:
+		bRecvAck = true
+	}
+	p.SerialNo = p.Packet.SerialNo
+	p.ReqId = p.Packet.ReqID
+
+	policy := p.GetRetryPolicy()
+	deadline := time.Now().Add(policy.Deadline)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	reqRaw := p.Packet.Raw
+	for ii := 0; ii < policy.MaxAttempts; ii++ {
+		if ctx.Err() != nil {
+			p.LastFailure = PCMFAIL_CANCELED
+			break
+		}
+		if ii > 0 {
+			if !policy.Retryable(p.LastFailure) {
+				p.log().Error("%v is not retryable, serial:%v", FailureString(p.LastFailure), p.SerialNo)
+				break
+			}
+			backoff := policy.Backoff(ii)
+			if time.Now().Add(backoff).After(deadline) {
+				p.LastFailure = PCMFAIL_DEADLINE
+				break
+			}
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				p.LastFailure = PCMFAIL_CANCELED
+			}
+			if p.LastFailure == PCMFAIL_CANCELED {
+				break
+			}
+		}
+		timeout := policy.StepTimeoutFor(requType)
+		if remain := deadline.Sub(time.Now()); remain < timeout {
+			timeout = remain
+		}
+		if timeout <= 0 {
+			p.LastFailure = PCMFAIL_DEADLINE
+			break
+		}
+		//an earlier attempt may have replaced it with the ack
+		p.Packet.Raw = reqRaw
+
+		//check whether we need receive ack packet
+		if !bRecvAck {
+			if _, err := p.SendContext(ctx, timeout); err != nil {
+				p.log().Error("send packet err:[%v], retry:%v", err, ii)
+				continue
+			}
+			p.log().Debug("need not receive ack packet.")
+			ret = true
+			break
+		}
+
+		rbytes, err := p.SendAndRecvContext(ctx, timeout)
+		if err != nil {
+			p.log().Error("receive ack packet err:%v, %v, retry:%v", err, FailureString(p.LastFailure), ii)
+			continue
+		}
+		// recv len
+		if rbytes < p.Packet.GetMinPktLen() {
+			p.LastFailure = PCMFAIL_SHORTPACKET
+			p.log().Error("receive ack packet too short. [%v], retry:%v", rbytes, ii)
+			continue
+		}
+		if p.Packet.PortalVersion == DEF_PORTAL_VERSION2 {
+			//ack authenticator is signed over the request authenticator
+			p.Packet.PackageType = PACKETTYPE_RSP
+			if !p.Packet.VerifyAuthenticator() {
+				p.LastFailure = PCMFAIL_AUTHENTICATOR
+				p.log().Error("VerifyAuthenticator err serial:%v, retry:%v", p.SerialNo, ii)
+				continue
+			}
+		}
+		//recv
+		p.LastFailure = PCMFAIL_NONE
+		ret = true
+		break
+	}
+	if !ret {
+		p.log().Error("%v abandoned, serial:%v, last failure:%v",
+			p.Packet.PortalTypeString(), p.SerialNo, FailureString(p.LastFailure))
+	}
+	return
+}
+
+//send REQ_LOGOUT with ErrCode=1 so that the BAS drops the half-done
+//REQ_CHALLENGE or REQ_AUTH, the BAS sends no ack for it.
+func (p *PortalClient) SendAbandonLogout() (ret bool) {
+	if p.Status != PCMSTATUS_CHALLENGE && p.Status != PCMSTATUS_AUTH {
+		return
+	}
+	//keep the result of the abandoned request
+	errCode, failure, packet := p.ErrCode, p.LastFailure, p.Packet
+	defer func() {
+		p.ErrCode, p.LastFailure, p.Packet = errCode, failure, packet
+	}()
+
+	if !p.MakeRequestPacket(PACKETTYPE_REQLOGOUT) {
+		p.log().Error("make LOGOUT packet failed for abandoned %v.", p.GetReqTypeByStatus())
+		return
+	}
+	if !p.SendReqAndRecvAckPkt(PACKETTYPE_REQLOGOUT) {
+		p.log().Error("send LOGOUT packet failed for abandoned %v.", p.GetReqTypeByStatus())
+		return
+	}
+	p.log().Warn("LOGOUT sent for abandoned %v, serial:%v", p.GetReqTypeByStatus(), p.SerialNo)
+	ret = true
+	return
+}
+
+//a failed io is reported as canceled when ctx is done
+func (p *PortalClient) failureOf(ctx context.Context, failure uint8) uint8 {
+	if ctx.Err() != nil {
+		return PCMFAIL_CANCELED
+	}
+	return failure
+}
+
+//get the retry policy, the default one when not set
+func (p *PortalClient) GetRetryPolicy() *RetryPolicy {
+	if p.RetryPolicy == nil {
+		p.RetryPolicy = NewRetryPolicy(DEF_RETRY, DEF_TIMEOUT)
+	}
+	return p.RetryPolicy
+}
+
+func (p *PortalClient) version() uint {
+	if p.PortalVersion == 0 {
+		return DEF_PORTAL_VERSION2
+	}
+	return p.PortalVersion
+}
+
+func (p *PortalClient) basAddr() string {
+	port := p.BrasPort
+	if port == 0 {
+		port = DEF_BAS_PORT
+	}
+	return net.JoinHostPort(p.BrasIP, strconv.Itoa(port))
+}
+
+func (p *PortalClient) log() Logger {
+	return p.logOf(LOG_MODULE_CLIENT)
+}
+
+//logger of a module, with the serialno field once it is allocated
+func (p *PortalClient) logOf(module string) Logger {
+	if p.Logger == nil {
+		return nopLogger{}
+	}
+	if p.logs == nil || p.logsSerialNo != p.SerialNo {
+		p.logs = make(map[string]Logger, 3)
+		p.logsSerialNo = p.SerialNo
+	}
+	if l, ok := p.logs[module]; ok {
+		return l
+	}
+	l := p.Logger
+	if ml, ok := l.(ModuleLogger); ok {
+		l = ml.Module(module)
+	}
+	if fl, ok := l.(FieldLogger); ok && p.SerialNo != 0 {
+		l = fl.WithField("serialno", p.SerialNo)
+	}
+	p.logs[module] = l
+	return l
+}
+
+//set p.ErrCode from the failure kind of the last exchange
+func (p *PortalClient) setExchangeErrCode() {
+	if p.LastFailure == PCMFAIL_CANCELED {
+		p.ErrCode = PCMERR_CANCELED
+	} else {
+		p.ErrCode = PCMERR_RECVTIMEOUT
+	}
+}
+
+//unblock the pending io on conn once ctx is done, the returned func must be called after the io
+func watchContext(ctx context.Context, conn net.Conn) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	quit := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-quit:
+		}
+	}()
+	return func() { close(quit) }
+}
+
+func (p *PortalClient) SendAndRecv(timeout time.Duration) (size int, err error) {
+	return p.SendAndRecvContext(context.Background(), timeout)
+}
+
+func (p *PortalClient) SendAndRecvContext(ctx context.Context, timeout time.Duration) (size int, err error) {
+	addr := p.basAddr()
+	p.logOf(LOG_MODULE_UDP).Debug("udp:%v", addr)
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		p.LastFailure = p.failureOf(ctx, PCMFAIL_SEND)
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer watchContext(ctx, conn)()
+	p.logOf(LOG_MODULE_UDP).Debug("Begin to send packet.")
+
+	size, err = conn.Write(p.Packet.Raw)
+	if err != nil {
+		p.LastFailure = p.failureOf(ctx, PCMFAIL_SEND)
+		p.logOf(LOG_MODULE_UDP).Error("send packet err:%v", err)
+		return
+	}
+	p.capture(conn.LocalAddr(), conn.RemoteAddr(), p.Packet.Raw)
+
+	buf := make([]byte, MAX_PORTALPACKET_LEN)
+	size, err = conn.Read(buf)
+	if err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			p.LastFailure = p.failureOf(ctx, PCMFAIL_TIMEOUT)
+		} else {
+			//ICMP unreachable and the like, the request never arrived
+			p.LastFailure = p.failureOf(ctx, PCMFAIL_SEND)
+		}
+		p.logOf(LOG_MODULE_UDP).Error("recv packet err:%v", err)
+		return
+	}
+	p.Packet.Raw = buf[:size]
+	p.Packet.PackageLen = size
+	p.capture(conn.RemoteAddr(), conn.LocalAddr(), p.Packet.Raw)
+	return
+}
+
+func (p *PortalClient) Send(timeout time.Duration) (size int, err error) {
+	return p.SendContext(context.Background(), timeout)
+}
+
+func (p *PortalClient) SendContext(ctx context.Context, timeout time.Duration) (size int, err error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", p.basAddr())
+	if err != nil {
+		p.LastFailure = p.failureOf(ctx, PCMFAIL_SEND)
+		return
+	}
+	defer conn.Close()
+
+	conn.SetWriteDeadline(time.Now().Add(timeout))
+	defer watchContext(ctx, conn)()
+	p.logOf(LOG_MODULE_UDP).Debug("Begin to send packet.")
+
+	size, err = conn.Write(p.Packet.Raw)
+	if err != nil {
+		p.LastFailure = p.failureOf(ctx, PCMFAIL_SEND)
+		p.logOf(LOG_MODULE_UDP).Error("send packet err:%v", err)
+		return
+	}
+	p.capture(conn.LocalAddr(), conn.RemoteAddr(), p.Packet.Raw)
+	return
+}
+
+//capture hands a datagram exchanged with the BAS to OnPacket, and records it when the capture is on
+func (p *PortalClient) capture(src, dst net.Addr, payload []byte) {
+	if p.OnPacket != nil {
+		p.OnPacket(src, dst, payload)
+	}
+	if !p.Capture.Enabled() {
+		return
+	}
+	if err := p.Capture.Packet(src, dst, p.BrasIP, payload); err != nil {
+		p.logOf(LOG_MODULE_UDP).Warn("capture packet err:%v", err)
+	}
+}
+
+func (p *PortalClient) CalcChapPassword(reqId uint16, password, chapChallenge string) (chapPasswd string) {
+	packetBuffer := make([]byte, 0, 2)
+	packet := bytes.NewBuffer(packetBuffer)
+	binary.Write(packet, binary.BigEndian, reqId)
+	// Calculate Authenticator Hash
+	h := md5.New()
+	h.Write(packet.Bytes()[1:1])
+	h.Write([]byte(password))
+	h.Write([]byte(chapChallenge))
+	ours := h.Sum(nil)
+	chapPasswd = string(ours)
+	return
+}
+
+//get the name of a PCMSTATUS_* stage
+func StatusString(status uint8) (desc string) {
+	switch status {
+	case PCMSTATUS_START:
+		desc = "start"
+	case PCMSTATUS_CHALLENGE:
+		desc = "challenge"
+	case PCMSTATUS_AUTH:
+		desc = "auth"
+	case PCMSTATUS_LOGOUT:
+		desc = "logout"
+	case PCMSTATUS_VLANINFO:
+		desc = "vlaninfo"
+	case PCMSTATUS_NTFLOGOUT:
+		desc = "ntflogout"
+	default:
+		desc = "unknown"
+	}
+	return
+}
+
+//get the description of a PCMERR_* code
+func ErrCodeString(errCode uint8) (desc string) {
+	switch errCode {
+	case PCMERR_OK:
+		desc = "ok"
+	case PCMERR_CHALLENGEREFUSED:
+		desc = "challenge refused"
+	case PCMERR_CONNECTCREATED:
+		desc = "connection created"
+	case PCMERR_SAMEUSERAUTHING:
+		desc = "same user authing"
+	case PCMERR_AUTHREFUSED:
+		desc = "auth refused"
+	case PCMERR_RECVTIMEOUT:
+		desc = "send failed or ack timeout"
+	case PCMERR_LOGOUTREFUSED:
+		desc = "logout refused"
+	case PCMERR_CANCELED:
+		desc = "canceled"
+	default:
+		desc = "unknown error"
+	}
+	return
+}
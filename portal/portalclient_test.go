@@ -0,0 +1,64 @@
+package portal
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+//a canceled login stops retransmitting and drops the half-done challenge
+func TestReqLoginContextCanceled(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen err:%v", err)
+	}
+	defer conn.Close()
+
+	p := &PortalClient{
+		BrasIP:       "127.0.0.1",
+		BrasPort:     conn.LocalAddr().(*net.UDPAddr).Port,
+		SharedSecret: "secret",
+		UserName:     "user",
+		Password:     "pass",
+		UserIP:       "10.0.0.2",
+		AuthType:     "CHAP",
+		RetryPolicy: &RetryPolicy{
+			MaxAttempts: 10,
+			Timeout:     time.Second,
+			BackoffBase: time.Second,
+			BackoffMax:  time.Second,
+			Deadline:    time.Minute,
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	begin := time.Now()
+	go func() {
+		done <- p.ReqLoginContext(ctx)
+	}()
+
+	buf := make([]byte, MAX_PORTALPACKET_LEN)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFromUDP(buf)
+	if err != nil || buf[PP_OFF_TYPE] != PACKETTYPE_REQCHALLENGE || n < MIN_PORTALPACKET_LEN {
+		t.Fatalf("expect REQ_CHALLENGE, err:%v", err)
+	}
+	cancel()
+
+	if <-done {
+		t.Error("login should fail.")
+	}
+	if cost := time.Since(begin); cost > 500*time.Millisecond {
+		t.Errorf("login returned %v after cancel.", cost)
+	}
+	if p.LastFailure != PCMFAIL_CANCELED || p.ErrCode != PCMERR_CANCELED {
+		t.Errorf("expect canceled, got errcode:%v failure:%v", p.ErrCode, FailureString(p.LastFailure))
+	}
+
+	n, _, err = conn.ReadFromUDP(buf)
+	if err != nil || buf[PP_OFF_TYPE] != PACKETTYPE_REQLOGOUT || buf[PP_OFF_ERRCODE] != 1 {
+		t.Fatalf("expect REQ_LOGOUT with ErrCode 1, err:%v", err)
+	}
+}
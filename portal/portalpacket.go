@@ -1,4 +1,4 @@
-package logic
+package portal
 
 import (
 	"net"
@@ -7,7 +7,7 @@ import (
 	"crypto/md5"
 	"io"
 	"fmt"
-	logger "github.com/xlog4go"
+	"errors"
 	"encoding/hex"
 	"strings"
 	"strconv"
@@ -89,6 +89,11 @@ const (
 	PORTAL_CHAPPASSWD_LEN    int = 16
 )
 
+var (
+	ErrPacketTooShort = errors.New("portal packet too short")
+	ErrBadAttribute   = errors.New("bad portal attribute")
+)
+
 const (
 	ATTRTYPE_USERNAME     = 1
 	ATTRTYPE_PASSWD       = 2
@@ -125,6 +130,7 @@ type PortalPacket struct {
 	Raw           []byte               // A buffer with the original raw data
 	UserIPStr     string
 	PackageLen    int
+	Logger        Logger               // nil for no log
 }
 
 // Attribute-Value Pair structure
@@ -169,14 +175,13 @@ func (p *PortalPacket) Marshal() []byte {
 		h := md5.New()
 		temp := packet.Bytes()
 		h.Write(temp[0:PP_OFF_AUTHENTICATOR])
-		logger.Debug("temp:%v", hex.Dump(temp))
+		p.log().Debug("temp:%v", hex.Dump(temp))
 		h.Write(p.Authenticator)
-		logger.Debug("Auth:%v", hex.Dump(p.Authenticator))
+		p.log().Debug("Auth:%v", hex.Dump(p.Authenticator))
 		if len(p.AVPS) > 0 {
 			h.Write(avps.Bytes())
 		}
 		io.WriteString(h, p.SharedSecret)
-		logger.Debug("sharedSecret:%v", p.SharedSecret)
 		p.Authenticator = h.Sum(nil)
 		packet.Write(p.Authenticator)
 	}
@@ -191,6 +196,7 @@ func (p *PortalPacket) Marshal() []byte {
 func (p *PortalPacket) UnMarshal() (err error) {
 	if len(p.Raw) < PP_OFF_AUTHENTICATOR {
 		// to less package.
+		err = ErrPacketTooShort
 		return
 	}
 	p.Version = uint8(p.Raw[PP_OFF_VERSION])
@@ -206,32 +212,48 @@ func (p *PortalPacket) UnMarshal() (err error) {
 	p.AttrNum = uint8(p.Raw[PP_OFF_ATTRNUM])
 	var index int = PP_OFF_ATTRS
 	if p.PortalVersion == DEF_PORTAL_VERSION2 {
+		if len(p.Raw) < PP_OFF_ATTRS {
+			err = ErrPacketTooShort
+			return
+		}
 		p.Authenticator = p.Raw[PP_OFF_AUTHENTICATOR:PP_OFF_AUTHENTICATOR+PP_AUTHENTICATOR_LEN]
 	} else {
 		index = PP_OFF_AUTHENTICATOR
 	}
 	var ii uint8
 
+	p.AVPS = make([]AttributeValuePair, 0, p.AttrNum)
 	for ii = 0; ii < p.AttrNum; ii++ {
 
+		if index+2 > len(p.Raw) {
+			p.log().Error("bad package attr num:%v, only %v parsed", p.AttrNum, ii)
+			err = ErrBadAttribute
+			break
+		}
 		var attr AttributeValuePair
 		attr.Type = uint8(p.Raw[index])
 		index++
 		attr.Length = uint8(p.Raw[index])
 		index++
-		if index+int(attr.Length) > p.PackageLen {
-			logger.Error("bad package attr type:%v,len:%v, value:%v",
+		if index+int(attr.Length) > len(p.Raw) {
+			p.log().Error("bad package attr type:%v,len:%v, value:%v",
 				attr.Type, attr.Length, p.Raw[index:])
+			err = ErrBadAttribute
 			break
 		}
 		attr.Content = string(p.Raw[index:index+int(attr.Length)])
 		index += int(attr.Length)
+		p.AVPS = append(p.AVPS, attr)
 	}
 	return
 }
 
 // Verifies the Authenticator Field if it matches our shared-secret
+// for a RSP packet p.Authenticator must still hold the request authenticator
 func (p *PortalPacket) VerifyAuthenticator() bool {
+	if len(p.Raw) < PP_OFF_ATTRS {
+		return false
+	}
 	// Calculate Authenticator Hash
 	h := md5.New()
 	h.Write(p.Raw[0:PP_OFF_AUTHENTICATOR])                          // Header
@@ -247,8 +269,8 @@ func (p *PortalPacket) VerifyAuthenticator() bool {
 	ours := h.Sum(nil)
 
 	// Loop & compare byte-by-byte
-	for i := 0; i < 16; i++ {
-		if p.Raw[4+i] != ours[i] {
+	for i := 0; i < PP_AUTHENTICATOR_LEN; i++ {
+		if p.Raw[PP_OFF_AUTHENTICATOR+i] != ours[i] {
 			return false
 		}
 	}
@@ -256,9 +278,11 @@ func (p *PortalPacket) VerifyAuthenticator() bool {
 	return true
 }
 
-func (p *PortalPacket) HexDumpString() (desc string) {
-	desc = hex.Dump(p.Raw)
-	return
+func (p *PortalPacket) log() Logger {
+	if p.Logger == nil {
+		return nopLogger{}
+	}
+	return p.Logger
 }
 
 func (p *PortalPacket) GetAttrByType(attrType uint8) (exist bool, attr AttributeValuePair) {
@@ -373,6 +397,19 @@ func (p *PortalPacket) PacketTypeString() (desc string) {
 	return
 }
 
+//PackageTypeOf returns PACKETTYPE_REQ or PACKETTYPE_RSP for a portal type, 0 when unknown.
+//the authenticator of a RSP is computed over the one of its request
+func PackageTypeOf(portalType uint8) uint {
+	switch portalType {
+	case PACKETTYPE_REQCHALLENGE, PACKETTYPE_REQAUTH, PACKETTYPE_REQLOGOUT,
+		PACKETTYPE_AFFACKAUTH, PACKETTYPE_NTFLOGOUT, PACKETTYPE_REQINFO:
+		return PACKETTYPE_REQ
+	case PACKETTYPE_ACKCHALLENGE, PACKETTYPE_ACKAUTH, PACKETTYPE_ACKLOGOUT, PACKETTYPE_ACKINFO:
+		return PACKETTYPE_RSP
+	}
+	return 0
+}
+
 func (p *AttributeValuePair) AttrTypeString() string {
 	switch p.Type {
 	case ATTRTYPE_USERNAME:
@@ -0,0 +1,56 @@
+package portaltest
+
+/*
+	helpers for the tests exchanging packets with a BAS
+*/
+
+import (
+	"net"
+	"testing"
+
+	"github.com/gityf/portalserver/portal"
+)
+
+//FakeBAS answers every request verified with secret by the packet built by handle, nil for no answer.
+//The ack is signed with secret unless handle sets SharedSecret, as a BAS of another secret would
+func FakeBAS(t testing.TB, secret string, handle func(req *portal.PortalPacket) *portal.PortalPacket) (port int, stop func()) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen err:%v", err)
+	}
+	go func() {
+		buf := make([]byte, portal.MAX_PORTALPACKET_LEN)
+		for {
+			n, raddr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			req := &portal.PortalPacket{
+				Raw:           append([]byte(nil), buf[:n]...),
+				PackageLen:    n,
+				PortalVersion: portal.DEF_PORTAL_VERSION2,
+				PackageType:   portal.PACKETTYPE_REQ,
+				SharedSecret:  secret,
+			}
+			if req.UnMarshal() != nil || !req.VerifyAuthenticator() {
+				continue
+			}
+			rsp := handle(req)
+			if rsp == nil {
+				continue
+			}
+			rsp.Version = portal.DEF_PORTAL_VERSION2
+			rsp.PortalVersion = portal.DEF_PORTAL_VERSION2
+			rsp.PackageType = portal.PACKETTYPE_RSP
+			rsp.SerialNo = req.SerialNo
+			rsp.UserIP = req.UserIP
+			rsp.AttrNum = uint8(len(rsp.AVPS))
+			if rsp.SharedSecret == "" {
+				rsp.SharedSecret = secret
+			}
+			rsp.Authenticator = req.Raw[portal.PP_OFF_AUTHENTICATOR:portal.PP_OFF_ATTRS]
+			conn.WriteToUDP(rsp.Marshal(), raddr)
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port, func() { conn.Close() }
+}
@@ -0,0 +1,125 @@
+package portal
+
+import (
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+//REDACTED replaces a credential in the logs
+const REDACTED = "******"
+
+//byte written over the credential attributes of a redacted packet dump
+const REDACTED_BYTE = '*'
+
+var ErrFullDumpReason = errors.New("full packet dump needs a reason")
+
+//FullDumpGrant records who enabled the full packet dumps and why
+type FullDumpGrant struct {
+	By     string
+	Reason string
+	Since  time.Time
+}
+
+var (
+	fullDumpMu    sync.RWMutex
+	fullDumpGrant *FullDumpGrant
+)
+
+//EnableFullDump makes HexDumpString and the client logs show credentials, never the shared secret,
+//for protocol debugging only. every full dump is tagged with the grant so the logs can be audited
+func EnableFullDump(by, reason string) (grant FullDumpGrant, err error) {
+	if reason == "" {
+		err = ErrFullDumpReason
+		return
+	}
+	grant = FullDumpGrant{By: by, Reason: reason, Since: time.Now()}
+	fullDumpMu.Lock()
+	fullDumpGrant = &grant
+	fullDumpMu.Unlock()
+	return
+}
+
+//DisableFullDump restores the redaction of credentials
+func DisableFullDump() {
+	fullDumpMu.Lock()
+	fullDumpGrant = nil
+	fullDumpMu.Unlock()
+}
+
+//FullDump returns the grant in force, ok is false when credentials are redacted
+func FullDump() (grant FullDumpGrant, ok bool) {
+	fullDumpMu.RLock()
+	defer fullDumpMu.RUnlock()
+	if fullDumpGrant == nil {
+		return
+	}
+	return *fullDumpGrant, true
+}
+
+//IsSecretAttr reports whether the attribute holds a credential
+func IsSecretAttr(attrType uint8) bool {
+	return attrType == ATTRTYPE_PASSWD || attrType == ATTRTYPE_CHAPPASSWD
+}
+
+//Redact returns REDACTED for a non empty s, s itself under a full dump grant
+func Redact(s string) string {
+	if s == "" {
+		return s
+	}
+	if _, ok := FullDump(); ok {
+		return s
+	}
+	return REDACTED
+}
+
+//SafeContent returns the content of the attribute for logging
+func (p *AttributeValuePair) SafeContent() string {
+	if IsSecretAttr(p.Type) {
+		return Redact(p.Content)
+	}
+	return p.Content
+}
+
+//RedactRaw returns a copy of raw with the content of the credential attributes overwritten,
+//version is DEF_PORTAL_VERSION1 or DEF_PORTAL_VERSION2
+func RedactRaw(raw []byte, version uint) []byte {
+	out := make([]byte, len(raw))
+	copy(out, raw)
+	if len(out) <= PP_OFF_ATTRNUM {
+		return out
+	}
+	index := PP_OFF_ATTRS
+	if version == DEF_PORTAL_VERSION1 {
+		index = PP_OFF_AUTHENTICATOR
+	}
+	attrNum := int(out[PP_OFF_ATTRNUM])
+	for ii := 0; ii < attrNum && index+2 <= len(out); ii++ {
+		attrType := out[index]
+		end := index + 2 + int(out[index+1])
+		if end > len(out) {
+			end = len(out)
+		}
+		if IsSecretAttr(attrType) {
+			for i := index + 2; i < end; i++ {
+				out[i] = REDACTED_BYTE
+			}
+		}
+		index = end
+	}
+	return out
+}
+
+//dumpHeader tags a full dump with its grant
+func dumpHeader(grant FullDumpGrant) string {
+	return "FULL DUMP by " + grant.By + " since " + grant.Since.Format(time.RFC3339) + ": " + grant.Reason + "\n"
+}
+
+//HexDumpString dumps p.Raw with PASSWD and CHAPPASSWD redacted, unless a full dump is granted
+func (p *PortalPacket) HexDumpString() (desc string) {
+	if grant, ok := FullDump(); ok {
+		return dumpHeader(grant) + hex.Dump(p.Raw)
+	}
+	return hex.Dump(RedactRaw(p.Raw, p.PortalVersion))
+}
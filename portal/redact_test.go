@@ -0,0 +1,87 @@
+package portal
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type recordLogger struct {
+	lines []string
+}
+
+func (l *recordLogger) add(format string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func (l *recordLogger) Trace(format string, args ...interface{}) { l.add(format, args...) }
+func (l *recordLogger) Debug(format string, args ...interface{}) { l.add(format, args...) }
+func (l *recordLogger) Info(format string, args ...interface{})  { l.add(format, args...) }
+func (l *recordLogger) Warn(format string, args ...interface{})  { l.add(format, args...) }
+func (l *recordLogger) Error(format string, args ...interface{}) { l.add(format, args...) }
+
+func newAuthPacket(t *testing.T, authType string, l Logger) *PortalClient {
+	p := &PortalClient{
+		BrasIP:       "127.0.0.9",
+		SharedSecret: "s3cr3t-key",
+		UserName:     "user",
+		Password:     "pa55word",
+		ChapPassword: "0123456789abcdef",
+		UserIP:       "10.0.0.2",
+		AuthType:     authType,
+		Logger:       l,
+	}
+	if !p.MakeRequestPacket(PACKETTYPE_REQAUTH) {
+		t.Fatal("make REQ_AUTH failed.")
+	}
+	p.ReleaseSerialNo()
+	return p
+}
+
+func TestHexDumpRedacted(t *testing.T) {
+	DisableFullDump()
+	for _, authType := range []string{"PAP", "CHAP"} {
+		l := &recordLogger{}
+		p := newAuthPacket(t, authType, l)
+		l.add("%v", p.Packet.HexDumpString())
+		all := strings.Join(l.lines, "\n")
+		for _, secret := range []string{"pa55word", "0123456789abcdef", "s3cr3t-key"} {
+			if strings.Contains(all, secret) {
+				t.Errorf("%v: %q in logs:\n%v", authType, secret, all)
+			}
+		}
+		if !strings.Contains(all, "user") {
+			t.Errorf("%v: username redacted:\n%v", authType, all)
+		}
+		//the packet itself is untouched
+		if !strings.Contains(string(p.Packet.Raw), "user") || strings.Contains(string(p.Packet.Raw), "***") {
+			t.Errorf("%v: raw packet changed", authType)
+		}
+	}
+}
+
+func TestFullDumpGrant(t *testing.T) {
+	defer DisableFullDump()
+	if _, err := EnableFullDump("test", ""); err != ErrFullDumpReason {
+		t.Errorf("expect ErrFullDumpReason, got %v", err)
+	}
+	if _, ok := FullDump(); ok {
+		t.Fatal("full dump granted without reason.")
+	}
+	if _, err := EnableFullDump("test", "debug BAS interop"); err != nil {
+		t.Fatalf("grant err:%v", err)
+	}
+	p := newAuthPacket(t, "PAP", nil)
+	dump := p.Packet.HexDumpString()
+	if !strings.HasPrefix(dump, "FULL DUMP by test") || !strings.Contains(dump, "debug BAS interop") ||
+		!strings.Contains(dump, "pa55word") {
+		t.Errorf("full dump:\n%v", dump)
+	}
+	if Redact("s3cr3t-key") != "s3cr3t-key" {
+		t.Error("secret redacted under grant.")
+	}
+	DisableFullDump()
+	if Redact("s3cr3t-key") != REDACTED {
+		t.Error("secret not redacted.")
+	}
+}
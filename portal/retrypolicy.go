@@ -0,0 +1,166 @@
+package portal
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+//failure kind of the last request/ack exchange
+const (
+	PCMFAIL_NONE          = 0
+	PCMFAIL_SEND          = 1 //send request failed
+	PCMFAIL_TIMEOUT       = 2 //no ack before the step timeout
+	PCMFAIL_SHORTPACKET   = 3 //ack shorter than the portal header
+	PCMFAIL_AUTHENTICATOR = 4 //ack authenticator not verified
+	PCMFAIL_DEADLINE      = 5 //overall deadline of the exchange exceeded
+	PCMFAIL_CANCELED      = 6 //context of the caller canceled
+	PCMFAIL_CIRCUIT_OPEN  = 7 //not sent, the circuit breaker of every BAS address is open
+)
+
+const (
+	DEF_TIMEOUT      = 2 * time.Second
+	DEF_BACKOFF_BASE = 100 * time.Millisecond
+	DEF_BACKOFF_MAX  = time.Second
+	DEF_JITTER       = 0.2
+)
+
+//RetryPolicy decides how one request is retransmitted to the BAS
+type RetryPolicy struct {
+	MaxAttempts             int
+	Timeout                 time.Duration           //step timeout when not set in StepTimeout
+	StepTimeout             map[uint8]time.Duration //keyed by request packet type
+	BackoffBase             time.Duration
+	BackoffMax              time.Duration
+	Jitter                  float64 //0.0 ~ 1.0 of the backoff
+	Deadline                time.Duration
+	RetryOnBadAuthenticator bool
+
+	rndMu sync.Mutex
+	rnd   *rand.Rand
+}
+
+var reqTypeNames = map[string]uint8{
+	"REQ_CHALLENGE": PACKETTYPE_REQCHALLENGE,
+	"REQ_AUTH":      PACKETTYPE_REQAUTH,
+	"REQ_LOGOUT":    PACKETTYPE_REQLOGOUT,
+	"AFF_ACK_AUTH":  PACKETTYPE_AFFACKAUTH,
+	"REQ_INFO":      PACKETTYPE_REQINFO,
+}
+
+//ReqTypeByName returns the request packet type of REQ_CHALLENGE, REQ_AUTH, ...
+func ReqTypeByName(name string) (reqType uint8, ok bool) {
+	reqType, ok = reqTypeNames[name]
+	return
+}
+
+//NewRetryPolicy returns a policy of attempts tries waiting timeout for each ack,
+//other fields use the defaults
+func NewRetryPolicy(attempts int, timeout time.Duration) *RetryPolicy {
+	r := &RetryPolicy{
+		MaxAttempts: attempts,
+		Timeout:     timeout,
+	}
+	r.Normalize()
+	return r
+}
+
+//Normalize replaces zero or invalid fields with the defaults
+func (r *RetryPolicy) Normalize() {
+	if r.MaxAttempts <= 0 {
+		r.MaxAttempts = 1
+	}
+	if r.Timeout <= 0 {
+		r.Timeout = DEF_TIMEOUT
+	}
+	if r.StepTimeout == nil {
+		r.StepTimeout = make(map[uint8]time.Duration)
+	}
+	if r.BackoffBase <= 0 {
+		r.BackoffBase = DEF_BACKOFF_BASE
+	}
+	if r.BackoffMax < r.BackoffBase {
+		r.BackoffMax = DEF_BACKOFF_MAX
+		if r.BackoffMax < r.BackoffBase {
+			r.BackoffMax = r.BackoffBase
+		}
+	}
+	if r.Jitter < 0 || r.Jitter > 1 {
+		r.Jitter = DEF_JITTER
+	}
+	if r.Deadline <= 0 {
+		//enough for every attempt with the longest backoff in between
+		r.Deadline = time.Duration(r.MaxAttempts) * (r.Timeout + r.BackoffMax)
+	}
+}
+
+//StepTimeoutFor returns the ack timeout of one attempt of reqType
+func (r *RetryPolicy) StepTimeoutFor(reqType uint8) time.Duration {
+	if t, ok := r.StepTimeout[reqType]; ok {
+		return t
+	}
+	return r.Timeout
+}
+
+//Backoff returns the wait before the attempt-th retransmission, attempt starts from 1
+func (r *RetryPolicy) Backoff(attempt int) time.Duration {
+	if attempt <= 0 {
+		return 0
+	}
+	d := r.BackoffBase
+	for i := 1; i < attempt && d < r.BackoffMax; i++ {
+		d *= 2
+	}
+	if d > r.BackoffMax {
+		d = r.BackoffMax
+	}
+	if r.Jitter > 0 {
+		r.rndMu.Lock()
+		if r.rnd == nil {
+			r.rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+		}
+		//spread in [d*(1-jitter), d*(1+jitter)]
+		f := 1 + r.Jitter*(2*r.rnd.Float64()-1)
+		r.rndMu.Unlock()
+		d = time.Duration(float64(d) * f)
+	}
+	return d
+}
+
+//Retryable tells whether a failure kind is worth another attempt
+func (r *RetryPolicy) Retryable(failure uint8) bool {
+	switch failure {
+	case PCMFAIL_SEND, PCMFAIL_TIMEOUT, PCMFAIL_SHORTPACKET:
+		return true
+	case PCMFAIL_AUTHENTICATOR:
+		//a wrong secret never verifies, only retry when asked to
+		return r.RetryOnBadAuthenticator
+	default:
+		return false
+	}
+}
+
+//FailureString returns the description of a failure kind
+func FailureString(failure uint8) (desc string) {
+	switch failure {
+	case PCMFAIL_NONE:
+		desc = "none"
+	case PCMFAIL_SEND:
+		desc = "send failed"
+	case PCMFAIL_TIMEOUT:
+		desc = "ack timeout"
+	case PCMFAIL_SHORTPACKET:
+		desc = "ack too short"
+	case PCMFAIL_AUTHENTICATOR:
+		desc = "ack authenticator mismatch"
+	case PCMFAIL_DEADLINE:
+		desc = "deadline exceeded"
+	case PCMFAIL_CANCELED:
+		desc = "canceled"
+	case PCMFAIL_CIRCUIT_OPEN:
+		desc = "circuit open"
+	default:
+		desc = "unknown"
+	}
+	return
+}
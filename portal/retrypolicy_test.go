@@ -0,0 +1,111 @@
+package portal
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	r := &RetryPolicy{
+		BackoffBase: 100 * time.Millisecond,
+		BackoffMax:  time.Second,
+		Jitter:      0.2,
+	}
+	for attempt := 1; attempt <= 10; attempt++ {
+		want := r.BackoffBase << uint(attempt-1)
+		if want > r.BackoffMax {
+			want = r.BackoffMax
+		}
+		for i := 0; i < 100; i++ {
+			d := r.Backoff(attempt)
+			if d < want*8/10 || d > want*12/10 {
+				t.Fatalf("attempt:%v backoff:%v out of [%v, %v]", attempt, d, want*8/10, want*12/10)
+			}
+		}
+	}
+	if r.Backoff(0) != 0 {
+		t.Error("first attempt should not wait.")
+	}
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	r := &RetryPolicy{}
+	for _, f := range []uint8{PCMFAIL_SEND, PCMFAIL_TIMEOUT, PCMFAIL_SHORTPACKET} {
+		if !r.Retryable(f) {
+			t.Errorf("%v should be retryable.", FailureString(f))
+		}
+	}
+	if r.Retryable(PCMFAIL_AUTHENTICATOR) || r.Retryable(PCMFAIL_DEADLINE) {
+		t.Error("bad authenticator and deadline should not be retryable.")
+	}
+	r.RetryOnBadAuthenticator = true
+	if !r.Retryable(PCMFAIL_AUTHENTICATOR) {
+		t.Error("bad authenticator should be retryable when asked.")
+	}
+}
+
+//a BAS which never answers REQ_CHALLENGE must get REQ_LOGOUT with ErrCode=1
+func TestAbandonedChallengeSendsLogout(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen err:%v", err)
+	}
+	defer conn.Close()
+
+	p := &PortalClient{
+		BrasIP:       "127.0.0.1",
+		BrasPort:     conn.LocalAddr().(*net.UDPAddr).Port,
+		SharedSecret: "secret",
+		UserName:     "user",
+		Password:     "pass",
+		UserIP:       "10.0.0.1",
+		AuthType:     "CHAP",
+		RetryPolicy: &RetryPolicy{
+			MaxAttempts: 2,
+			Timeout:     50 * time.Millisecond,
+			BackoffBase: 10 * time.Millisecond,
+			BackoffMax:  10 * time.Millisecond,
+			Deadline:    time.Second,
+		},
+	}
+
+	done := make(chan bool)
+	go func() {
+		done <- p.ReqLogin()
+	}()
+
+	var challengeSerial uint16
+	var types []uint8
+	buf := make([]byte, MAX_PORTALPACKET_LEN)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for len(types) < 3 {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("read err:%v, got:%v", err, types)
+		}
+		pkt := &PortalPacket{Raw: buf[:n], PackageLen: n, PortalVersion: DEF_PORTAL_VERSION2}
+		pkt.UnMarshal()
+		types = append(types, pkt.PortalType)
+		switch pkt.PortalType {
+		case PACKETTYPE_REQCHALLENGE:
+			challengeSerial = pkt.SerialNo
+		case PACKETTYPE_REQLOGOUT:
+			if pkt.ErrCode != 1 {
+				t.Errorf("expect ErrCode 1, got:%v", pkt.ErrCode)
+			}
+			if pkt.SerialNo != challengeSerial {
+				t.Errorf("expect serial %v, got:%v", challengeSerial, pkt.SerialNo)
+			}
+		}
+	}
+	if types[0] != PACKETTYPE_REQCHALLENGE || types[1] != PACKETTYPE_REQCHALLENGE || types[2] != PACKETTYPE_REQLOGOUT {
+		t.Errorf("unexpected packet sequence:%v", types)
+	}
+	if <-done {
+		t.Error("login should fail.")
+	}
+	if p.ErrCode != PCMERR_RECVTIMEOUT || p.LastFailure != PCMFAIL_TIMEOUT {
+		t.Errorf("expect timeout, got errcode:%v failure:%v", p.ErrCode, FailureString(p.LastFailure))
+	}
+}
@@ -0,0 +1,135 @@
+package portal
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+//serial no 0 is never used on the wire, valid range is [1, 0xFFFF]
+const (
+	MIN_SERIALNO = 1
+	MAX_SERIALNO = 0xFFFF
+)
+
+var ErrSerialNoExhausted = errors.New("all serial no are in flight")
+
+//SerialAllocator hands out serial numbers for one BAS.
+//a serial no stays reserved until Release is called, so a reply
+//can always be matched to the transaction that is waiting for it.
+type SerialAllocator struct {
+	mu       sync.Mutex
+	next     uint16
+	inFlight map[uint16]struct{}
+}
+
+//NewSerialAllocator creates an allocator starting from a random serial no
+func NewSerialAllocator() *SerialAllocator {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return newSerialAllocatorAt(uint16(MIN_SERIALNO + r.Intn(MAX_SERIALNO)))
+}
+
+func newSerialAllocatorAt(start uint16) *SerialAllocator {
+	if start < MIN_SERIALNO {
+		start = MIN_SERIALNO
+	}
+	return &SerialAllocator{
+		next:     start,
+		inFlight: make(map[uint16]struct{}),
+	}
+}
+
+//Acquire reserves the next serial no which is not in flight
+func (a *SerialAllocator) Acquire() (serialNo uint16, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.inFlight) >= MAX_SERIALNO {
+		err = ErrSerialNoExhausted
+		return
+	}
+	for {
+		serialNo = a.next
+		if a.next == MAX_SERIALNO {
+			a.next = MIN_SERIALNO
+		} else {
+			a.next++
+		}
+		if _, busy := a.inFlight[serialNo]; !busy {
+			break
+		}
+	}
+	a.inFlight[serialNo] = struct{}{}
+	return
+}
+
+//Release gives back a serial no, releasing a free serial no is a no-op
+func (a *SerialAllocator) Release(serialNo uint16) {
+	a.mu.Lock()
+	delete(a.inFlight, serialNo)
+	a.mu.Unlock()
+}
+
+//Next returns the serial no Acquire tries first
+func (a *SerialAllocator) Next() uint16 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.next
+}
+
+//InFlight returns the count of reserved serial no
+func (a *SerialAllocator) InFlight() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.inFlight)
+}
+
+var (
+	serialAllocatorsMu sync.Mutex
+	serialAllocators   = make(map[string]*SerialAllocator)
+)
+
+//GetSerialAllocator returns the allocator shared by all clients of a BAS
+func GetSerialAllocator(brasIP string) *SerialAllocator {
+	serialAllocatorsMu.Lock()
+	defer serialAllocatorsMu.Unlock()
+	a, ok := serialAllocators[brasIP]
+	if !ok {
+		a = NewSerialAllocator()
+		serialAllocators[brasIP] = a
+	}
+	return a
+}
+
+//RestoreSerialAllocator makes the allocator of a BAS start from next, as saved before
+//a restart; skip is added to cover the serial no used after the save. It does nothing
+//once the allocator of the BAS is in use.
+func RestoreSerialAllocator(brasIP string, next uint16, skip uint16) bool {
+	serialAllocatorsMu.Lock()
+	defer serialAllocatorsMu.Unlock()
+	if _, ok := serialAllocators[brasIP]; ok {
+		return false
+	}
+	start := uint32(next) + uint32(skip)
+	if start > MAX_SERIALNO {
+		start = start - MAX_SERIALNO + MIN_SERIALNO - 1
+	}
+	serialAllocators[brasIP] = newSerialAllocatorAt(uint16(start))
+	return true
+}
+
+//SerialAllocatorsNext returns the next serial no of every BAS, to be saved
+func SerialAllocatorsNext() map[string]uint16 {
+	serialAllocatorsMu.Lock()
+	allocators := make(map[string]*SerialAllocator, len(serialAllocators))
+	for ip, a := range serialAllocators {
+		allocators[ip] = a
+	}
+	serialAllocatorsMu.Unlock()
+	next := make(map[string]uint16, len(allocators))
+	for ip, a := range allocators {
+		next[ip] = a.Next()
+	}
+	return next
+}
@@ -0,0 +1,137 @@
+package portal
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSerialNoParallelNoCollision(t *testing.T) {
+	a := NewSerialAllocator()
+	const workers = 64
+	const perWorker = 500
+
+	var wg sync.WaitGroup
+	results := make(chan uint16, workers*perWorker)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perWorker; j++ {
+				sn, err := a.Acquire()
+				if err != nil {
+					t.Errorf("acquire err:%v", err)
+					return
+				}
+				results <- sn
+			}
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	seen := make(map[uint16]bool, workers*perWorker)
+	for sn := range results {
+		if sn == 0 {
+			t.Fatal("serial no 0 allocated.")
+		}
+		if seen[sn] {
+			t.Fatalf("serial no %v allocated twice.", sn)
+		}
+		seen[sn] = true
+	}
+	if a.InFlight() != workers*perWorker {
+		t.Errorf("expect %v in flight, got:%v", workers*perWorker, a.InFlight())
+	}
+}
+
+func TestSerialNoParallelAcquireRelease(t *testing.T) {
+	a := NewSerialAllocator()
+	var mu sync.Mutex
+	holders := make(map[uint16]int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				sn, err := a.Acquire()
+				if err != nil {
+					t.Errorf("acquire err:%v", err)
+					return
+				}
+				mu.Lock()
+				if other, ok := holders[sn]; ok {
+					t.Errorf("serial no %v held by %v and %v.", sn, other, id)
+				}
+				holders[sn] = id
+				mu.Unlock()
+
+				mu.Lock()
+				delete(holders, sn)
+				mu.Unlock()
+				a.Release(sn)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if a.InFlight() != 0 {
+		t.Errorf("expect nothing in flight, got:%v", a.InFlight())
+	}
+}
+
+func TestSerialNoWrap(t *testing.T) {
+	a := newSerialAllocatorAt(MAX_SERIALNO)
+	sn, _ := a.Acquire()
+	if sn != MAX_SERIALNO {
+		t.Errorf("expect %v, got:%v", MAX_SERIALNO, sn)
+	}
+	sn, _ = a.Acquire()
+	if sn != MIN_SERIALNO {
+		t.Errorf("expect wrap to %v, got:%v", MIN_SERIALNO, sn)
+	}
+}
+
+func TestSerialNoSkipInFlight(t *testing.T) {
+	a := newSerialAllocatorAt(MAX_SERIALNO - 1)
+	first, _ := a.Acquire()
+	for i := 0; i < MAX_SERIALNO-1; i++ {
+		sn, _ := a.Acquire()
+		a.Release(sn)
+	}
+	//next round comes back to first which is still in flight
+	sn, _ := a.Acquire()
+	if sn == first {
+		t.Errorf("in flight serial no %v reused.", first)
+	}
+}
+
+func TestSerialNoExhausted(t *testing.T) {
+	a := newSerialAllocatorAt(MIN_SERIALNO)
+	for i := 0; i < MAX_SERIALNO; i++ {
+		if _, err := a.Acquire(); err != nil {
+			t.Fatalf("acquire %v err:%v", i, err)
+		}
+	}
+	if _, err := a.Acquire(); err != ErrSerialNoExhausted {
+		t.Errorf("expect ErrSerialNoExhausted, got:%v", err)
+	}
+	a.Release(100)
+	sn, err := a.Acquire()
+	if err != nil || sn != 100 {
+		t.Errorf("expect 100 after release, got:%v err:%v", sn, err)
+	}
+}
+
+func TestRestoreSerialAllocator(t *testing.T) {
+	if !RestoreSerialAllocator("192.0.2.10", 0xFFF0, 0x20) {
+		t.Fatalf("not restored")
+	}
+	if next := SerialAllocatorsNext()["192.0.2.10"]; next != 0x11 {
+		t.Errorf("next %#x, want 0x11 after the wrap", next)
+	}
+	GetSerialAllocator("192.0.2.10").Acquire()
+	if RestoreSerialAllocator("192.0.2.10", 1, 0) || SerialAllocatorsNext()["192.0.2.10"] != 0x12 {
+		t.Errorf("allocator in use restored")
+	}
+}
@@ -0,0 +1,42 @@
+package portal
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+//Usage of a user as an ACK_INFO tells it, every attribute is optional
+type Usage struct {
+	UplinkFlux   uint64        //bytes sent by the user
+	DownlinkFlux uint64        //bytes received by the user
+	HasFlux      bool          //both flux attributes present
+	DelayTime    time.Duration //since the last traffic of the user
+	HasDelayTime bool
+}
+
+//Usage reads the flux and delay time attributes of the packet, 4 or 8 bytes big endian
+func (p *PortalPacket) Usage() (u Usage) {
+	up, upOk := p.uintAttr(ATTRTYPE_UPLINKFLUX)
+	down, downOk := p.uintAttr(ATTRTYPE_DOWNLINKFLUX)
+	if upOk && downOk {
+		u.UplinkFlux, u.DownlinkFlux, u.HasFlux = up, down, true
+	}
+	if delay, ok := p.uintAttr(ATTRTYPE_DELAYTIME); ok {
+		u.DelayTime, u.HasDelayTime = time.Duration(delay)*time.Second, true
+	}
+	return
+}
+
+func (p *PortalPacket) uintAttr(attrType uint8) (value uint64, ok bool) {
+	exist, attr := p.GetAttrByType(attrType)
+	if !exist {
+		return
+	}
+	switch len(attr.Content) {
+	case 4:
+		return uint64(binary.BigEndian.Uint32([]byte(attr.Content))), true
+	case 8:
+		return binary.BigEndian.Uint64([]byte(attr.Content)), true
+	}
+	return
+}
@@ -10,7 +10,7 @@ import (
 
 func checkError(err error){
 	if  err != nil {
-		fmt.Println("Error: %s", err.Error())
+		fmt.Printf("Error: %s\n", err.Error())
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,8 @@
+//Package web holds the pages and assets of the captive portal, embedded in the
+//binary for the deployments serving them with "embedded" of the static config
+package web
+
+import "embed"
+
+//go:embed css js templates
+var FS embed.FS
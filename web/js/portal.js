@@ -0,0 +1,152 @@
+/*
+	login and logout of the captive portal, the forms post to the portalserver api
+	and the errno of the answer is shown with USER_RET_DESC; an async login is
+	followed on its status url until done
+*/
+(function () {
+	'use strict';
+
+	var USER_RET_ERR_OK = 0;
+	var USER_RET_ERR_SEND_FAILED = 22;
+
+	function showMessage(text, isError) {
+		var message = document.getElementById('message');
+		message.textContent = text;
+		message.className = isError ? 'message error' : 'message';
+		message.hidden = false;
+	}
+
+	function showError(errno, errmsg) {
+		var desc = (typeof USER_RET_DESC !== 'undefined' && USER_RET_DESC[errno]) || errmsg || 'unknown error.';
+		showMessage(desc, true);
+	}
+
+	//post posts the fields of form and calls done with the json answer
+	function post(form, done) {
+		var button = form.querySelector('button');
+		button.disabled = true;
+		fetch(form.action, {
+			method: 'POST',
+			headers: {'Content-Type': 'application/x-www-form-urlencoded'},
+			body: new URLSearchParams(new FormData(form)).toString(),
+			credentials: 'same-origin'
+		}).then(function (rsp) {
+			return rsp.json();
+		}).then(function (res) {
+			button.disabled = false;
+			done(res);
+		}).catch(function () {
+			button.disabled = false;
+			showError(USER_RET_ERR_SEND_FAILED);
+		});
+	}
+
+	//follow calls done with the status of the async login id once done,
+	//by server-sent events or else long-polling
+	function follow(action, id, done) {
+		var url = action + '/status?id=' + encodeURIComponent(id);
+		if (typeof EventSource === 'undefined') {
+			poll(url, 0, done);
+			return;
+		}
+		var source = new EventSource(url);
+		source.addEventListener('status', function (e) {
+			var status = JSON.parse(e.data);
+			if (status.done) {
+				source.close();
+				done(status);
+			}
+		});
+		source.onerror = function () {
+			source.close();
+			poll(url, 0, done);
+		};
+	}
+
+	function poll(url, version, done) {
+		fetch(url + '&wait=20&version=' + version, {credentials: 'same-origin'}).then(function (rsp) {
+			return rsp.json();
+		}).then(function (res) {
+			if (res.errno !== USER_RET_ERR_OK) {
+				done(res);
+			} else if (res.data.done) {
+				done(res.data);
+			} else {
+				poll(url, res.data.version, done);
+			}
+		}).catch(function () {
+			done({errno: USER_RET_ERR_SEND_FAILED});
+		});
+	}
+
+	//query returns the hidden fields of form as a query string
+	function query(form, extra) {
+		var params = new URLSearchParams();
+		['username', 'userip', 'brasip', 'usermac'].forEach(function (name) {
+			var field = form.elements[name];
+			if (field && field.value) {
+				params.set(name, field.value);
+			}
+		});
+		Object.keys(extra || {}).forEach(function (name) {
+			params.set(name, extra[name]);
+		});
+		return params.toString();
+	}
+
+	var loginForm = document.getElementById('login-form');
+	if (loginForm) {
+		var loggedIn = function (res) {
+			if (res.errno !== USER_RET_ERR_OK) {
+				showError(res.errno, res.errmsg);
+				return;
+			}
+			location.href = loginForm.dataset.status + '?' +
+				query(loginForm, {logontime: Math.floor(Date.now() / 1000)});
+		};
+		loginForm.addEventListener('submit', function (e) {
+			e.preventDefault();
+			post(loginForm, function (res) {
+				if (res.errno !== USER_RET_ERR_OK || !res.id) {
+					loggedIn(res);
+					return;
+				}
+				var button = loginForm.querySelector('button');
+				button.disabled = true;
+				showMessage('Logging in...', false);
+				follow(loginForm.action, res.id, function (status) {
+					button.disabled = false;
+					loggedIn(status);
+				});
+			});
+		});
+	}
+
+	var logoutForm = document.getElementById('logout-form');
+	if (logoutForm) {
+		logoutForm.addEventListener('submit', function (e) {
+			e.preventDefault();
+			post(logoutForm, function (res) {
+				if (res.errno !== USER_RET_ERR_OK) {
+					showError(res.errno, res.errmsg);
+					return;
+				}
+				location.href = logoutForm.dataset.login + '?' + query(logoutForm, {loggedout: 1});
+			});
+		});
+	}
+
+	var logonTime = document.getElementById('logon-time');
+	if (logonTime) {
+		var since = parseInt(logonTime.dataset.logontime, 10) || Math.floor(Date.now() / 1000);
+		logonTime.textContent = new Date(since * 1000).toLocaleString();
+		var sessionTime = document.getElementById('session-time');
+		var tick = function () {
+			var seconds = Math.max(0, Math.floor(Date.now() / 1000) - since);
+			var h = Math.floor(seconds / 3600), m = Math.floor(seconds % 3600 / 60), s = seconds % 60;
+			sessionTime.textContent = h + ':' + (m < 10 ? '0' : '') + m + ':' + (s < 10 ? '0' : '') + s;
+		};
+		tick();
+		setInterval(tick, 1000);
+	}
+})();
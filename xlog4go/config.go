@@ -0,0 +1,258 @@
+package xlog4go
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"time"
+)
+
+// size based rotation and retention of the rotated files, shared by the file writers
+type ConfRotate struct {
+	MaxSizeMB  int  `json:"MaxSizeMB"`  // rotate past this size, 0 for time based rotation only
+	MaxBackups int  `json:"MaxBackups"` // rotated files kept, 0 for all
+	MaxAgeDays int  `json:"MaxAgeDays"` // rotated files older are removed, 0 for no limit
+	Compress   bool `json:"Compress"`   // gzip the rotated files
+}
+
+func (c *ConfRotate) apply(w *FileWriter) {
+	w.SetMaxSize(int64(c.MaxSizeMB) << 20)
+	w.SetMaxBackups(c.MaxBackups)
+	w.SetMaxAge(time.Duration(c.MaxAgeDays) * 24 * time.Hour)
+	w.SetCompress(c.Compress)
+}
+
+type ConfFileWriter struct {
+	On                  bool   `json:"On"`
+	LogPath             string `json:"LogPath"`
+	RotateLogPath       string `json:"RotateLogPath"`
+	WfLogPath           string `json:"WfLogPath"`
+	RotateWfLogPath     string `json:"RotateWfLogPath"`
+	PublicLogPath       string `json:"PublicLogPath"`
+	RotatePublicLogPath string `json:"RotatePublicLogPath"`
+	PublicLogPrefix     int    `json:"PublicLogPrefix"`
+	ConfRotate
+}
+
+type ConfConsoleWriter struct {
+	On    bool `json:"On"`
+	Color bool `json:"Color"`
+}
+
+type ConfJsonWriter struct {
+	On            bool   `json:"On"`
+	LogPath       string `json:"LogPath"`
+	RotateLogPath string `json:"RotateLogPath"`
+	LevelFloor    string `json:"LevelFloor"`
+	LevelCeil     string `json:"LevelCeil"`
+	ConfRotate
+}
+
+// one remote syslog destination, the levels out of [LevelFloor, LevelCeil] go elsewhere
+type ConfSyslogWriter struct {
+	On         bool   `json:"On"`
+	Network    string `json:"Network"` // udp, tcp, unix or unixgram
+	Addr       string `json:"Addr"`    // host:port, or the socket path
+	Facility   string `json:"Facility"`
+	AppName    string `json:"AppName"`
+	LevelFloor string `json:"LevelFloor"`
+	LevelCeil  string `json:"LevelCeil"`
+	BufferSize int    `json:"BufferSize"` // messages queued while the destination is down
+}
+
+// one newline delimited json over tcp destination
+type ConfNetJsonWriter struct {
+	On         bool   `json:"On"`
+	Addr       string `json:"Addr"`
+	LevelFloor string `json:"LevelFloor"`
+	LevelCeil  string `json:"LevelCeil"`
+	BufferSize int    `json:"BufferSize"`
+}
+
+type LogConfig struct {
+	Level string              `json:"LogLevel"`
+	FW    ConfFileWriter      `json:"FileWriter"`
+	CW    ConfConsoleWriter   `json:"ConsoleWriter"`
+	JW    ConfJsonWriter      `json:"JsonWriter"`
+	SW    []ConfSyslogWriter  `json:"SyslogWriters"`
+	NW    []ConfNetJsonWriter `json:"NetJsonWriters"`
+
+	TunnelSize     int    `json:"TunnelSize"`     // queued records, 1024 when 0
+	Overflow       string `json:"Overflow"`       // block, drop-oldest or drop-newest, block when empty
+	FlushInterval  int    `json:"FlushInterval"`  // ms, 1000 when 0
+	RotateInterval int    `json:"RotateInterval"` // ms between time based rotation checks, 10000 when 0
+
+	Modules map[string]string `json:"Modules"` // level of each module logger, LogLevel for the others
+}
+
+func SetupLogWithConf(file string) (err error) {
+	var lc LogConfig
+
+	cnt, err := ioutil.ReadFile(file)
+
+	if err = json.Unmarshal(cnt, &lc); err != nil {
+		return
+	}
+
+	overflow, err := ParseOverflow(lc.Overflow)
+	if err != nil {
+		return
+	}
+	logger_default.SetOverflow(overflow)
+	logger_default.SetTunnelSize(lc.TunnelSize)
+	logger_default.SetFlushInterval(time.Duration(lc.FlushInterval) * time.Millisecond)
+	logger_default.SetRotateInterval(time.Duration(lc.RotateInterval) * time.Millisecond)
+
+	if lc.FW.On {
+		if len(lc.FW.LogPath) > 0 {
+			w := NewFileWriter()
+			w.SetFileName(lc.FW.LogPath)
+			w.SetPathPattern(lc.FW.RotateLogPath)
+			w.SetLogLevelFloor(TRACE)
+			if len(lc.FW.WfLogPath) > 0 {
+				w.SetLogLevelCeil(INFO)
+			} else {
+				w.SetLogLevelCeil(ERROR)
+			}
+			w.SetLogPrefix(kLogPrefixTime | kLogPrefixLevel | kLogPrefixCode)
+			lc.FW.apply(w)
+			Register(w)
+		}
+
+		if len(lc.FW.WfLogPath) > 0 {
+			wfw := NewFileWriter()
+			wfw.SetFileName(lc.FW.WfLogPath)
+			wfw.SetPathPattern(lc.FW.RotateWfLogPath)
+			wfw.SetLogLevelFloor(WARNING)
+			wfw.SetLogLevelCeil(ERROR)
+			wfw.SetLogPrefix(kLogPrefixTime | kLogPrefixLevel | kLogPrefixCode)
+			lc.FW.apply(wfw)
+			Register(wfw)
+		}
+
+		if len(lc.FW.PublicLogPath) > 0 {
+			public := NewFileWriter()
+			public.SetFileName(lc.FW.PublicLogPath)
+			public.SetPathPattern(lc.FW.RotatePublicLogPath)
+			public.SetLogLevelFloor(PUBLIC)
+			public.SetLogLevelCeil(PUBLIC)
+			public.SetLogPrefix(lc.FW.PublicLogPrefix)
+			lc.FW.apply(public)
+			Register(public)
+		}
+	}
+
+	if lc.JW.On && len(lc.JW.LogPath) > 0 {
+		w := NewJsonWriter()
+		w.SetFileName(lc.JW.LogPath)
+		w.SetPathPattern(lc.JW.RotateLogPath)
+		floor, ceil, err := parseLevelRange(lc.JW.LevelFloor, lc.JW.LevelCeil)
+		if err != nil {
+			return err
+		}
+		w.SetLogLevelFloor(floor)
+		w.SetLogLevelCeil(ceil)
+		lc.JW.apply(w.FileWriter)
+		Register(w)
+	}
+
+	for _, c := range lc.SW {
+		if !c.On {
+			continue
+		}
+		w := NewSyslogWriter(c.Network, c.Addr)
+		floor, ceil, err := parseLevelRange(c.LevelFloor, c.LevelCeil)
+		if err != nil {
+			return err
+		}
+		facility, err := ParseFacility(c.Facility)
+		if err != nil {
+			return err
+		}
+		w.SetLogLevelFloor(floor)
+		w.SetLogLevelCeil(ceil)
+		w.SetFacility(facility)
+		w.SetAppName(c.AppName)
+		w.SetBufferSize(c.BufferSize)
+		Register(w)
+	}
+
+	for _, c := range lc.NW {
+		if !c.On {
+			continue
+		}
+		w := NewNetJsonWriter(c.Addr)
+		floor, ceil, err := parseLevelRange(c.LevelFloor, c.LevelCeil)
+		if err != nil {
+			return err
+		}
+		w.SetLogLevelFloor(floor)
+		w.SetLogLevelCeil(ceil)
+		w.SetBufferSize(c.BufferSize)
+		Register(w)
+	}
+
+	if lc.CW.On {
+		w := NewConsoleWriter()
+		w.SetColor(lc.CW.Color)
+		Register(w)
+	}
+
+	level, err := ParseLevel(lc.Level)
+	if err != nil {
+		return
+	}
+	SetLevel(level)
+
+	for module, name := range lc.Modules {
+		if level, err = ParseLevel(name); err != nil {
+			return
+		}
+		SetModuleLevel(module, level)
+	}
+	return
+}
+
+// parseLevelRange parses the level floor and ceil of a writer, TRACE and FATAL when empty
+func parseLevelRange(floorName, ceilName string) (floor, ceil int, err error) {
+	floor, ceil = TRACE, FATAL
+	if len(floorName) > 0 {
+		if floor, err = ParseLevel(floorName); err != nil {
+			return
+		}
+	}
+	if len(ceilName) > 0 {
+		ceil, err = ParseLevel(ceilName)
+	}
+	return
+}
+
+// ParseLevel converts a level name of log.json to its level
+func ParseLevel(s string) (level int, err error) {
+	switch s {
+	case "public":
+		level = PUBLIC
+
+	case "trace":
+		level = TRACE
+
+	case "debug":
+		level = DEBUG
+
+	case "info":
+		level = INFO
+
+	case "warning":
+		level = WARNING
+
+	case "error":
+		level = ERROR
+
+	case "fatal":
+		level = FATAL
+
+	default:
+		err = errors.New("Invalid log level")
+	}
+	return
+}
@@ -1,6 +1,7 @@
 package xlog4go
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 )
@@ -8,29 +9,36 @@ import (
 type colorRecord Record
 
 func (r *colorRecord) String() string {
+	info := r.info
+	if len(r.fields) > 0 {
+		buf := &bytes.Buffer{}
+		(*Record)(r).writeFieldsText(buf)
+		info += buf.String()
+	}
+
 	switch r.level {
 	case TRACE:
 		return fmt.Sprintf("\033[36m%s\033[0m [\033[34m%s\033[0m] \033[47;30m%s\033[0m %s\n",
-			r.time, LEVEL_FLAGS[r.level], r.code, r.info)
+			r.time, LEVEL_FLAGS[r.level], r.code, info)
 	case DEBUG:
 		return fmt.Sprintf("\033[36m%s\033[0m [\033[34m%s\033[0m] \033[47;30m%s\033[0m %s\n",
-			r.time, LEVEL_FLAGS[r.level], r.code, r.info)
+			r.time, LEVEL_FLAGS[r.level], r.code, info)
 
 	case INFO:
 		return fmt.Sprintf("\033[36m%s\033[0m [\033[32m%s\033[0m] \033[47;30m%s\033[0m %s\n",
-			r.time, LEVEL_FLAGS[r.level], r.code, r.info)
+			r.time, LEVEL_FLAGS[r.level], r.code, info)
 
 	case WARNING:
 		return fmt.Sprintf("\033[36m%s\033[0m [\033[33m%s\033[0m] \033[47;30m%s\033[0m %s\n",
-			r.time, LEVEL_FLAGS[r.level], r.code, r.info)
+			r.time, LEVEL_FLAGS[r.level], r.code, info)
 
 	case ERROR:
 		return fmt.Sprintf("\033[36m%s\033[0m [\033[31m%s\033[0m] \033[47;30m%s\033[0m %s\n",
-			r.time, LEVEL_FLAGS[r.level], r.code, r.info)
+			r.time, LEVEL_FLAGS[r.level], r.code, info)
 
 	case FATAL:
 		return fmt.Sprintf("\033[36m%s\033[0m [\033[35m%s\033[0m] \033[47;30m%s\033[0m %s\n",
-			r.time, LEVEL_FLAGS[r.level], r.code, r.info)
+			r.time, LEVEL_FLAGS[r.level], r.code, info)
 	}
 
 	return ""
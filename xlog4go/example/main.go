@@ -1,7 +1,7 @@
 package main
 
 import (
-	logger "github.com/xlog4go"
+	logger "github.com/gityf/portalserver/xlog4go"
 
 	"time"
 )
@@ -0,0 +1,335 @@
+package xlog4go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// REDACTED replaces the value of a field holding a credential
+const REDACTED = "******"
+
+// keys of the fields never written in clear, compared in lower case
+var redactKeys = map[string]bool{
+	"password":     true,
+	"passwd":       true,
+	"chappassword": true,
+	"chappasswd":   true,
+	"secret":       true,
+	"sharedsecret": true,
+}
+
+// IsRedactKey reports whether the value of the field key is masked
+func IsRedactKey(key string) bool {
+	return redactKeys[strings.ToLower(key)]
+}
+
+// Field is one key/value pair of a structured record
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Fields converts key/value pairs to fields, a key without value is kept with a nil value
+func Fields(kv ...interface{}) []Field {
+	if len(kv) == 0 {
+		return nil
+	}
+	fields := make([]Field, 0, (len(kv)+1)/2)
+	for i := 0; i < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprint(kv[i])
+		}
+		var value interface{}
+		if i+1 < len(kv) {
+			value = kv[i+1]
+		}
+		fields = append(fields, Field{Key: key, Value: value})
+	}
+	return fields
+}
+
+// Entry is a child logger, every record of it carries its fields
+type Entry struct {
+	logger *Logger
+	module string
+	fields []Field
+}
+
+// With returns a child logger of l carrying the key/value pairs
+func (l *Logger) With(kv ...interface{}) *Entry {
+	return &Entry{logger: l, fields: Fields(kv...)}
+}
+
+// Module returns the logger of the subsystem name, its records carry a module field
+func (l *Logger) Module(name string) *Entry {
+	return &Entry{logger: l, module: name, fields: []Field{{Key: "module", Value: name}}}
+}
+
+// With returns a child logger carrying the fields of e and the key/value pairs,
+// a key already carried by e takes the new value
+func (e *Entry) With(kv ...interface{}) *Entry {
+	return &Entry{logger: e.logger, module: e.module, fields: mergeFields(e.fields, Fields(kv...))}
+}
+
+// Module returns a child logger of e for the subsystem name, see SetModuleLevel
+func (e *Entry) Module(name string) *Entry {
+	return &Entry{logger: e.logger, module: name, fields: mergeFields(e.fields, []Field{{Key: "module", Value: name}})}
+}
+
+// mergeFields returns the fields with add appended, replacing the values of the keys already there
+func mergeFields(fields, add []Field) []Field {
+	merged := make([]Field, 0, len(fields)+len(add))
+	merged = append(merged, fields...)
+	for _, f := range add {
+		replaced := false
+		for i := range merged {
+			if merged[i].Key == f.Key {
+				merged[i].Value = f.Value
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, f)
+		}
+	}
+	return merged
+}
+
+// Fields returns the fields carried by e
+func (e *Entry) Fields() []Field {
+	return e.fields
+}
+
+func (e *Entry) withKV(kv []interface{}) []Field {
+	if len(kv) == 0 {
+		return e.fields
+	}
+	return mergeFields(e.fields, Fields(kv...))
+}
+
+func (e *Entry) Public(format string, args ...interface{}) {
+	e.logger.output(2, PUBLIC, e.module, e.fields, format, args...)
+}
+
+func (e *Entry) Trace(format string, args ...interface{}) {
+	e.logger.output(2, TRACE, e.module, e.fields, format, args...)
+}
+
+func (e *Entry) Debug(format string, args ...interface{}) {
+	e.logger.output(2, DEBUG, e.module, e.fields, format, args...)
+}
+
+func (e *Entry) Info(format string, args ...interface{}) {
+	e.logger.output(2, INFO, e.module, e.fields, format, args...)
+}
+
+func (e *Entry) Warn(format string, args ...interface{}) {
+	e.logger.output(2, WARNING, e.module, e.fields, format, args...)
+}
+
+func (e *Entry) Error(format string, args ...interface{}) {
+	e.logger.output(2, ERROR, e.module, e.fields, format, args...)
+}
+
+func (e *Entry) Fatal(format string, args ...interface{}) {
+	e.logger.output(2, FATAL, e.module, e.fields, format, args...)
+}
+
+func (e *Entry) Publicw(msg string, kv ...interface{}) {
+	e.logger.output(2, PUBLIC, e.module, e.withKV(kv), "%s", msg)
+}
+
+func (e *Entry) Tracew(msg string, kv ...interface{}) {
+	e.logger.output(2, TRACE, e.module, e.withKV(kv), "%s", msg)
+}
+
+func (e *Entry) Debugw(msg string, kv ...interface{}) {
+	e.logger.output(2, DEBUG, e.module, e.withKV(kv), "%s", msg)
+}
+
+func (e *Entry) Infow(msg string, kv ...interface{}) {
+	e.logger.output(2, INFO, e.module, e.withKV(kv), "%s", msg)
+}
+
+func (e *Entry) Warnw(msg string, kv ...interface{}) {
+	e.logger.output(2, WARNING, e.module, e.withKV(kv), "%s", msg)
+}
+
+func (e *Entry) Errorw(msg string, kv ...interface{}) {
+	e.logger.output(2, ERROR, e.module, e.withKV(kv), "%s", msg)
+}
+
+func (e *Entry) Fatalw(msg string, kv ...interface{}) {
+	e.logger.output(2, FATAL, e.module, e.withKV(kv), "%s", msg)
+}
+
+func (l *Logger) Publicw(msg string, kv ...interface{}) {
+	l.output(2, PUBLIC, "", Fields(kv...), "%s", msg)
+}
+
+func (l *Logger) Tracew(msg string, kv ...interface{}) {
+	l.output(2, TRACE, "", Fields(kv...), "%s", msg)
+}
+
+func (l *Logger) Debugw(msg string, kv ...interface{}) {
+	l.output(2, DEBUG, "", Fields(kv...), "%s", msg)
+}
+
+func (l *Logger) Infow(msg string, kv ...interface{}) {
+	l.output(2, INFO, "", Fields(kv...), "%s", msg)
+}
+
+func (l *Logger) Warnw(msg string, kv ...interface{}) {
+	l.output(2, WARNING, "", Fields(kv...), "%s", msg)
+}
+
+func (l *Logger) Errorw(msg string, kv ...interface{}) {
+	l.output(2, ERROR, "", Fields(kv...), "%s", msg)
+}
+
+func (l *Logger) Fatalw(msg string, kv ...interface{}) {
+	l.output(2, FATAL, "", Fields(kv...), "%s", msg)
+}
+
+// default logger
+func With(kv ...interface{}) *Entry {
+	return logger_default.With(kv...)
+}
+
+func Module(name string) *Entry {
+	return logger_default.Module(name)
+}
+
+func Publicw(msg string, kv ...interface{}) {
+	logger_default.output(2, PUBLIC, "", Fields(kv...), "%s", msg)
+}
+
+func Tracew(msg string, kv ...interface{}) {
+	logger_default.output(2, TRACE, "", Fields(kv...), "%s", msg)
+}
+
+func Debugw(msg string, kv ...interface{}) {
+	logger_default.output(2, DEBUG, "", Fields(kv...), "%s", msg)
+}
+
+func Infow(msg string, kv ...interface{}) {
+	logger_default.output(2, INFO, "", Fields(kv...), "%s", msg)
+}
+
+func Warnw(msg string, kv ...interface{}) {
+	logger_default.output(2, WARNING, "", Fields(kv...), "%s", msg)
+}
+
+func Errorw(msg string, kv ...interface{}) {
+	logger_default.output(2, ERROR, "", Fields(kv...), "%s", msg)
+}
+
+func Fatalw(msg string, kv ...interface{}) {
+	logger_default.output(2, FATAL, "", Fields(kv...), "%s", msg)
+}
+
+type entryKey struct{}
+
+// NewContext returns a copy of ctx carrying e
+func NewContext(ctx context.Context, e *Entry) context.Context {
+	return context.WithValue(ctx, entryKey{}, e)
+}
+
+// FromContext returns the entry carried by ctx, an entry of the default logger if none
+func FromContext(ctx context.Context) *Entry {
+	if ctx != nil {
+		if e, ok := ctx.Value(entryKey{}).(*Entry); ok && e != nil {
+			return e
+		}
+	}
+	return &Entry{logger: logger_default}
+}
+
+// fieldValue returns a value encoding/json renders the way %v would print it
+func fieldValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case nil, string, bool, int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64, float32, float64:
+		return x
+	case error:
+		return x.Error()
+	case fmt.Stringer:
+		return x.String()
+	case []byte:
+		return string(x)
+	}
+	return v
+}
+
+// value of the field for the writers, credentials masked
+func (f Field) value() interface{} {
+	if f.Value != nil && IsRedactKey(f.Key) {
+		return REDACTED
+	}
+	return fieldValue(f.Value)
+}
+
+func (r *Record) writeFieldsText(buf *bytes.Buffer) {
+	for _, f := range r.fields {
+		buf.WriteString(" ")
+		buf.WriteString(f.Key)
+		buf.WriteString("=")
+		switch v := f.value().(type) {
+		case string:
+			if needQuote(v) {
+				buf.WriteString(strconv.Quote(v))
+			} else {
+				buf.WriteString(v)
+			}
+		default:
+			fmt.Fprint(buf, v)
+		}
+	}
+}
+
+func needQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, c := range s {
+		if c <= ' ' || c == '=' || c == '"' || c > '~' {
+			return true
+		}
+	}
+	return false
+}
+
+// JsonString formats the record as one json line
+func (r *Record) JsonString() string {
+	buf := &bytes.Buffer{}
+	buf.WriteString(`{"time":`)
+	writeJsonValue(buf, r.time)
+	buf.WriteString(`,"level":`)
+	writeJsonValue(buf, LEVEL_FLAGS[r.level])
+	buf.WriteString(`,"code":`)
+	writeJsonValue(buf, r.code)
+	buf.WriteString(`,"msg":`)
+	writeJsonValue(buf, r.info)
+	for _, f := range r.fields {
+		buf.WriteString(",")
+		writeJsonValue(buf, f.Key)
+		buf.WriteString(":")
+		writeJsonValue(buf, f.value())
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+func writeJsonValue(buf *bytes.Buffer, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprintf("%v", v))
+	}
+	buf.Write(b)
+}
@@ -0,0 +1,110 @@
+package xlog4go
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type captureWriter struct {
+	text []string
+	json []string
+}
+
+func (w *captureWriter) Init() error {
+	return nil
+}
+
+func (w *captureWriter) Write(r *Record) error {
+	w.text = append(w.text, r.StringInfo(kLogPrefixLevel|kLogPrefixCode))
+	w.json = append(w.json, r.JsonString())
+	return nil
+}
+
+func newTestLogger(w Writer) *Logger {
+	l := NewLogger()
+	if l == DefaultLogger() {
+		l = NewLogger()
+	}
+	l.Register(w)
+	l.SetLevel(TRACE)
+	return l
+}
+
+func TestEntryFields(t *testing.T) {
+	w := &captureWriter{}
+	l := newTestLogger(w)
+	e := l.With("logid", 42, "userip", "10.0.0.1")
+	e.With("serialno", uint16(7)).Infow("auth ack", "err", errors.New("timeout"), "text", "a b")
+	e.Warn("plain %v", 1)
+	l.Close()
+
+	if len(w.text) != 2 {
+		t.Fatalf("records:%v", w.text)
+	}
+	want := `auth ack logid=42 userip=10.0.0.1 serialno=7 err=timeout text="a b"` + "\n"
+	if !strings.HasSuffix(w.text[0], want) {
+		t.Errorf("text:%q want suffix %q", w.text[0], want)
+	}
+	if !strings.Contains(w.text[0], "fields_test.go:") {
+		t.Errorf("code of caller missing:%q", w.text[0])
+	}
+	if !strings.HasSuffix(w.text[1], "plain 1 logid=42 userip=10.0.0.1\n") {
+		t.Errorf("text:%q", w.text[1])
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(w.json[0]), &m); err != nil {
+		t.Fatalf("json:%v err:%v", w.json[0], err)
+	}
+	if m["msg"] != "auth ack" || m["level"] != "INFO" || m["logid"] != float64(42) ||
+		m["serialno"] != float64(7) || m["err"] != "timeout" {
+		t.Errorf("json:%v", m)
+	}
+	if !strings.HasPrefix(m["code"].(string), "fields_test.go:") {
+		t.Errorf("code:%v", m["code"])
+	}
+}
+
+func TestFieldsOddKV(t *testing.T) {
+	f := Fields("a", 1, "b")
+	if len(f) != 2 || f[1].Key != "b" || f[1].Value != nil {
+		t.Errorf("fields:%v", f)
+	}
+}
+
+type wrappedEntry struct {
+	*Entry
+}
+
+type infoLogger interface {
+	Info(format string, args ...interface{})
+}
+
+func TestEntryCallerThroughEmbedding(t *testing.T) {
+	w := &captureWriter{}
+	l := newTestLogger(w)
+	var il infoLogger = wrappedEntry{l.With("k", "v")}
+	il.Info("x")
+	l.Close()
+
+	if len(w.text) != 1 || !strings.Contains(w.text[0], "fields_test.go:") {
+		t.Errorf("text:%v", w.text)
+	}
+}
+
+func TestFieldsRedacted(t *testing.T) {
+	w := &captureWriter{}
+	l := newTestLogger(w)
+	l.Infow("login", "Password", "p@ss", "secret", "88----89", "user", "bob")
+	l.Close()
+
+	if len(w.text) != 1 || strings.Contains(w.text[0], "p@ss") || strings.Contains(w.text[0], "88----89") ||
+		!strings.Contains(w.text[0], "Password="+REDACTED) {
+		t.Errorf("text:%v", w.text)
+	}
+	if strings.Contains(w.json[0], "p@ss") || strings.Contains(w.json[0], "88----89") {
+		t.Errorf("json:%v", w.json[0])
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"sync"
 	"time"
 )
 
@@ -22,6 +23,13 @@ type FileWriter struct {
 	actions       []func(*time.Time) int
 	variables     []interface{}
 	logPrefix     int
+
+	size       int64         // bytes in the current file
+	maxSize    int64         // rotate when the file would grow past it, 0 for no size rotation
+	maxBackups int           // rotated files kept, 0 for all
+	maxAge     time.Duration // rotated files older are removed, 0 for no limit
+	compress   bool          // gzip the rotated files
+	cleanMu    sync.Mutex    // serializes compression and retention
 }
 
 func NewFileWriter() *FileWriter {
@@ -48,6 +56,26 @@ func (w *FileWriter) SetLogPrefix(logPrefix int) {
 	w.logPrefix = logPrefix
 }
 
+// SetMaxSize rotates the file before it grows past size bytes
+func (w *FileWriter) SetMaxSize(size int64) {
+	w.maxSize = size
+}
+
+// SetMaxBackups keeps at most n rotated files
+func (w *FileWriter) SetMaxBackups(n int) {
+	w.maxBackups = n
+}
+
+// SetMaxAge removes the rotated files older than age
+func (w *FileWriter) SetMaxAge(age time.Duration) {
+	w.maxAge = age
+}
+
+// SetCompress gzips the rotated files
+func (w *FileWriter) SetCompress(compress bool) {
+	w.compress = compress
+}
+
 func (w *FileWriter) SetPathPattern(pattern string) error {
 	n := 0
 	for _, c := range pattern {
@@ -96,13 +124,22 @@ func (w *FileWriter) Write(r *Record) error {
 	if r.level < w.logLevelFloor || r.level > w.logLevelCeil {
 		return nil
 	}
+	return w.write(r.StringInfo(w.logPrefix))
+}
+
+// write appends one formatted record, rotating first when it would pass maxSize
+func (w *FileWriter) write(s string) error {
 	if w.fileBufWriter == nil {
 		return errors.New("no opened file")
 	}
-	if _, err := w.fileBufWriter.WriteString(r.StringInfo(w.logPrefix)); err != nil {
-		return err
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(s)) > w.maxSize {
+		if err := w.rotateBySize(); err != nil {
+			return err
+		}
 	}
-	return nil
+	n, err := w.fileBufWriter.WriteString(s)
+	w.size += int64(n)
+	return err
 }
 
 func (w *FileWriter) CreateLogFile() error {
@@ -118,6 +155,11 @@ func (w *FileWriter) CreateLogFile() error {
 		w.file = file
 	}
 
+	w.size = 0
+	if info, err := w.file.Stat(); err == nil {
+		w.size = info.Size()
+	}
+
 	if w.fileBufWriter = bufio.NewWriterSize(w.file, 8192); w.fileBufWriter == nil {
 		return errors.New("new fileBufWriter failed.")
 	}
@@ -163,6 +205,12 @@ func (w *FileWriter) Rotate() error {
 		if err := w.file.Close(); err != nil {
 			return err
 		}
+
+		if err := w.CreateLogFile(); err != nil {
+			return err
+		}
+		w.afterRotate(filePath)
+		return nil
 	}
 
 	return w.CreateLogFile()
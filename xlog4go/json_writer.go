@@ -0,0 +1,17 @@
+package xlog4go
+
+// JsonWriter writes records as one json object per line, fields as top level keys
+type JsonWriter struct {
+	*FileWriter
+}
+
+func NewJsonWriter() *JsonWriter {
+	return &JsonWriter{FileWriter: NewFileWriter()}
+}
+
+func (w *JsonWriter) Write(r *Record) error {
+	if r.level < w.logLevelFloor || r.level > w.logLevelCeil {
+		return nil
+	}
+	return w.write(r.JsonString())
+}
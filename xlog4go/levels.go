@@ -0,0 +1,251 @@
+package xlog4go
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var levelNames = [...]string{"trace", "debug", "info", "warning", "error", "fatal", "public"}
+
+// LevelName returns the log.json name of level
+func LevelName(level int) string {
+	if level < 0 || level >= len(levelNames) {
+		return "unknown"
+	}
+	return levelNames[level]
+}
+
+// LevelRule changes the level of a scope until it expires.
+// without Key it replaces the level of Module, "" for every module;
+// with Key it only raises the verbosity of the records whose field Key is Value.
+type LevelRule struct {
+	Module  string    `json:"module,omitempty"`
+	Key     string    `json:"key,omitempty"`
+	Value   string    `json:"value,omitempty"`
+	Level   int       `json:"-"`
+	Expires time.Time `json:"expires"` // zero never
+}
+
+func (r LevelRule) sameScope(o LevelRule) bool {
+	return r.Module == o.Module && r.Key == o.Key && r.Value == o.Value
+}
+
+func (r LevelRule) active(now time.Time) bool {
+	return r.Expires.IsZero() || now.Before(r.Expires)
+}
+
+func (r LevelRule) String() string {
+	return fmt.Sprintf("module=%q %v=%q level=%v expires=%v",
+		r.Module, r.Key, r.Value, LevelName(r.Level), r.Expires.Format(time.RFC3339))
+}
+
+// levelTable is never modified once stored, updates store a copy
+type levelTable struct {
+	modules map[string]int // levels of the modules from the config
+	rules   []LevelRule
+}
+
+func (l *Logger) table() *levelTable {
+	t, _ := l.levels.Load().(*levelTable)
+	return t
+}
+
+// update stores a copy of the table changed by fn
+func (l *Logger) update(fn func(t *levelTable)) {
+	l.levelsMu.Lock()
+	defer l.levelsMu.Unlock()
+
+	t := &levelTable{modules: make(map[string]int)}
+	if old := l.table(); old != nil {
+		for k, v := range old.modules {
+			t.modules[k] = v
+		}
+		t.rules = append(t.rules, old.rules...)
+	}
+	fn(t)
+	l.levels.Store(t)
+}
+
+// enabled reports whether a record of level, module and fields is written
+func (l *Logger) enabled(level int, module string, fields []Field) bool {
+	t := l.table()
+	if t == nil {
+		return level >= l.level
+	}
+
+	now := time.Now()
+	global := l.level
+	for _, r := range t.rules {
+		if r.Module == "" && r.Key == "" && r.active(now) {
+			global = r.Level
+		}
+	}
+	threshold := global
+	if lvl, ok := t.modules[module]; ok && module != "" {
+		threshold = lvl
+	}
+	for _, r := range t.rules {
+		if r.Module == module && module != "" && r.Key == "" && r.active(now) {
+			threshold = r.Level
+		}
+	}
+	if level >= threshold {
+		return true
+	}
+
+	for _, r := range t.rules {
+		if r.Key == "" || r.Level > level || (r.Module != "" && r.Module != module) || !r.active(now) {
+			continue
+		}
+		for _, f := range fields {
+			if f.Key == r.Key && fieldString(f.Value) == r.Value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func fieldString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(fieldValue(v))
+}
+
+// Level returns the default level
+func (l *Logger) Level() int {
+	return l.level
+}
+
+// SetModuleLevel sets the level of a module, the default level applies to the others
+func (l *Logger) SetModuleLevel(module string, level int) {
+	l.update(func(t *levelTable) {
+		t.modules[module] = level
+	})
+}
+
+// ModuleLevels returns the levels set by SetModuleLevel
+func (l *Logger) ModuleLevels() map[string]int {
+	levels := make(map[string]int)
+	if t := l.table(); t != nil {
+		for k, v := range t.modules {
+			levels[k] = v
+		}
+	}
+	return levels
+}
+
+var ErrRuleNotFound = errors.New("log level rule not found")
+
+// SetRule adds rule, replacing the rule of the same scope
+func (l *Logger) SetRule(rule LevelRule) {
+	l.update(func(t *levelTable) {
+		for i := range t.rules {
+			if t.rules[i].sameScope(rule) {
+				t.rules[i] = rule
+				return
+			}
+		}
+		t.rules = append(t.rules, rule)
+	})
+}
+
+// RemoveRule removes the rule of the scope, back to the default
+func (l *Logger) RemoveRule(module, key, value string) (err error) {
+	scope := LevelRule{Module: module, Key: key, Value: value}
+	err = ErrRuleNotFound
+	l.update(func(t *levelTable) {
+		for i := range t.rules {
+			if t.rules[i].sameScope(scope) {
+				t.rules = append(t.rules[:i], t.rules[i+1:]...)
+				err = nil
+				return
+			}
+		}
+	})
+	return
+}
+
+// Rules returns the rules in force, sorted by scope
+func (l *Logger) Rules() []LevelRule {
+	var rules []LevelRule
+	now := time.Now()
+	if t := l.table(); t != nil {
+		for _, r := range t.rules {
+			if r.active(now) {
+				rules = append(rules, r)
+			}
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].String() < rules[j].String()
+	})
+	return rules
+}
+
+// expireRules drops the expired rules, telling the writers, from the writer goroutine
+func (l *Logger) expireRules(now time.Time) {
+	for _, r := range l.pruneRules(now) {
+		l.write(&Record{
+			time:  now.Format(l.layout),
+			stamp: now,
+			code:  "levels.go",
+			info:  "log level rule expired, back to default: " + r.String(),
+			level: INFO,
+		})
+	}
+}
+
+// pruneRules drops the expired rules and returns them
+func (l *Logger) pruneRules(now time.Time) (expired []LevelRule) {
+	t := l.table()
+	if t == nil {
+		return
+	}
+	for _, r := range t.rules {
+		if !r.active(now) {
+			expired = append(expired, r)
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+	l.update(func(t *levelTable) {
+		rules := t.rules[:0]
+		for _, r := range t.rules {
+			if r.active(now) {
+				rules = append(rules, r)
+			}
+		}
+		t.rules = rules
+	})
+	return
+}
+
+// default logger
+func SetModuleLevel(module string, level int) {
+	logger_default.SetModuleLevel(module, level)
+}
+
+func SetRule(rule LevelRule) {
+	logger_default.SetRule(rule)
+}
+
+func RemoveRule(module, key, value string) error {
+	return logger_default.RemoveRule(module, key, value)
+}
+
+func Rules() []LevelRule {
+	return logger_default.Rules()
+}
+
+func ModuleLevels() map[string]int {
+	return logger_default.ModuleLevels()
+}
+
+func GetLevel() int {
+	return logger_default.Level()
+}
@@ -0,0 +1,90 @@
+package xlog4go
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestModuleLevelAndFilters(t *testing.T) {
+	w := &captureWriter{}
+	l := newTestLogger(w)
+	l.SetLevel(INFO)
+	l.SetModuleLevel("codec", WARNING)
+
+	codec := l.Module("codec")
+	bas1 := l.Module("portal").With("brasip", "10.0.0.1")
+	bas2 := l.Module("portal").With("brasip", "10.0.0.2")
+
+	codec.Info("codec info")        // below the codec level
+	codec.Warn("codec warn")        // written
+	bas1.Debug("bas1 debug before") // below the default level
+
+	l.SetRule(LevelRule{Module: "portal", Key: "brasip", Value: "10.0.0.1", Level: TRACE, Expires: time.Now().Add(time.Hour)})
+	bas1.Trace("bas1 trace")                                // written by the filter
+	bas2.Debug("bas2 debug")                                // other BAS unchanged
+	codec.With("brasip", "10.0.0.1").Debug("codec of bas1") // rule of another module
+
+	l.SetRule(LevelRule{Module: "codec", Level: DEBUG, Expires: time.Now().Add(-time.Second)})
+	codec.Debug("codec expired rule")
+
+	if err := l.RemoveRule("portal", "brasip", "10.0.0.1"); err != nil {
+		t.Errorf("remove err:%v", err)
+	}
+	bas1.Debug("bas1 debug after")
+	if err := l.RemoveRule("portal", "brasip", "10.0.0.1"); err != ErrRuleNotFound {
+		t.Errorf("remove again err:%v", err)
+	}
+	l.Close()
+
+	var got []string
+	for _, s := range w.text {
+		got = append(got, strings.Fields(s)[2])
+	}
+	want := "codec bas1"
+	if strings.Join(got, " ") != want {
+		t.Errorf("written:%v", w.text)
+	}
+	if len(w.text) != 2 || !strings.Contains(w.text[1], "bas1 trace module=portal brasip=10.0.0.1") {
+		t.Errorf("written:%v", w.text)
+	}
+}
+
+func TestGlobalRuleAndExpiry(t *testing.T) {
+	w := &captureWriter{}
+	l := newTestLogger(w)
+	l.SetLevel(ERROR)
+	l.SetRule(LevelRule{Level: DEBUG, Expires: time.Now().Add(time.Hour)})
+	l.SetRule(LevelRule{Module: "udp", Level: FATAL, Expires: time.Now().Add(time.Hour)})
+	l.Debug("global debug")
+	l.Module("udp").Error("udp error")
+
+	l.SetRule(LevelRule{Level: DEBUG, Expires: time.Now().Add(10 * time.Millisecond)})
+	time.Sleep(20 * time.Millisecond)
+	l.Debug("expired debug")
+	if rules := l.Rules(); len(rules) != 1 || rules[0].Module != "udp" {
+		t.Errorf("rules:%v", rules)
+	}
+	if expired := l.pruneRules(time.Now()); len(expired) != 1 || expired[0].Module != "" {
+		t.Errorf("expired:%v", expired)
+	}
+	if len(l.table().rules) != 1 {
+		t.Errorf("rules:%v", l.table().rules)
+	}
+	l.Close()
+
+	if len(w.text) != 1 || !strings.Contains(w.text[0], "global debug") {
+		t.Errorf("written:%v", w.text)
+	}
+}
+
+func TestEntryWithReplaces(t *testing.T) {
+	e := DefaultLogger().With("userip", "1.1.1.1", "logid", 1).With("userip", "2.2.2.2").Module("udp")
+	f := e.Fields()
+	if len(f) != 3 || f[0].Value != "2.2.2.2" || f[2].Key != "module" || f[2].Value != "udp" {
+		t.Errorf("fields:%v", f)
+	}
+	if e.Module("codec").Fields()[2].Value != "codec" {
+		t.Errorf("module not replaced")
+	}
+}
@@ -0,0 +1,557 @@
+package xlog4go
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"bytes"
+	"errors"
+)
+
+var (
+	LEVEL_FLAGS = [...]string{"TRACE", "DEBUG", "INFO", "WARN", "ERROR", "FATAL", "PUBLIC"}
+	recordPool  *sync.Pool
+)
+
+const (
+	TRACE = iota
+	DEBUG
+	INFO
+	WARNING
+	ERROR
+	FATAL
+	PUBLIC
+)
+
+const (
+	kLogPrefixTime  = 0x01
+	kLogPrefixLevel = 0x02
+	kLogPrefixCode  = 0x04
+)
+
+const tunnel_size_default = 1024
+
+const (
+	flush_interval_default  = time.Millisecond * 1000
+	rotate_interval_default = time.Second * 10
+)
+
+// what a full tunnel does with a new record
+const (
+	OVERFLOW_BLOCK       = iota // wait for the writers
+	OVERFLOW_DROP_OLDEST        // drop the oldest queued record
+	OVERFLOW_DROP_NEWEST        // drop the new record
+)
+
+var OVERFLOW_NAMES = [...]string{"block", "drop-oldest", "drop-newest"}
+
+// ParseOverflow converts an overflow name of log.json to its policy, block when empty
+func ParseOverflow(s string) (policy int, err error) {
+	if s == "" {
+		return OVERFLOW_BLOCK, nil
+	}
+	for i, name := range OVERFLOW_NAMES {
+		if name == s {
+			return i, nil
+		}
+	}
+	return OVERFLOW_BLOCK, errors.New("Invalid overflow policy")
+}
+
+type Record struct {
+	time   string
+	code   string
+	info   string
+	level  int
+	fields []Field
+	stamp  time.Time
+	buf    *bytes.Buffer
+}
+
+func (r *Record) StringInfo(logPrefix int) string {
+	r.buf = &bytes.Buffer{}
+	if logPrefix & kLogPrefixTime > 0 {
+		r.buf.WriteString(r.time)
+		r.buf.WriteString(" ")
+	}
+	if logPrefix & kLogPrefixLevel > 0 {
+		r.buf.WriteString("[")
+		r.buf.WriteString(LEVEL_FLAGS[r.level])
+		r.buf.WriteString("] ")
+	}
+	if logPrefix & kLogPrefixCode > 0 {
+		r.buf.WriteString("<")
+		r.buf.WriteString(r.code)
+		r.buf.WriteString("> ")
+	}
+	r.buf.WriteString(r.info)
+	r.writeFieldsText(r.buf)
+	r.buf.WriteString("\n")
+	return r.buf.String()
+}
+
+type Writer interface {
+	Init() error
+	Write(*Record) error
+}
+
+type Rotater interface {
+	Rotate() error
+	SetPathPattern(string) error
+}
+
+type Flusher interface {
+	Flush() error
+}
+
+// Closer is a Writer releasing its resources when the logger closes
+type Closer interface {
+	Close() error
+}
+
+type Logger struct {
+	writers     []Writer
+	tunnel      chan *Record
+	tunnelMu    sync.RWMutex      // write locked only to swap the tunnel
+	retunnel    chan chan *Record // hands a new tunnel to the writer goroutine
+	level       int
+	lastTime    int64
+	lastTimeStr string
+	c           chan bool
+	layout      string
+
+	overflow       int32
+	dropped        uint64
+	flushInterval  int64 // time.Duration
+	rotateInterval int64 // time.Duration
+
+	levelsMu sync.Mutex   // serializes the updates of levels
+	levels   atomic.Value // *levelTable, nil until a module level or rule is set
+
+	statusMu sync.Mutex // guards status
+	status   WriterStatus
+}
+
+// WriterStatus tells whether the writers keep up with the records
+type WriterStatus struct {
+	LastWrite time.Time // last record every writer took
+	LastError time.Time // last write or flush error of a writer
+	Err       error     // that error
+	Pending   int       // records queued for the writers
+}
+
+// Healthy tells whether the writers succeeded since their last error
+func (s WriterStatus) Healthy() bool {
+	return s.Err == nil || s.LastWrite.After(s.LastError)
+}
+
+func NewLogger() *Logger {
+	if logger_default != nil && takeup == false {
+		takeup = true
+		return logger_default
+	}
+
+	l := new(Logger)
+	l.writers = make([]Writer, 0, 2)
+	l.tunnel = make(chan *Record, tunnel_size_default)
+	l.retunnel = make(chan chan *Record)
+	l.c = make(chan bool, 1)
+	l.flushInterval = int64(flush_interval_default)
+	l.rotateInterval = int64(rotate_interval_default)
+	l.level = DEBUG
+	l.layout = "2006/01/02 15:04:05"
+
+	go boostrapLogWriter(l)
+
+	return l
+}
+
+func (l *Logger) Register(w Writer) {
+	if err := w.Init(); err != nil {
+		panic(err)
+	}
+	l.writers = append(l.writers, w)
+}
+
+func (l *Logger) SetLevel(lvl int) {
+	l.level = lvl
+}
+
+func (l *Logger) SetLayout(layout string) {
+	l.layout = layout
+}
+
+// SetOverflow sets what a full tunnel does with a new record, OVERFLOW_BLOCK by default
+func (l *Logger) SetOverflow(policy int) {
+	atomic.StoreInt32(&l.overflow, int32(policy))
+}
+
+// Dropped returns the number of records dropped by the overflow policy
+func (l *Logger) Dropped() uint64 {
+	return atomic.LoadUint64(&l.dropped)
+}
+
+// SetFlushInterval sets how often the writers are flushed
+func (l *Logger) SetFlushInterval(d time.Duration) {
+	if d > 0 {
+		atomic.StoreInt64(&l.flushInterval, int64(d))
+	}
+}
+
+// SetRotateInterval sets how often the writers check their time based rotation
+func (l *Logger) SetRotateInterval(d time.Duration) {
+	if d > 0 {
+		atomic.StoreInt64(&l.rotateInterval, int64(d))
+	}
+}
+
+// SetTunnelSize replaces the tunnel by one of size records, the queued records are kept
+func (l *Logger) SetTunnelSize(size int) {
+	if size <= 0 {
+		return
+	}
+	tunnel := make(chan *Record, size)
+	l.tunnelMu.Lock()
+	l.tunnel = tunnel
+	l.tunnelMu.Unlock()
+	l.retunnel <- tunnel
+}
+
+func (l *Logger) Public(fmt string, args ...interface{}) {
+	l.deliverRecordToWriter(PUBLIC, fmt, args...)
+}
+
+func (l *Logger) Trace(fmt string, args ...interface{}) {
+	l.deliverRecordToWriter(TRACE, fmt, args...)
+}
+
+func (l *Logger) Debug(fmt string, args ...interface{}) {
+	l.deliverRecordToWriter(DEBUG, fmt, args...)
+}
+
+func (l *Logger) Warn(fmt string, args ...interface{}) {
+	l.deliverRecordToWriter(WARNING, fmt, args...)
+}
+
+func (l *Logger) Info(fmt string, args ...interface{}) {
+	l.deliverRecordToWriter(INFO, fmt, args...)
+}
+
+func (l *Logger) Error(fmt string, args ...interface{}) {
+	l.deliverRecordToWriter(ERROR, fmt, args...)
+}
+
+func (l *Logger) Fatal(fmt string, args ...interface{}) {
+	l.deliverRecordToWriter(FATAL, fmt, args...)
+}
+
+func (l *Logger) Close() {
+	l.tunnelMu.Lock()
+	close(l.tunnel)
+	l.tunnelMu.Unlock()
+	<-l.c
+
+	for _, w := range l.writers {
+		if f, ok := w.(Flusher); ok {
+			if err := f.Flush(); err != nil {
+				log.Println(err)
+			}
+		}
+		if c, ok := w.(Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+func (l *Logger) deliverRecordToWriter(level int, format string, args ...interface{}) {
+	l.output(3, level, "", nil, format, args...)
+}
+
+// output delivers one record of module, calldepth is the stack depth of the caller to record
+func (l *Logger) output(calldepth int, level int, module string, fields []Field, format string, args ...interface{}) {
+	var inf, code string
+
+	if !l.enabled(level, module, fields) {
+		return
+	}
+
+	if format != "" {
+		inf = fmt.Sprintf(format, args...)
+	} else {
+		inf = fmt.Sprint(args...)
+	}
+
+	// source code, file and line num
+	_, file, line, ok := runtime.Caller(calldepth)
+	if ok {
+		code = path.Base(file) + ":" + strconv.Itoa(line)
+	}
+
+	// format time
+	now := time.Now()
+	if now.Unix() != l.lastTime {
+		l.lastTime = now.Unix()
+		l.lastTimeStr = now.Format(l.layout)
+	}
+
+	r := recordPool.Get().(*Record)
+	r.info = inf
+	r.code = code
+	r.time = l.lastTimeStr
+	r.stamp = now
+	r.level = level
+	r.fields = fields
+
+	l.enqueue(r)
+}
+
+// enqueue hands r to the writer goroutine following the overflow policy,
+// warnings and errors wait for room whatever the policy
+func (l *Logger) enqueue(r *Record) {
+	l.tunnelMu.RLock()
+	defer l.tunnelMu.RUnlock()
+
+	policy := atomic.LoadInt32(&l.overflow)
+	if r.kept() {
+		policy = OVERFLOW_BLOCK
+	}
+	switch policy {
+	case OVERFLOW_DROP_NEWEST:
+		select {
+		case l.tunnel <- r:
+		default:
+			atomic.AddUint64(&l.dropped, 1)
+			putRecord(r)
+		}
+
+	case OVERFLOW_DROP_OLDEST:
+		for {
+			select {
+			case l.tunnel <- r:
+				return
+			default:
+			}
+			select {
+			case old, ok := <-l.tunnel:
+				if !ok {
+					putRecord(r)
+					return
+				}
+				if old.kept() {
+					// queued again behind, r is dropped in its place
+					l.tunnel <- old
+					atomic.AddUint64(&l.dropped, 1)
+					putRecord(r)
+					return
+				}
+				atomic.AddUint64(&l.dropped, 1)
+				putRecord(old)
+			default:
+			}
+		}
+
+	default:
+		l.tunnel <- r
+	}
+}
+
+// kept reports whether r is never dropped on overflow, the levels of the wf file
+func (r *Record) kept() bool {
+	return r.level >= WARNING && r.level <= FATAL
+}
+
+func putRecord(r *Record) {
+	r.fields = nil
+	recordPool.Put(r)
+}
+
+func boostrapLogWriter(logger *Logger) {
+	if logger == nil {
+		panic("logger is nil")
+	}
+
+	var (
+		r        *Record
+		ok       bool
+		reported uint64
+	)
+	logger.tunnelMu.RLock()
+	tunnel := logger.tunnel
+	logger.tunnelMu.RUnlock()
+
+	flushTimer := time.NewTimer(time.Duration(atomic.LoadInt64(&logger.flushInterval)))
+	rotateTimer := time.NewTimer(time.Duration(atomic.LoadInt64(&logger.rotateInterval)))
+
+	for {
+		select {
+		case r, ok = <-tunnel:
+			if !ok {
+				logger.c <- true
+				return
+			}
+
+			logger.write(r)
+			putRecord(r)
+
+		case next := <-logger.retunnel:
+			// no more record enters the old tunnel, write what is left
+			for drained := false; !drained; {
+				select {
+				case r = <-tunnel:
+					logger.write(r)
+					putRecord(r)
+				default:
+					drained = true
+				}
+			}
+			tunnel = next
+
+		case <-flushTimer.C:
+			if dropped := logger.Dropped(); dropped != reported {
+				logger.writeDropped(dropped - reported)
+				reported = dropped
+			}
+			for _, w := range logger.writers {
+				if f, ok := w.(Flusher); ok {
+					if err := f.Flush(); err != nil {
+						log.Println(err)
+						logger.setStatus(err)
+					}
+				}
+			}
+			flushTimer.Reset(time.Duration(atomic.LoadInt64(&logger.flushInterval)))
+
+		case <-rotateTimer.C:
+			logger.expireRules(time.Now())
+			for _, w := range logger.writers {
+				if r, ok := w.(Rotater); ok {
+					if err := r.Rotate(); err != nil {
+						log.Println(err)
+					}
+				}
+			}
+			rotateTimer.Reset(time.Duration(atomic.LoadInt64(&logger.rotateInterval)))
+		}
+	}
+}
+
+func (l *Logger) write(r *Record) {
+	var failed error
+	for _, w := range l.writers {
+		if err := w.Write(r); err != nil {
+			log.Println(err)
+			failed = err
+		}
+	}
+	l.setStatus(failed)
+}
+
+// setStatus records the result of a write or flush of the writers
+func (l *Logger) setStatus(err error) {
+	now := time.Now()
+	l.statusMu.Lock()
+	if err != nil {
+		l.status.LastError, l.status.Err = now, err
+	} else {
+		l.status.LastWrite = now
+	}
+	l.statusMu.Unlock()
+}
+
+// Status returns the status of the writers
+func (l *Logger) Status() WriterStatus {
+	l.statusMu.Lock()
+	status := l.status
+	l.statusMu.Unlock()
+	l.tunnelMu.RLock()
+	status.Pending = len(l.tunnel)
+	l.tunnelMu.RUnlock()
+	return status
+}
+
+// writeDropped tells the writers how many records the overflow policy dropped
+func (l *Logger) writeDropped(n uint64) {
+	_, file, line, _ := runtime.Caller(0)
+	now := time.Now()
+	l.write(&Record{
+		time:  now.Format(l.layout),
+		stamp: now,
+		code:  path.Base(file) + ":" + strconv.Itoa(line),
+		info:  fmt.Sprintf("log tunnel full, %v records dropped", n),
+		level: WARNING,
+	})
+}
+
+// default
+var (
+	logger_default *Logger
+	takeup         = false
+)
+
+func SetLevel(lvl int) {
+	logger_default.level = lvl
+}
+
+// DefaultLogger returns the logger behind the package level functions
+func DefaultLogger() *Logger {
+	return logger_default
+}
+
+func SetLayout(layout string) {
+	logger_default.layout = layout
+}
+
+// Status returns the status of the writers of the default logger
+func Status() WriterStatus {
+	return logger_default.Status()
+}
+
+func Public(fmt string, args ...interface{}) {
+	logger_default.deliverRecordToWriter(PUBLIC, fmt, args...)
+}
+
+func Trace(fmt string, args ...interface{}) {
+	logger_default.deliverRecordToWriter(TRACE, fmt, args...)
+}
+
+func Debug(fmt string, args ...interface{}) {
+	logger_default.deliverRecordToWriter(DEBUG, fmt, args...)
+}
+
+func Warn(fmt string, args ...interface{}) {
+	logger_default.deliverRecordToWriter(WARNING, fmt, args...)
+}
+
+func Info(fmt string, args ...interface{}) {
+	logger_default.deliverRecordToWriter(INFO, fmt, args...)
+}
+
+func Error(fmt string, args ...interface{}) {
+	logger_default.deliverRecordToWriter(ERROR, fmt, args...)
+}
+
+func Fatal(fmt string, args ...interface{}) {
+	logger_default.deliverRecordToWriter(FATAL, fmt, args...)
+}
+
+func Register(w Writer) {
+	logger_default.Register(w)
+}
+
+func Close() {
+	logger_default.Close()
+}
+
+func init() {
+	logger_default = NewLogger()
+	recordPool = &sync.Pool{New: func() interface{} {
+		return &Record{}
+	}}
+}
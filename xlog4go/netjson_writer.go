@@ -0,0 +1,38 @@
+package xlog4go
+
+// NetJsonWriter ships records as newline delimited json over tcp,
+// reconnecting with backoff and buffering a bounded number of records meanwhile
+type NetJsonWriter struct {
+	*shipper
+	logLevelFloor int
+	logLevelCeil  int
+}
+
+func NewNetJsonWriter(addr string) *NetJsonWriter {
+	return &NetJsonWriter{
+		shipper:       newShipper("tcp", addr),
+		logLevelFloor: TRACE,
+		logLevelCeil:  FATAL,
+	}
+}
+
+func (w *NetJsonWriter) Init() error {
+	w.start()
+	return nil
+}
+
+func (w *NetJsonWriter) SetLogLevelFloor(floor int) {
+	w.logLevelFloor = floor
+}
+
+func (w *NetJsonWriter) SetLogLevelCeil(ceil int) {
+	w.logLevelCeil = ceil
+}
+
+func (w *NetJsonWriter) Write(r *Record) error {
+	if r.level < w.logLevelFloor || r.level > w.logLevelCeil {
+		return nil
+	}
+	w.send([]byte(r.JsonString()))
+	return nil
+}
@@ -0,0 +1,197 @@
+package xlog4go
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gateWriter blocks every write until the gate is opened
+type gateWriter struct {
+	gate chan struct{}
+	info []string
+}
+
+func (w *gateWriter) Init() error {
+	return nil
+}
+
+func (w *gateWriter) Write(r *Record) error {
+	<-w.gate
+	w.info = append(w.info, r.info)
+	return nil
+}
+
+func testOverflow(t *testing.T, policy int) (w *gateWriter, dropped uint64) {
+	w = &gateWriter{gate: make(chan struct{})}
+	l := newTestLogger(w)
+	l.SetTunnelSize(2)
+	l.SetOverflow(policy)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			l.Info("record %v", i)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("%v blocked the caller.", OVERFLOW_NAMES[policy])
+	}
+	dropped = l.Dropped()
+	close(w.gate)
+	l.Close()
+
+	if dropped == 0 || uint64(len(w.info))+dropped != 10 {
+		t.Errorf("%v: written:%v dropped:%v", OVERFLOW_NAMES[policy], len(w.info), dropped)
+	}
+	return
+}
+
+func TestOverflowDropNewest(t *testing.T) {
+	w, _ := testOverflow(t, OVERFLOW_DROP_NEWEST)
+	if len(w.info) > 0 && w.info[len(w.info)-1] == "record 9" {
+		t.Errorf("newest record kept:%v", w.info)
+	}
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	w, _ := testOverflow(t, OVERFLOW_DROP_OLDEST)
+	if len(w.info) == 0 || w.info[len(w.info)-1] != "record 9" {
+		t.Errorf("newest record lost:%v", w.info)
+	}
+}
+
+func TestOverflowKeepsWarnings(t *testing.T) {
+	w := &gateWriter{gate: make(chan struct{})}
+	l := newTestLogger(w)
+	l.SetTunnelSize(2)
+	l.SetOverflow(OVERFLOW_DROP_OLDEST)
+
+	// the writer holds the first record, the warning is the oldest queued
+	l.Info("first")
+	for len(l.tunnel) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan struct{})
+	go func() {
+		l.Warn("warning")
+		for i := 0; i < 10; i++ {
+			l.Info("record %v", i)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("drop-oldest blocked the caller.")
+	}
+	close(w.gate)
+	l.Close()
+
+	if !strings.Contains(strings.Join(w.info, ","), "warning") {
+		t.Errorf("warning dropped:%v", w.info)
+	}
+}
+
+func TestParseOverflow(t *testing.T) {
+	if p, err := ParseOverflow("drop-oldest"); err != nil || p != OVERFLOW_DROP_OLDEST {
+		t.Errorf("policy:%v err:%v", p, err)
+	}
+	if p, err := ParseOverflow(""); err != nil || p != OVERFLOW_BLOCK {
+		t.Errorf("policy:%v err:%v", p, err)
+	}
+	if _, err := ParseOverflow("drop-all"); err == nil {
+		t.Error("expect invalid policy.")
+	}
+}
+
+func TestRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	w := NewFileWriter()
+	w.SetFileName(filepath.Join(dir, "test.log"))
+	w.SetPathPattern(filepath.Join(dir, "test.log.%Y%M%D%H"))
+	w.SetLogLevelFloor(TRACE)
+	w.SetLogLevelCeil(FATAL)
+	w.SetMaxSize(100)
+	w.SetMaxBackups(2)
+	w.SetCompress(true)
+	if err := w.Init(); err != nil {
+		t.Fatalf("init err:%v", err)
+	}
+
+	line := strings.Repeat("x", 59) + "\n"
+	for i := 0; i < 5; i++ {
+		if err := w.write(line); err != nil {
+			t.Fatalf("write err:%v", err)
+		}
+	}
+	w.Flush()
+
+	// compression and retention run in the background
+	var files []backupFile
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		w.cleanMu.Lock()
+		files, _ = w.backups()
+		w.cleanMu.Unlock()
+		if len(files) == 2 && strings.HasSuffix(files[0].path, ".gz") && strings.HasSuffix(files[1].path, ".gz") {
+			break
+		}
+	}
+	if len(files) != 2 {
+		t.Fatalf("backups:%v", files)
+	}
+	for _, f := range files {
+		if !strings.HasSuffix(f.path, ".gz") {
+			t.Errorf("not compressed:%v", f.path)
+			continue
+		}
+		fin, _ := os.Open(f.path)
+		zr, err := gzip.NewReader(fin)
+		if err != nil {
+			t.Fatalf("gzip err:%v", err)
+		}
+		cnt, _ := io.ReadAll(zr)
+		fin.Close()
+		if string(cnt) != line {
+			t.Errorf("content:%q", cnt)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dir, "test.log")); err != nil || info.Size() != int64(len(line)) {
+		t.Errorf("current file:%v err:%v", info, err)
+	}
+}
+
+func TestRemoveOldBackupsByAge(t *testing.T) {
+	dir := t.TempDir()
+	w := NewFileWriter()
+	w.SetFileName(filepath.Join(dir, "age.log"))
+	w.SetMaxAge(time.Hour)
+
+	old := time.Now().Add(-2 * time.Hour)
+	for _, name := range []string{"age.log.1", "age.log.2", "age.log", "age.log.wf"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644)
+	}
+	os.Chtimes(filepath.Join(dir, "age.log.1"), old, old)
+	os.Chtimes(filepath.Join(dir, "age.log"), old, old)
+	// a sibling log, not a backup
+	os.Chtimes(filepath.Join(dir, "age.log.wf"), old, old)
+
+	if err := w.removeOldBackups(time.Now()); err != nil {
+		t.Fatalf("err:%v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "age.log.1")); !os.IsNotExist(err) {
+		t.Error("old backup kept.")
+	}
+	for _, name := range []string{"age.log.2", "age.log", "age.log.wf"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%v removed.", name)
+		}
+	}
+}
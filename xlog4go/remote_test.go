@@ -0,0 +1,217 @@
+package xlog4go
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var syslogLine = regexp.MustCompile(`^<(\d+)>1 \S+ \S+ portal \d+ (\S+) \[xlog4go@32473 code="[^"]+"(.*)\] (.*)$`)
+
+func checkSyslog(t *testing.T, msg string, pri int, level, sd, info string) {
+	m := syslogLine.FindStringSubmatch(msg)
+	if m == nil {
+		t.Fatalf("bad syslog message:%q", msg)
+	}
+	if m[1] != strconv.Itoa(pri) || m[2] != level || m[3] != sd || m[4] != info {
+		t.Errorf("message:%q", msg)
+	}
+}
+
+func newSyslogTestWriter(network, addr string) *SyslogWriter {
+	w := NewSyslogWriter(network, addr)
+	w.SetAppName("portal")
+	w.SetFacility(syslogFacilities["local0"])
+	w.SetLogLevelCeil(PUBLIC)
+	return w
+}
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen err:%v", err)
+	}
+	defer conn.Close()
+
+	w := newSyslogTestWriter("udp", conn.LocalAddr().String())
+	l := newTestLogger(w)
+	l.Warnw("bas timeout", "brasip", "10.1.1.1", "text", `a "b"]`)
+	l.Close()
+
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("read err:%v", err)
+	}
+	// local0 warning: 16*8+4
+	checkSyslog(t, string(buf[:n]), 132, "WARN", ` brasip="10.1.1.1" text="a \"b\"\]"`, "bas timeout")
+}
+
+func TestSyslogTCPOctetCounting(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err:%v", err)
+	}
+	defer ln.Close()
+
+	w := newSyslogTestWriter("tcp", ln.Addr().String())
+	l := newTestLogger(w)
+	l.Info("first")
+	l.Public("accounting")
+	l.Close()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept err:%v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	rd := bufio.NewReader(conn)
+	for _, want := range []struct {
+		pri   int
+		level string
+		info  string
+	}{{134, "INFO", "first"}, {133, "PUBLIC", "accounting"}} {
+		size, err := rd.ReadString(' ')
+		if err != nil {
+			t.Fatalf("read err:%v", err)
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(size))
+		msg := make([]byte, n)
+		if _, err = io.ReadFull(rd, msg); err != nil {
+			t.Fatalf("read err:%v", err)
+		}
+		checkSyslog(t, string(msg), want.pri, want.level, "", want.info)
+	}
+}
+
+func TestSyslogUnixgram(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unixgram not supported:%v", err)
+	}
+	defer conn.Close()
+
+	w := newSyslogTestWriter("unixgram", path)
+	l := newTestLogger(w)
+	l.Error("disk full")
+	l.Close()
+
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("read err:%v", err)
+	}
+	checkSyslog(t, string(buf[:n]), 131, "ERROR", "", "disk full")
+}
+
+// the accounting stream goes to its own destination
+func TestPublicRouted(t *testing.T) {
+	var conns [2]*net.UDPConn
+	var writers [2]*SyslogWriter
+	for i := range conns {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("listen err:%v", err)
+		}
+		defer conn.Close()
+		conns[i] = conn
+		writers[i] = newSyslogTestWriter("udp", conn.LocalAddr().String())
+	}
+	writers[0].SetLogLevelCeil(FATAL)
+	writers[1].SetLogLevelFloor(PUBLIC)
+
+	l := newTestLogger(writers[0])
+	l.Register(writers[1])
+	l.Public("account")
+	l.Info("info")
+	l.Close()
+
+	for i, want := range []string{"info", "account"} {
+		buf := make([]byte, 2048)
+		conns[i].SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, err := conns[i].Read(buf)
+		if err != nil || !strings.HasSuffix(string(buf[:n]), "] "+want) {
+			t.Errorf("destination %v got:%q err:%v", i, buf[:n], err)
+		}
+		conns[i].SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		if n, err = conns[i].Read(buf); err == nil {
+			t.Errorf("destination %v unexpected:%q", i, buf[:n])
+		}
+	}
+}
+
+func TestNetJsonReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen err:%v", err)
+	}
+	defer ln.Close()
+
+	w := NewNetJsonWriter(ln.Addr().String())
+	l := newTestLogger(w)
+	defer l.Close()
+
+	l.Infow("before", "seq", 1)
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept err:%v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	var m map[string]interface{}
+	if err != nil || json.Unmarshal([]byte(line), &m) != nil || m["msg"] != "before" || m["seq"] != float64(1) {
+		t.Fatalf("line:%q err:%v", line, err)
+	}
+	conn.Close()
+
+	// the first writes after the close may still be accepted by the kernel
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+	var next net.Conn
+	for i := 0; next == nil && i < 100; i++ {
+		l.Infow("after", "seq", i)
+		select {
+		case next = <-accepted:
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	if next == nil {
+		t.Fatal("writer did not reconnect.")
+	}
+	defer next.Close()
+	next.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if line, err = bufio.NewReader(next).ReadString('\n'); err != nil || !strings.Contains(line, `"msg":"after"`) {
+		t.Errorf("line:%q err:%v", line, err)
+	}
+}
+
+func TestShipperBoundedBuffer(t *testing.T) {
+	// nothing listens there, records pile up
+	s := newShipper("tcp", "127.0.0.1:1")
+	s.SetBufferSize(2)
+	for i := 0; i < 5; i++ {
+		s.send([]byte{byte(i)})
+	}
+	if s.Dropped() != 3 || len(s.queue) != 2 {
+		t.Errorf("dropped:%v queued:%v", s.Dropped(), len(s.queue))
+	}
+	if msg := <-s.queue; msg[0] != 3 {
+		t.Errorf("oldest kept:%v", msg)
+	}
+}
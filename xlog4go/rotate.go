@@ -0,0 +1,195 @@
+package xlog4go
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rotateBySize moves the current file to the next free "<rotated name>.N" and opens a new one
+func (w *FileWriter) rotateBySize() error {
+	if err := w.fileBufWriter.Flush(); err != nil {
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	filePath := nextBackupName(w.rotateBase())
+	if err := os.Rename(w.filename, filePath); err != nil {
+		// keep logging into the old file rather than losing records
+		w.CreateLogFile()
+		return err
+	}
+
+	if err := w.CreateLogFile(); err != nil {
+		return err
+	}
+	w.afterRotate(filePath)
+	return nil
+}
+
+// rotateBase returns the name the time based rotation gives the current file
+func (w *FileWriter) rotateBase() string {
+	if len(w.actions) > 0 {
+		return fmt.Sprintf(w.pathFmt, w.variables...)
+	}
+	if w.pathFmt != "" {
+		return w.pathFmt
+	}
+	return w.filename
+}
+
+// nextBackupName returns base.N for the first N free, compressed or not
+func nextBackupName(base string) string {
+	for n := 1; ; n++ {
+		name := base + "." + strconv.Itoa(n)
+		if _, err := os.Stat(name); err == nil {
+			continue
+		}
+		if _, err := os.Stat(name + ".gz"); err == nil {
+			continue
+		}
+		return name
+	}
+}
+
+// backupPattern returns the directory of the rotated files of w and the pattern of their names:
+// the time based name of the rotate pattern or the ".N" of the size based rotation, each maybe ".gz"
+func (w *FileWriter) backupPattern() (dir string, re *regexp.Regexp) {
+	suffix := `(\.\d+)?(\.gz)?$`
+	base := w.pathFmt
+	if base == "" {
+		base = w.filename
+		suffix = `\.\d+(\.gz)?$`
+	}
+	dir, name := filepath.Split(base)
+	expr := regexp.QuoteMeta(name)
+	if len(w.actions) > 0 {
+		// the verbs left by convertPatternToFmt
+		expr = strings.NewReplacer("%02d", `\d+`, "%d", `\d+`).Replace(expr)
+	}
+	return dir, regexp.MustCompile("^" + expr + suffix)
+}
+
+// afterRotate compresses the rotated file and applies the retention, off the writer goroutine
+func (w *FileWriter) afterRotate(filePath string) {
+	if !w.compress && w.maxBackups <= 0 && w.maxAge <= 0 {
+		return
+	}
+	go func() {
+		w.cleanMu.Lock()
+		defer w.cleanMu.Unlock()
+
+		// a later rotation may have removed it already
+		if w.compress {
+			if err := gzipFile(filePath); err != nil && !os.IsNotExist(err) {
+				log.Println(err)
+			}
+		}
+		if err := w.removeOldBackups(time.Now()); err != nil {
+			log.Println(err)
+		}
+	}()
+}
+
+type backupFile struct {
+	path    string
+	modTime time.Time
+}
+
+// backups returns the rotated files of w, newest first
+func (w *FileWriter) backups() ([]backupFile, error) {
+	dir, pattern := w.backupPattern()
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	active := filepath.Clean(w.filename)
+	files := make([]backupFile, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !pattern.MatchString(e.Name()) {
+			continue
+		}
+		name := filepath.Join(dir, e.Name())
+		if name == active {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, backupFile{path: name, modTime: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.After(files[j].modTime)
+	})
+	return files, nil
+}
+
+// removeOldBackups keeps the newest maxBackups files not older than maxAge
+func (w *FileWriter) removeOldBackups(now time.Time) error {
+	if w.maxBackups <= 0 && w.maxAge <= 0 {
+		return nil
+	}
+	files, err := w.backups()
+	if err != nil {
+		return err
+	}
+	for i, f := range files {
+		if (w.maxBackups > 0 && i >= w.maxBackups) || (w.maxAge > 0 && now.Sub(f.modTime) > w.maxAge) {
+			if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+				log.Println(err)
+			}
+		}
+	}
+	return nil
+}
+
+// gzipFile replaces name by name.gz, keeping its modification time for the retention
+func gzipFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp := name + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err = os.Rename(tmp, name+".gz"); err != nil {
+		return err
+	}
+	os.Chtimes(name+".gz", info.ModTime(), info.ModTime())
+	return os.Remove(name)
+}
@@ -0,0 +1,185 @@
+package xlog4go
+
+import (
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ship_buffer_size_default = 4096
+	ship_dial_timeout        = time.Second * 2
+	ship_write_timeout       = time.Second * 2
+	ship_backoff_min         = time.Millisecond * 100
+	ship_backoff_max         = time.Second * 10
+	ship_close_timeout       = time.Second * 3
+)
+
+// shipper sends messages to a remote destination from its own goroutine,
+// a slow or unreachable destination never blocks the logger
+type shipper struct {
+	network string
+	addr    string
+	frame   func([]byte) []byte // framing of one message on the wire, nil for none
+
+	queue   chan []byte
+	dropped uint64
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	started bool
+}
+
+func newShipper(network, addr string) *shipper {
+	return &shipper{
+		network: network,
+		addr:    addr,
+		queue:   make(chan []byte, ship_buffer_size_default),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// SetBufferSize bounds the messages queued while the destination is slow or down, before start
+func (s *shipper) SetBufferSize(size int) {
+	if size > 0 {
+		s.queue = make(chan []byte, size)
+	}
+}
+
+// Dropped returns the number of messages dropped because the buffer was full
+func (s *shipper) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *shipper) start() {
+	if !s.started {
+		s.started = true
+		go s.run()
+	}
+}
+
+// send queues msg, the oldest queued message is dropped when the buffer is full
+func (s *shipper) send(msg []byte) {
+	for {
+		select {
+		case s.queue <- msg:
+			return
+		default:
+		}
+		select {
+		case <-s.queue:
+			atomic.AddUint64(&s.dropped, 1)
+		default:
+		}
+	}
+}
+
+func (s *shipper) run() {
+	defer close(s.done)
+
+	var (
+		conn    net.Conn
+		pending []byte
+		backoff = ship_backoff_min
+	)
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for {
+		if pending == nil {
+			select {
+			case pending = <-s.queue:
+			case <-s.stop:
+				conn = s.drain(conn)
+				return
+			}
+		}
+
+		if conn == nil {
+			var err error
+			if conn, err = net.DialTimeout(s.network, s.addr, ship_dial_timeout); err != nil {
+				conn = nil
+				if !s.wait(&backoff) {
+					return
+				}
+				continue
+			}
+		}
+
+		if err := s.write(conn, pending); err != nil {
+			// reconnect and send pending again
+			log.Println(err)
+			conn.Close()
+			conn = nil
+			if !s.wait(&backoff) {
+				return
+			}
+			continue
+		}
+		pending = nil
+		backoff = ship_backoff_min
+	}
+}
+
+// wait sleeps backoff and doubles it, false when stopped meanwhile
+func (s *shipper) wait(backoff *time.Duration) bool {
+	select {
+	case <-time.After(*backoff):
+	case <-s.stop:
+		return false
+	}
+	if *backoff *= 2; *backoff > ship_backoff_max {
+		*backoff = ship_backoff_max
+	}
+	return true
+}
+
+// drain sends what is queued on close, giving up at the first failure
+func (s *shipper) drain(conn net.Conn) net.Conn {
+	deadline := time.Now().Add(ship_close_timeout)
+	for time.Now().Before(deadline) {
+		var msg []byte
+		select {
+		case msg = <-s.queue:
+		default:
+			return conn
+		}
+		if conn == nil {
+			var err error
+			if conn, err = net.DialTimeout(s.network, s.addr, ship_dial_timeout); err != nil {
+				return nil
+			}
+		}
+		if err := s.write(conn, msg); err != nil {
+			return conn
+		}
+	}
+	return conn
+}
+
+func (s *shipper) write(conn net.Conn, msg []byte) error {
+	if s.frame != nil {
+		msg = s.frame(msg)
+	}
+	conn.SetWriteDeadline(time.Now().Add(ship_write_timeout))
+	_, err := conn.Write(msg)
+	return err
+}
+
+// Close sends the queued messages for a while and stops the goroutine
+func (s *shipper) Close() error {
+	if !s.started {
+		return nil
+	}
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+	return nil
+}
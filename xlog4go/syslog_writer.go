@@ -0,0 +1,176 @@
+package xlog4go
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// syslog facilities of RFC 5424
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslog severity of each level
+var syslogSeverities = [...]int{
+	TRACE:   7, // debug
+	DEBUG:   7, // debug
+	INFO:    6, // informational
+	WARNING: 4, // warning
+	ERROR:   3, // error
+	FATAL:   2, // critical
+	PUBLIC:  5, // notice
+}
+
+// structured data id of the record fields, 32473 is the enterprise number reserved for examples
+const syslog_sd_id = "xlog4go@32473"
+
+// ParseFacility converts a facility name of log.json to its code, user when empty
+func ParseFacility(s string) (facility int, err error) {
+	if s == "" {
+		return syslogFacilities["user"], nil
+	}
+	facility, ok := syslogFacilities[s]
+	if !ok {
+		err = errors.New("Invalid syslog facility")
+	}
+	return
+}
+
+// SyslogWriter sends RFC 5424 messages over udp, tcp, unix (stream) or unixgram,
+// tcp and unix streams use the octet counting framing of RFC 6587
+type SyslogWriter struct {
+	*shipper
+	logLevelFloor int
+	logLevelCeil  int
+	facility      int
+	hostname      string
+	appName       string
+	procId        string
+}
+
+func NewSyslogWriter(network, addr string) *SyslogWriter {
+	w := &SyslogWriter{
+		shipper:       newShipper(network, addr),
+		logLevelFloor: TRACE,
+		logLevelCeil:  FATAL,
+		facility:      syslogFacilities["user"],
+		hostname:      "-",
+		appName:       filepath.Base(os.Args[0]),
+		procId:        strconv.Itoa(os.Getpid()),
+	}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		w.hostname = host
+	}
+	if network == "tcp" || network == "unix" {
+		w.frame = octetCounting
+	}
+	return w
+}
+
+func (w *SyslogWriter) Init() error {
+	switch w.network {
+	case "udp", "tcp", "unix", "unixgram":
+	default:
+		return errors.New("Invalid syslog network (" + w.network + ")")
+	}
+	w.start()
+	return nil
+}
+
+func (w *SyslogWriter) SetLogLevelFloor(floor int) {
+	w.logLevelFloor = floor
+}
+
+func (w *SyslogWriter) SetLogLevelCeil(ceil int) {
+	w.logLevelCeil = ceil
+}
+
+func (w *SyslogWriter) SetFacility(facility int) {
+	w.facility = facility
+}
+
+// SetAppName sets the APP-NAME of the messages, the program name by default
+func (w *SyslogWriter) SetAppName(name string) {
+	if name != "" {
+		w.appName = name
+	}
+}
+
+func (w *SyslogWriter) Write(r *Record) error {
+	if r.level < w.logLevelFloor || r.level > w.logLevelCeil {
+		return nil
+	}
+	w.send(w.format(r))
+	return nil
+}
+
+// format returns "<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD] MSG"
+func (w *SyslogWriter) format(r *Record) []byte {
+	stamp := r.stamp
+	if stamp.IsZero() {
+		stamp = time.Now()
+	}
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "<%d>1 %s %s %s %s %s ",
+		w.facility*8+syslogSeverities[r.level], stamp.Format("2006-01-02T15:04:05.000000Z07:00"),
+		w.hostname, w.appName, w.procId, LEVEL_FLAGS[r.level])
+
+	buf.WriteString("[" + syslog_sd_id + " code=\"")
+	buf.WriteString(sdEscape(r.code))
+	buf.WriteString("\"")
+	for _, f := range r.fields {
+		buf.WriteString(" ")
+		buf.WriteString(sdName(f.Key))
+		buf.WriteString("=\"")
+		buf.WriteString(sdEscape(fmt.Sprint(f.value())))
+		buf.WriteString("\"")
+	}
+	buf.WriteString("] ")
+	buf.WriteString(r.info)
+	return buf.Bytes()
+}
+
+// sdEscape escapes '"', '\' and ']' of a PARAM-VALUE
+func sdEscape(s string) string {
+	if !strings.ContainsAny(s, "\"\\]") {
+		return s
+	}
+	var b strings.Builder
+	for _, c := range s {
+		if c == '"' || c == '\\' || c == ']' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// sdName drops the characters a PARAM-NAME may not hold, 32 at most
+func sdName(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if c > ' ' && c <= '~' && c != '=' && c != ']' && c != '"' {
+			b.WriteRune(c)
+		}
+		if b.Len() == 32 {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+func octetCounting(msg []byte) []byte {
+	return append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+}